@@ -0,0 +1,54 @@
+//! Collecting the grids of many small nets into point sets, as computing demand,
+//! wirelength and connectivity does, with `PointSet` and with `HashSet`.
+//! Run with `cargo bench --bench flat`.
+
+use cell_move_router::{Point, PointSet, Rng};
+use std::{
+    collections::HashSet,
+    hint::black_box,
+    time::{Duration, Instant},
+};
+
+/// Number of sets collected per run.
+const SETS: usize = 5000;
+/// Number of points of every set.
+const POINTS: usize = 40;
+/// Number of runs, the fastest of which is reported.
+const RUNS: usize = 20;
+
+/// The fastest of `RUNS` runs of `collect` over all the nets.
+fn fastest<F>(nets: &[Vec<Point<usize>>], collect: F) -> Duration
+where
+    F: Fn(&[Point<usize>]) -> usize,
+{
+    (0..RUNS)
+        .map(|_| {
+            let start = Instant::now();
+            let total: usize = nets.iter().map(|net| collect(net)).sum();
+            black_box(total);
+            start.elapsed()
+        })
+        .min()
+        .unwrap_or_default()
+}
+
+fn main() {
+    let mut rng = Rng::new(1008);
+    let nets: Vec<Vec<_>> = (0..SETS)
+        .map(|_| {
+            (0..POINTS)
+                .map(|_| Point(rng.below(1000), rng.below(1000), rng.below(8)))
+                .collect()
+        })
+        .collect();
+
+    let flat = fastest(&nets, |net| net.iter().copied().collect::<PointSet>().len());
+    let hashed = fastest(&nets, |net| {
+        net.iter().copied().collect::<HashSet<_>>().len()
+    });
+
+    println!(
+        "{} sets of {} points: PointSet {:.1?}, HashSet {:.1?}",
+        SETS, POINTS, flat, hashed
+    );
+}
@@ -2,14 +2,50 @@ use clap::Clap;
 
 #[derive(Clap, Clone, Default, Debug)]
 pub struct Args {
-    // input file name
+    // input file name, `-` for the standard input
     #[clap(short, long)]
     pub infile: String,
 
-    // output file name
+    // LEF file of the input, which is then a DEF file
+    #[clap(long)]
+    pub lef: Option<String>,
+
+    // the input is the `.aux` file of a design in Bookshelf files
+    #[clap(long)]
+    pub bookshelf: bool,
+
+    // the input is an ISPD global routing benchmark
+    #[clap(long)]
+    pub ispd: bool,
+
+    // the input is a design written by `--dump-json`
+    #[clap(long)]
+    pub json: bool,
+
+    // write the design read to this JSON file instead of running
+    #[clap(long)]
+    pub dump_json: Option<String>,
+
+    // tolerate this many recoverable problems of the input as warnings
+    #[clap(long)]
+    pub lenient: Option<usize>,
+
+    // output file name, `-` for the standard output
     #[clap(short, long)]
     pub outfile: String,
 
+    // placement file name, written in addition to the output file
+    #[clap(long)]
+    pub placement: Option<String>,
+
+    // print what has been read and done
+    #[clap(short, long)]
+    pub verbose: bool,
+
+    // show a live dashboard of the run on the terminal
+    #[clap(long)]
+    pub tui: bool,
+
     // time limit in seconds
     #[clap(short, long)]
     pub sec: Option<usize>,
@@ -29,4 +65,140 @@ pub struct Args {
     // route nets
     #[clap(short, long)]
     pub net: bool,
+
+    // reroute together the nets going through every congested corridor, before the others
+    #[clap(long)]
+    pub bundles: bool,
+
+    // input file of a previous version, used with `prev_outfile` to warm start
+    #[clap(long)]
+    pub prev_infile: Option<String>,
+
+    // output file of a previous version, used with `prev_infile` to warm start
+    #[clap(long)]
+    pub prev_outfile: Option<String>,
+
+    // run the commands of this script instead of optimizing
+    #[clap(long)]
+    pub script: Option<String>,
+
+    // run everything on a single thread, interleaving tasks in time slices
+    #[clap(long)]
+    pub single: bool,
+
+    // external command judging candidate moves
+    #[clap(long)]
+    pub plugin: Option<String>,
+
+    // weights of the wirelength on every layer and of vias
+    #[clap(long)]
+    pub weights: Option<String>,
+
+    // criticality weights and maximum lengths of nets
+    #[clap(long)]
+    pub timing: Option<String>,
+
+    // linear congestion model used to inflate costs of congested grids
+    #[clap(long)]
+    pub predictor: Option<String>,
+
+    // directory where a snapshot is written every iteration
+    #[clap(long)]
+    pub snapshots: Option<String>,
+
+    // stitch the snapshots into this animated SVG instead of running
+    #[clap(long)]
+    pub animate: Option<String>,
+
+    // recompute the demand from scratch and check it every this many iterations
+    #[clap(long)]
+    pub audit: Option<usize>,
+
+    // abort a search making no progress for this many seconds
+    #[clap(long)]
+    pub watchdog: Option<u64>,
+
+    // revert to the best solution and perturb it after no improvement for this many seconds
+    #[clap(long)]
+    pub restart_after: Option<u64>,
+
+    // seed of the random moves of restarts
+    #[clap(long)]
+    pub seed: Option<u64>,
+
+    // merge these output files of the same input instead of running
+    #[clap(long)]
+    pub ensemble: Vec<String>,
+
+    // names or regular expressions of the nets to rip up and reroute, one per line
+    #[clap(long)]
+    pub reroute_nets: Option<String>,
+
+    // score these output files of the same input instead of running
+    #[clap(long)]
+    pub score: Vec<String>,
+
+    // describe this net instead of running
+    #[clap(long)]
+    pub explain: Option<String>,
+
+    // describe this grid, as `<row> <col> <lay>`, instead of running
+    #[clap(long)]
+    pub query: Option<String>,
+
+    // output file or snapshot to apply before describing a net or a grid
+    #[clap(long)]
+    pub checkpoint: Option<String>,
+
+    // pack the routes of nets not being processed to save memory
+    #[clap(long)]
+    pub compact: bool,
+
+    // map the input file in memory instead of streaming it
+    #[clap(long)]
+    pub mmap: bool,
+
+    // track which pass committed every route segment, for debugging
+    #[clap(long)]
+    pub provenance: bool,
+
+    // vias consume the supply of their upper layer only, instead of both layers
+    #[clap(long)]
+    pub via_upper_only: bool,
+
+    // let path search go against the direction of layers, at this cost in grids per move
+    #[clap(long)]
+    pub wrong_way: Option<usize>,
+
+    // parse the cells, the nets and the routes of the input concurrently
+    #[clap(long)]
+    pub sections: bool,
+
+    // print a hash of the design read instead of running, to notice inputs that changed
+    #[clap(long)]
+    pub fingerprint: bool,
+
+    // read the input through a binary cache next to it, written on the first run
+    #[clap(long)]
+    pub cache: bool,
+
+    // check that the input is read back the same from what it is written as, instead of running
+    #[clap(long)]
+    pub round_trip: bool,
+
+    // patches adding cells and nets to the input, separated by commas
+    #[clap(long)]
+    pub patch: Option<String>,
+
+    // show the line of the first error of the input
+    #[clap(long)]
+    pub debug_parse: bool,
+
+    // print the throughput of parsing every section of the input instead of running
+    #[clap(long)]
+    pub bench: bool,
+
+    // remove the route segments of the input ending at no pin
+    #[clap(long)]
+    pub prune: bool,
 }
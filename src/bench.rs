@@ -0,0 +1,95 @@
+use crate::utilities::Tokens;
+use std::{
+    alloc::{GlobalAlloc, Layout, System},
+    fmt::{Display, Formatter, Result as FmtResult},
+    sync::atomic::{AtomicUsize, Ordering},
+    time::{Duration, Instant},
+};
+
+/// Number of allocations so far, counted if `Counting` is the global allocator.
+static ALLOCATIONS: AtomicUsize = AtomicUsize::new(0);
+
+/// The system allocator counting allocations, meant to be the global allocator of binaries
+/// so that benchmarks can report them.
+#[derive(Clone, Copy, Debug, Default)]
+pub struct Counting;
+
+unsafe impl GlobalAlloc for Counting {
+    unsafe fn alloc(&self, layout: Layout) -> *mut u8 {
+        ALLOCATIONS.fetch_add(1, Ordering::Relaxed);
+        System.alloc(layout)
+    }
+
+    unsafe fn dealloc(&self, ptr: *mut u8, layout: Layout) {
+        System.dealloc(ptr, layout)
+    }
+
+    unsafe fn realloc(&self, ptr: *mut u8, layout: Layout, new_size: usize) -> *mut u8 {
+        ALLOCATIONS.fetch_add(1, Ordering::Relaxed);
+        System.realloc(ptr, layout, new_size)
+    }
+}
+
+/// Number of allocations so far, always 0 unless `Counting` is the global allocator.
+pub fn allocations() -> usize {
+    ALLOCATIONS.load(Ordering::Relaxed)
+}
+
+/// Throughput of parsing a section of an input, see `Chip::bench_sections`.
+#[derive(Clone, Debug, Default, PartialEq)]
+pub struct SectionBench {
+    /// name of the section
+    pub name: &'static str,
+    /// size of the section
+    pub bytes: usize,
+    /// number of tokens of the section
+    pub tokens: usize,
+    /// time spent parsing the section
+    pub elapsed: Duration,
+    /// number of allocations while parsing the section, see `Counting`
+    pub allocations: usize,
+}
+
+impl SectionBench {
+    /// Measures parsing a section with `parse`.
+    pub fn measure<R>(name: &'static str, section: &str, parse: impl FnOnce() -> R) -> (R, Self) {
+        let allocations = allocations();
+        let start = Instant::now();
+        let parsed = parse();
+        let elapsed = start.elapsed();
+        let bench = Self {
+            name,
+            bytes: section.len(),
+            tokens: Tokens::new(section).count(),
+            elapsed,
+            allocations: self::allocations() - allocations,
+        };
+        (parsed, bench)
+    }
+
+    /// Megabytes parsed per second.
+    pub fn megabytes_per_sec(&self) -> f64 {
+        self.bytes as f64 / 1e6 / self.elapsed.as_secs_f64()
+    }
+
+    /// Tokens parsed per second.
+    pub fn tokens_per_sec(&self) -> f64 {
+        self.tokens as f64 / self.elapsed.as_secs_f64()
+    }
+}
+
+impl Display for SectionBench {
+    fn fmt(&self, f: &mut Formatter) -> FmtResult {
+        write!(
+            f,
+            "{:<12} {:>12} bytes {:>10} tokens in {:?}: {:.2} MB/s, {:.0} tokens/s, {} allocations",
+            self.name,
+            self.bytes,
+            self.tokens,
+            self.elapsed,
+            self.megabytes_per_sec(),
+            self.tokens_per_sec(),
+            self.allocations
+        )
+    }
+}
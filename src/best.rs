@@ -0,0 +1,91 @@
+use crate::{
+    chip::Chip,
+    components::{Pair, Provenance, Route},
+};
+use std::{collections::HashSet, mem};
+
+/// The best legal state of a chip seen so far, to go back to:
+/// the fewest overflowed grids, then the shortest weighted wirelength.
+/// States with broken nets are never the best, except the first one.
+#[derive(Debug, Default)]
+pub struct Best {
+    /// overflowed grids of the best state
+    overflow: usize,
+    /// weighted wirelength of the best state
+    wirelength: f64,
+    /// positions of the cells and whether they moved, in the best state
+    cells: Vec<(Pair<usize>, bool)>,
+    /// routes of the nets in the best state
+    routes: Vec<HashSet<Route<usize>>>,
+}
+
+impl Best {
+    /// Remembers the state of the chip as the best one so far.
+    pub fn new(chip: &Chip) -> Self {
+        let mut best = Self::default();
+        best.remember(chip);
+        best
+    }
+
+    /// Weighted wirelength of the best state.
+    pub fn wirelength(&self) -> f64 {
+        self.wirelength
+    }
+
+    /// Remembers the state of the chip if it is legal and better than the best one.
+    /// Returns whether it is remembered.
+    pub fn offer(&mut self, chip: &Chip) -> bool {
+        if !chip.broken.is_empty() {
+            return false;
+        }
+
+        let overflow = chip.overflowed_grids();
+        let better = overflow < self.overflow
+            || (overflow == self.overflow && chip.wirelength() < self.wirelength);
+        if better {
+            self.remember(chip);
+        }
+        better
+    }
+
+    /// Remembers the state of the chip as the best one.
+    fn remember(&mut self, chip: &Chip) {
+        self.overflow = chip.overflowed_grids();
+        self.wirelength = chip.wirelength();
+        self.cells = chip
+            .cells
+            .iter()
+            .map(|cell| (cell.position, cell.moved))
+            .collect();
+        self.routes = chip
+            .nets
+            .iter()
+            .map(|net| net.segments().into_owned())
+            .collect();
+    }
+
+    /// Reverts the chip to the best state.
+    /// Routes restored are tagged as restored by a restart if provenance is tracked.
+    pub fn revert(&self, chip: &mut Chip) {
+        let pass = mem::replace(&mut chip.pass, Provenance::Restart);
+        // routes first, so that cells moving back find their nets connected
+        for (net, routes) in self.routes.iter().enumerate() {
+            if *chip.nets[net].segments() != *routes {
+                chip.set_routes(net, routes.clone());
+            }
+        }
+        chip.pass = pass;
+
+        for (id, &(position, moved)) in self.cells.iter().enumerate() {
+            if chip.cells[id].position != position {
+                chip.move_cell(id, position);
+            }
+
+            // moving back is not a move
+            if chip.cells[id].moved && !moved {
+                chip.cells[id].moved = false;
+                chip.already_moved -= 1;
+            }
+        }
+    }
+}
@@ -0,0 +1,254 @@
+use crate::{
+    components::{Cell, FactoryID, Layer, MasterCell, MasterPin, Net},
+    consts::{BOOKSHELF_GCELL_ROWS, BOOKSHELF_LAYERS, BOOKSHELF_SUPPLY},
+};
+use anyhow::{anyhow, Result};
+use std::{collections::HashMap, fmt::Write, fs, path::Path};
+
+/// Names of a design read from Bookshelf files, indexed by id.
+/// Nodes and nets are renamed after their ids in the router, like `C12` or `N3`.
+#[derive(Clone, Debug, Default, Eq, PartialEq)]
+pub struct BookshelfNames {
+    /// nodes
+    pub cells: Vec<String>,
+    /// nets
+    pub nets: Vec<String>,
+}
+
+/// A node of a `.nodes` file.
+#[derive(Clone, Debug)]
+struct Node {
+    /// name of the node
+    name: String,
+    /// width and height
+    size: (f64, f64),
+    /// whether the node is a terminal, which never moves
+    terminal: bool,
+}
+
+/// Lines of a Bookshelf file split into words,
+/// without the header, comments, blank lines and `Num...` counts.
+fn lines(content: &str) -> impl Iterator<Item = Vec<&str>> {
+    content
+        .lines()
+        .map(|line| line.split('#').next().unwrap_or(""))
+        .filter(|line| !line.trim_start().starts_with("UCLA"))
+        .map(|line| line.split_whitespace().collect::<Vec<_>>())
+        .filter(|words| !words.is_empty())
+        .filter(|words| !(words[0].starts_with("Num") && words.get(1) == Some(&":")))
+}
+
+/// Parses a word of a line as a number.
+fn number(word: Option<&&str>) -> Result<f64> {
+    word.and_then(|word| word.parse().ok())
+        .ok_or_else(|| anyhow!("Expected a number, found {:?}", word))
+}
+
+/// Reads the files listed in a `.aux` file and translates them, see `translate_bookshelf`.
+pub fn read_aux(aux: &str) -> Result<(String, BookshelfNames)> {
+    let content = fs::read_to_string(aux)?;
+    let dir = Path::new(aux).parent().unwrap_or_else(|| Path::new(""));
+
+    // RowBasedPlacement : <design>.nodes <design>.nets <design>.wts <design>.pl <design>.scl
+    let files: Vec<_> = content
+        .split_whitespace()
+        .skip_while(|&word| word != ":")
+        .skip(1)
+        .collect();
+    let file = |ext: &str| {
+        files
+            .iter()
+            .find(|file| file.ends_with(ext))
+            .map(|file| dir.join(file))
+            .ok_or_else(|| anyhow!("No {} file in {}", ext, aux))
+    };
+
+    translate_bookshelf(
+        &fs::read_to_string(file(".nodes")?)?,
+        &fs::read_to_string(file(".nets")?)?,
+        &fs::read_to_string(file(".pl")?)?,
+    )
+}
+
+/// Translates Bookshelf `.nodes`, `.nets` and `.pl` files into the content of an input file,
+/// on a synthetic routing grid: GCells are squares spanning `BOOKSHELF_GCELL_ROWS` placement rows,
+/// and `BOOKSHELF_LAYERS` layers alternate between horizontal and vertical,
+/// every GCell of which has a supply of `BOOKSHELF_SUPPLY`.
+/// Nodes are put on the GCell of their centers, and all pins are on the first layer.
+/// Terminals and fixed nodes are fixed cells, and nets come unrouted.
+pub fn translate_bookshelf(nodes: &str, nets: &str, pl: &str) -> Result<(String, BookshelfNames)> {
+    // <nodeName> <width> <height> [terminal | terminal_NI]
+    let mut ids = HashMap::new();
+    let mut cells = Vec::new();
+    for words in lines(nodes) {
+        let name = words[0].to_string();
+        let size = (number(words.get(1))?, number(words.get(2))?);
+        let terminal = words
+            .get(3)
+            .map_or(false, |word| word.starts_with("terminal"));
+
+        if ids.insert(name.clone(), cells.len()).is_some() {
+            return Err(anyhow!("Node {} is defined twice", name));
+        }
+        cells.push(Node {
+            name,
+            size,
+            terminal,
+        });
+    }
+
+    // NetDegree : <degree> [<netName>]
+    // <nodeName> <direction> [: <xOffset> <yOffset>]
+    let mut pin_counts = vec![0; cells.len()];
+    let mut net_names = Vec::new();
+    let mut net_pins: Vec<Vec<(usize, usize)>> = Vec::new();
+    for words in lines(nets) {
+        if words[0] == "NetDegree" {
+            let name = words.get(3).map_or_else(
+                || format!("net{}", net_names.len()),
+                |name| name.to_string(),
+            );
+            net_names.push(name);
+            net_pins.push(Vec::new());
+            continue;
+        }
+
+        let pins = net_pins
+            .last_mut()
+            .ok_or_else(|| anyhow!("Pin {} before any NetDegree", words[0]))?;
+        let cell = *ids
+            .get(words[0])
+            .ok_or_else(|| anyhow!("Node {} not found", words[0]))?;
+        pins.push((cell, pin_counts[cell]));
+        pin_counts[cell] += 1;
+    }
+
+    // <nodeName> <x> <y> : <orientation> [/FIXED | /FIXED_NI]
+    let mut positions = vec![None; cells.len()];
+    let mut fixed = vec![false; cells.len()];
+    for words in lines(pl) {
+        let cell = *ids
+            .get(words[0])
+            .ok_or_else(|| anyhow!("Node {} not found", words[0]))?;
+        positions[cell] = Some((number(words.get(1))?, number(words.get(2))?));
+        fixed[cell] = words.iter().any(|word| word.starts_with("/FIXED"));
+    }
+
+    // centers of the nodes, and the grid around them
+    let centers = cells
+        .iter()
+        .zip(positions.iter())
+        .map(|(node, position)| {
+            let (x, y) = position.ok_or_else(|| anyhow!("Node {} is not placed", node.name))?;
+            Ok((x + node.size.0 / 2., y + node.size.1 / 2.))
+        })
+        .collect::<Result<Vec<_>>>()?;
+    let row_height = cells
+        .iter()
+        .filter(|node| !node.terminal && node.size.1 > 0.)
+        .map(|node| node.size.1)
+        .fold(f64::INFINITY, f64::min);
+    let side = if row_height.is_finite() {
+        row_height * BOOKSHELF_GCELL_ROWS as f64
+    } else {
+        1.
+    };
+    let (left, bottom, right, top) = centers.iter().fold(
+        (
+            f64::INFINITY,
+            f64::INFINITY,
+            f64::NEG_INFINITY,
+            f64::NEG_INFINITY,
+        ),
+        |(left, bottom, right, top), &(x, y)| {
+            (left.min(x), bottom.min(y), right.max(x), top.max(y))
+        },
+    );
+    let grid = |(x, y): (f64, f64)| (((y - bottom) / side) as usize, ((x - left) / side) as usize);
+    let (rows, cols) = if centers.is_empty() {
+        (1, 1)
+    } else {
+        let (row, col) = grid((right, top));
+        (row + 1, col + 1)
+    };
+
+    let mut text = String::new();
+    let movable: Vec<_> = (0..cells.len())
+        .map(|cell| !cells[cell].terminal && !fixed[cell])
+        .collect();
+    writeln!(
+        text,
+        "MaxCellMove {}",
+        movable.iter().filter(|&&movable| movable).count()
+    )?;
+    writeln!(text, "GGridBoundaryIdx 1 1 {} {}", rows, cols)?;
+
+    writeln!(text, "NumLayer {}", BOOKSHELF_LAYERS)?;
+    for lay in 0..BOOKSHELF_LAYERS {
+        let dir = if lay % 2 == 0 { "H" } else { "V" };
+        writeln!(
+            text,
+            "Lay {} {} {} {}",
+            Layer::from_num(lay)?,
+            lay + 1,
+            dir,
+            BOOKSHELF_SUPPLY
+        )?;
+    }
+    writeln!(text, "NumNonDefaultSupplyGGrid 0")?;
+
+    // nodes with the same number of pins share a mastercell
+    let mut mastercells: Vec<usize> = pin_counts.clone();
+    mastercells.sort_unstable();
+    mastercells.dedup();
+    writeln!(text, "NumMasterCell {}", mastercells.len())?;
+    for (id, &count) in mastercells.iter().enumerate() {
+        writeln!(text, "MasterCell {} {} 0", MasterCell::from_num(id)?, count)?;
+        for pin in 0..count {
+            writeln!(
+                text,
+                "Pin {} {}",
+                MasterPin::from_num(pin)?,
+                Layer::from_num(0)?
+            )?;
+        }
+    }
+    writeln!(text, "NumNeighborCellExtraDemand 0")?;
+
+    writeln!(text, "NumCellInst {}", cells.len())?;
+    for (id, &center) in centers.iter().enumerate() {
+        let (row, col) = grid(center);
+        let mc = mastercells
+            .binary_search(&pin_counts[id])
+            .expect("MasterCell not found");
+        writeln!(
+            text,
+            "CellInst {} {} {} {} {}",
+            Cell::from_num(id)?,
+            MasterCell::from_num(mc)?,
+            row + 1,
+            col + 1,
+            if movable[id] { "Movable" } else { "Fixed" }
+        )?;
+    }
+
+    writeln!(text, "NumNets {}", net_pins.len())?;
+    for (id, pins) in net_pins.iter().enumerate() {
+        writeln!(text, "Net {} {} NoCstr", Net::from_num(id)?, pins.len())?;
+        for &(cell, pin) in pins.iter() {
+            writeln!(
+                text,
+                "Pin {}/{}",
+                Cell::from_num(cell)?,
+                MasterPin::from_num(pin)?
+            )?;
+        }
+    }
+    writeln!(text, "NumRoutes 0")?;
+
+    let names = BookshelfNames {
+        cells: cells.into_iter().map(|node| node.name).collect(),
+        nets: net_names,
+    };
+    Ok((text, names))
+}
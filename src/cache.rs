@@ -0,0 +1,279 @@
+use crate::design::{
+    Design, DesignArea, DesignCell, DesignLayer, DesignMasterCell, DesignNet, DesignRule,
+};
+use anyhow::{anyhow, Result};
+use std::{
+    fs::File,
+    io::{BufReader, BufWriter, Read, Write},
+};
+
+/// First bytes of cache files.
+const MAGIC: &[u8; 4] = b"CMRC";
+
+/// Version of the layout of cache files, to be bumped whenever it changes.
+const VERSION: u64 = 2;
+
+/// Writes numbers as 8 little-endian bytes, and strings and lists after their lengths.
+struct Encoder<W: Write> {
+    /// where bytes are written
+    writer: W,
+}
+
+impl<W: Write> Encoder<W> {
+    /// Writes a number.
+    fn usize(&mut self, value: usize) -> Result<()> {
+        self.writer.write_all(&(value as u64).to_le_bytes())?;
+        Ok(())
+    }
+
+    /// Writes a signed number.
+    fn isize(&mut self, value: isize) -> Result<()> {
+        self.writer.write_all(&(value as i64).to_le_bytes())?;
+        Ok(())
+    }
+
+    /// Writes a boolean, as a number.
+    fn bool(&mut self, value: bool) -> Result<()> {
+        self.usize(value as usize)
+    }
+
+    /// Writes a string after its length.
+    fn string(&mut self, value: &str) -> Result<()> {
+        self.usize(value.len())?;
+        self.writer.write_all(value.as_bytes())?;
+        Ok(())
+    }
+
+    /// Writes a list after its length, every item with `item`.
+    fn list<T>(
+        &mut self,
+        items: &[T],
+        mut item: impl FnMut(&mut Self, &T) -> Result<()>,
+    ) -> Result<()> {
+        self.usize(items.len())?;
+        for value in items.iter() {
+            item(self, value)?;
+        }
+        Ok(())
+    }
+}
+
+/// Reads what `Encoder` writes.
+struct Decoder<R: Read> {
+    /// where bytes are read
+    reader: R,
+}
+
+impl<R: Read> Decoder<R> {
+    /// Reads a number.
+    fn usize(&mut self) -> Result<usize> {
+        let mut bytes = [0; 8];
+        self.reader.read_exact(&mut bytes)?;
+        Ok(u64::from_le_bytes(bytes) as usize)
+    }
+
+    /// Reads a signed number.
+    fn isize(&mut self) -> Result<isize> {
+        let mut bytes = [0; 8];
+        self.reader.read_exact(&mut bytes)?;
+        Ok(i64::from_le_bytes(bytes) as isize)
+    }
+
+    /// Reads a boolean.
+    fn bool(&mut self) -> Result<bool> {
+        Ok(self.usize()? != 0)
+    }
+
+    /// Reads a string.
+    fn string(&mut self) -> Result<String> {
+        let len = self.usize()?;
+        let mut bytes = Vec::new();
+        (&mut self.reader)
+            .take(len as u64)
+            .read_to_end(&mut bytes)?;
+        if bytes.len() != len {
+            return Err(anyhow!("Unexpected end of cache"));
+        }
+        Ok(String::from_utf8(bytes)?)
+    }
+
+    /// Reads a list, every item with `item`.
+    fn list<T>(&mut self, mut item: impl FnMut(&mut Self) -> Result<T>) -> Result<Vec<T>> {
+        let len = self.usize()?;
+        // lengths are not trusted with allocations, a corrupted one would fail reading anyway
+        let mut items = Vec::new();
+        for _ in 0..len {
+            items.push(item(self)?);
+        }
+        Ok(items)
+    }
+}
+
+/// Writes a design to a cache file, with the stamp of the input it was read from.
+pub fn write_cache(filename: &str, design: &Design, stamp: u64) -> Result<()> {
+    let mut encoder = Encoder {
+        writer: BufWriter::new(File::create(filename)?),
+    };
+    encoder.writer.write_all(MAGIC)?;
+    encoder.usize(VERSION as usize)?;
+    encoder.writer.write_all(&stamp.to_le_bytes())?;
+
+    encoder.usize(design.max_move)?;
+    encoder.usize(design.dim.0)?;
+    encoder.usize(design.dim.1)?;
+    encoder.list(&design.layers, |encoder, layer| {
+        encoder.string(&layer.direction)?;
+        encoder.usize(layer.supply)
+    })?;
+    encoder.list(
+        &design.non_default_supply,
+        |encoder, &(row, col, lay, change)| {
+            encoder.usize(row)?;
+            encoder.usize(col)?;
+            encoder.usize(lay)?;
+            encoder.isize(change)
+        },
+    )?;
+    encoder.list(&design.mastercells, |encoder, mc| {
+        encoder.list(&mc.pins, |encoder, &layer| encoder.usize(layer))?;
+        encoder.list(&mc.blockages, |encoder, &(layer, demand)| {
+            encoder.usize(layer)?;
+            encoder.usize(demand)
+        })
+    })?;
+    encoder.list(&design.extra_demand, |encoder, rule| {
+        encoder.string(&rule.kind)?;
+        encoder.usize(rule.mastercells.0)?;
+        encoder.usize(rule.mastercells.1)?;
+        encoder.usize(rule.layer)?;
+        encoder.usize(rule.demand)
+    })?;
+    encoder.list(&design.cells, |encoder, cell| {
+        encoder.usize(cell.mastercell)?;
+        encoder.usize(cell.position.0)?;
+        encoder.usize(cell.position.1)?;
+        encoder.bool(cell.movable)
+    })?;
+    encoder.list(&design.nets, |encoder, net| {
+        encoder.usize(net.min_layer)?;
+        encoder.list(&net.pins, |encoder, &(cell, pin)| {
+            encoder.usize(cell)?;
+            encoder.usize(pin)
+        })?;
+        encoder.list(&net.routes, |encoder, raw| {
+            raw.iter().try_for_each(|&idx| encoder.usize(idx))
+        })
+    })?;
+    encoder.list(&design.voltage_areas, |encoder, area| {
+        encoder.string(&area.name)?;
+        encoder.list(&area.grids, |encoder, &(row, col)| {
+            encoder.usize(row)?;
+            encoder.usize(col)
+        })?;
+        encoder.list(&area.cells, |encoder, &cell| encoder.usize(cell))
+    })?;
+
+    encoder.writer.flush()?;
+    Ok(())
+}
+
+/// Reads a design from a cache file.
+/// Returns the stamp of the input it was read from, and the design.
+pub fn read_cache(filename: &str) -> Result<(u64, Design)> {
+    let mut decoder = Decoder {
+        reader: BufReader::new(File::open(filename)?),
+    };
+    let mut magic = [0; 4];
+    decoder.reader.read_exact(&mut magic)?;
+    if &magic != MAGIC {
+        return Err(anyhow!("{} is not a cache file", filename));
+    }
+    let version = decoder.usize()? as u64;
+    if version != VERSION {
+        return Err(anyhow!(
+            "{} is of version {}, expected {}",
+            filename,
+            version,
+            VERSION
+        ));
+    }
+    let mut stamp = [0; 8];
+    decoder.reader.read_exact(&mut stamp)?;
+
+    let max_move = decoder.usize()?;
+    let dim = (decoder.usize()?, decoder.usize()?);
+    let layers = decoder.list(|decoder| {
+        Ok(DesignLayer {
+            direction: decoder.string()?,
+            supply: decoder.usize()?,
+        })
+    })?;
+    let non_default_supply = decoder.list(|decoder| {
+        Ok((
+            decoder.usize()?,
+            decoder.usize()?,
+            decoder.usize()?,
+            decoder.isize()?,
+        ))
+    })?;
+    let mastercells = decoder.list(|decoder| {
+        Ok(DesignMasterCell {
+            pins: decoder.list(Decoder::usize)?,
+            blockages: decoder.list(|decoder| Ok((decoder.usize()?, decoder.usize()?)))?,
+        })
+    })?;
+    let extra_demand = decoder.list(|decoder| {
+        Ok(DesignRule {
+            kind: decoder.string()?,
+            mastercells: (decoder.usize()?, decoder.usize()?),
+            layer: decoder.usize()?,
+            demand: decoder.usize()?,
+        })
+    })?;
+    let cells = decoder.list(|decoder| {
+        Ok(DesignCell {
+            mastercell: decoder.usize()?,
+            position: (decoder.usize()?, decoder.usize()?),
+            movable: decoder.bool()?,
+        })
+    })?;
+    let nets = decoder.list(|decoder| {
+        Ok(DesignNet {
+            min_layer: decoder.usize()?,
+            pins: decoder.list(|decoder| Ok((decoder.usize()?, decoder.usize()?)))?,
+            routes: decoder.list(|decoder| {
+                let mut raw = [0; 6];
+                for idx in raw.iter_mut() {
+                    *idx = decoder.usize()?;
+                }
+                Ok(raw)
+            })?,
+            provenance: Vec::new(),
+        })
+    })?;
+    let voltage_areas = decoder.list(|decoder| {
+        Ok(DesignArea {
+            name: decoder.string()?,
+            grids: decoder.list(|decoder| Ok((decoder.usize()?, decoder.usize()?)))?,
+            cells: decoder.list(Decoder::usize)?,
+        })
+    })?;
+
+    let mut rest = [0; 1];
+    if decoder.reader.read(&mut rest)? != 0 {
+        return Err(anyhow!("{} has trailing data", filename));
+    }
+
+    let design = Design {
+        max_move,
+        dim,
+        layers,
+        non_default_supply,
+        mastercells,
+        extra_demand,
+        cells,
+        nets,
+        voltage_areas,
+    };
+    Ok((u64::from_le_bytes(stamp), design))
+}
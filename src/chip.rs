@@ -1,17 +1,55 @@
 use crate::{
     args::Args,
+    bench::SectionBench,
+    bookshelf::{self, BookshelfNames},
+    cache,
     components::{
         Blockage, Cell, CellType, Conflict, ConflictType, Direction, FactoryID, Layer, MasterCell,
-        MasterPin, Net, Pair, Route,
+        MasterPin, Net, Pair, PinRef, Point, Provenance, Route, ViaModel, VoltageArea, WrongWay,
     },
-    utilities,
+    criticality::Criticality,
+    dashboard::Dashboard,
+    decompose::Decomposition,
+    deferred::Escalation,
+    design::Design,
+    flat::PointSet,
+    grid::RoutingGrid,
+    ispd,
+    layers::LayerTable,
+    lefdef::{self, LefDefNames},
+    library::MasterCellLib,
+    optimizer::{self, Optimizer, Routed},
+    packed::PackedRoutes,
+    plugin::Plugin,
+    predictor::{Predictor, NUM_FEATURES},
+    report::Report,
+    restart::Restart,
+    rules::ExtraDemandRules,
+    scheduler::{Flush, Poll, Scheduler, Task},
+    search::Moves,
+    sections::{NetsSection, RoutesSection, Sections, Selection},
+    solution::Solution,
+    topology::{prim_tree, steiner_tree, Topology},
+    tree::RouteTree,
+    utilities::{self, Lookahead, Stream, Tokenizer, Tokens, Traced, UnionFind, STDIO},
+    watchdog::{Progress, Watchdog},
+    weights::Weights,
 };
-use anyhow::{anyhow, Result};
+use anyhow::{anyhow, Error, Result};
+use memmap::Mmap;
 use rayon::prelude::*;
+use regex::Regex;
 use std::{
+    cmp,
     collections::{HashMap, HashSet},
-    fmt::{Display, Error as FmtError, Formatter, Result as FmtResult},
-    fs,
+    fmt::{Display, Formatter, Result as FmtResult},
+    fs::{self, File},
+    io::{self, BufRead, Read, Write},
+    mem,
+    ops::Deref,
+    path::Path,
+    str,
+    sync::Arc,
     time::{Duration, Instant},
 };
 
@@ -33,31 +71,717 @@ pub struct Chip {
     pub nets: Vec<Net>,
     /// all conflicts
     pub conflicts: HashMap<usize, HashSet<Conflict>>,
+    /// nets connected to every cell
+    pub cell_nets: Vec<Vec<usize>>,
+    /// cells on every grid, indexed like `Layer::capacity`
+    pub cells_at: Vec<Vec<usize>>,
+    /// demand of every grid, indexed like `grid_index` and maintained incrementally
+    pub demand: Vec<usize>,
+    /// resolved pins of every net, refreshed on cell moves
+    pin_refs: Vec<Vec<PinRef>>,
+    /// lower bound of the wirelength of every net, refreshed on cell moves
+    bounds: Vec<usize>,
+    /// nets changed since the last snapshot
+    pub touched_nets: HashSet<usize>,
+    /// external judge of candidate moves
+    pub plugin: Option<Plugin>,
+    /// cost multiplier of every grid, indexed like `grid_features`, empty if not predicted
+    pub inflation: Vec<f64>,
+    /// predictor the inflation comes from, kept to inflate the next design read
+    predictor: Option<Box<dyn Predictor>>,
+    /// weights of the wirelength
+    pub weights: Weights,
+    /// weights and maximum lengths of critical nets
+    pub criticality: Criticality,
+    /// nets forced to be ripped up and rerouted, the only ones routed if any
+    pub forced: HashSet<usize>,
+    /// nets whose routes no longer connect their pins since a cell moved
+    pub broken: HashSet<usize>,
+    /// weighted wirelength of the initial routes
+    pub baseline: f64,
+    /// regions restricting where some cells may be
+    pub voltage_areas: Vec<VoltageArea>,
+    /// voltage area of every cell, if any
+    pub cell_areas: Vec<Option<usize>>,
+    /// how many recoverable problems of inputs are tolerated as warnings, none if `None`
+    pub lenient: Option<usize>,
+    /// pass committing routes now, which new route segments are tagged with
+    pub pass: Provenance,
+    /// pass which committed every route segment of every net, if tracked
+    pub provenance: Option<Vec<HashMap<Route<usize>, Provenance>>>,
+    /// how vias consume the supply of the layers they go through
+    pub via_model: ViaModel,
+    /// whether path search may go against the direction of layers, and at which cost
+    pub wrong_way: WrongWay,
+    /// buffers of the designs released, reused by the next one read
+    spare: Spare,
+}
+
+/// Buffers of released designs, which reading reuses
+/// so that memory does not ratchet up over many designs read in a row.
+#[derive(Debug, Default)]
+struct Spare {
+    /// numbers of every grid, like supplies and demand
+    grids: Vec<Vec<usize>>,
+    /// cells on every grid
+    cells_at: Vec<Vec<usize>>,
+    /// nets connected to every cell
+    cell_nets: Vec<Vec<usize>>,
 }
 
 impl Chip {
+    /// Empties the chip so that another design can be read into it,
+    /// as when processing many designs in a row in one process.
+    /// Settings of the run are kept: leniency, via model, wrong-way moves, weights,
+    /// criticality, plugin, provenance tracking and inflation, the last two redone on the next read.
+    /// So are the biggest buffers, which the next design read reuses.
+    pub fn release(&mut self) {
+        let mut spare = mem::take(&mut self.spare);
+        spare.grids.push(mem::take(&mut self.demand));
+        spare
+            .grids
+            .extend(self.layers.drain(..).map(|layer| layer.capacity));
+        spare.grids.retain(|grid| grid.capacity() > 0);
+        if self.cells_at.len() > spare.cells_at.len() {
+            spare.cells_at = mem::take(&mut self.cells_at);
+        }
+        if self.cell_nets.len() > spare.cell_nets.len() {
+            spare.cell_nets = mem::take(&mut self.cell_nets);
+        }
+
+        *self = Self {
+            lenient: self.lenient,
+            via_model: self.via_model,
+            wrong_way: self.wrong_way,
+            weights: mem::take(&mut self.weights),
+            criticality: mem::take(&mut self.criticality),
+            plugin: self.plugin.take(),
+            provenance: self.provenance.as_ref().map(|_| Vec::new()),
+            predictor: self.predictor.take(),
+            spare,
+            ..Self::default()
+        };
+    }
+
+    /// A buffer of `len` numbers set to `value`, reusing the biggest spare one if any.
+    fn recycle_grids(&mut self, len: usize, value: usize) -> Vec<usize> {
+        let biggest =
+            (0..self.spare.grids.len()).max_by_key(|&idx| self.spare.grids[idx].capacity());
+        let mut grids = match biggest {
+            Some(idx) => self.spare.grids.swap_remove(idx),
+            None => Vec::new(),
+        };
+        grids.clear();
+        grids.resize(len, value);
+        grids
+    }
+
     /// Reads the content of a file into memory.
     /// This function reads the input file and stores it into `self`.
-    pub fn read_file(&mut self, filename: &str) -> Result<()> {
-        let content: String = fs::read_to_string(filename)?;
-        self.read_str(&content)
+    /// The file is streamed, so that it is never held in memory as a whole,
+    /// and decompressed on the fly if compressed, see `utilities::open`.
+    /// The standard input is read if the file is named `-`.
+    pub fn read_file(&mut self, filename: &str) -> Result<Report> {
+        self.read_from(utilities::open(filename)?)
+    }
+
+    /// Reads the content of a reader into memory, like `read_file`.
+    pub fn read_from<R>(&mut self, reader: R) -> Result<Report>
+    where
+        R: BufRead + 'static,
+    {
+        let stream = &mut Stream::new(utilities::decompress(reader, None)?);
+        let report = self.read_tokens(stream);
+
+        // reading errors end the stream early, they come before the parsing errors they cause
+        match stream.take_error() {
+            Some(err) => Err(err.into()),
+            None => report,
+        }
+    }
+
+    /// Reads the content of a file mapped in memory.
+    /// Tokens are slices of the mapped bytes, so that nothing as big as the file is allocated.
+    pub fn read_mmap(&mut self, filename: &str) -> Result<Report> {
+        let file = File::open(filename)?;
+
+        // empty files cannot be mapped
+        if file.metadata()?.len() == 0 {
+            return self.read_str("");
+        }
+
+        // the file must not be modified while mapped, which is on the user
+        let mmap = unsafe { Mmap::map(&file)? };
+        self.read_str(str::from_utf8(&mmap)?)
+    }
+
+    /// Reads the content of a file section by section:
+    /// the sections are found first, then the cells, the nets and the routes
+    /// are parsed concurrently once the head is, and merged.
+    /// Falls back to reading the file as a whole if the sections cannot be found.
+    pub fn read_sections(&mut self, filename: &str) -> Result<Report> {
+        self.read_selected(filename, Selection::default())
+    }
+
+    /// Reads only some sections of a file, like `read_sections`, skipping the others.
+    /// The layers and supplies are always read.
+    /// Unless the cells are read, nothing derived from them is, like the demand,
+    /// and the pins of the nets are not checked.
+    /// All the sections are read if they cannot be found.
+    pub fn read_selected(&mut self, filename: &str, selection: Selection) -> Result<Report> {
+        selection.check()?;
+
+        let mut content = String::new();
+        utilities::open(filename)?.read_to_string(&mut content)?;
+        let sections = match Sections::index(&content) {
+            Some(sections) => sections,
+            None => return self.read_str(&content),
+        };
+
+        let start = Instant::now();
+        let [head, mastercells, cells, nets, routes, rest] = sections.split(&content);
+        let mut report = parse_section(head, |tokens, report, at| {
+            self.parse_head(tokens, report, at)
+        })?
+        .1;
+        if selection.mastercells {
+            let parsed = parse_section(mastercells, |tokens, report, at| {
+                self.parse_mastercells(tokens, report, at)
+            })?;
+            report.warnings.extend(parsed.1.warnings);
+        }
+
+        // the routes need the number of nets, a wrong one is reported by the nets first
+        let net_count = Tokens::new(nets.0)
+            .nth(1)
+            .and_then(|count| count.parse().ok())
+            .unwrap_or(0);
+
+        let chip = &*self;
+        let ((cells, nets), routes) = rayon::join(
+            || {
+                rayon::join(
+                    || {
+                        selection.cells.then(|| {
+                            parse_section(cells, |tokens, report, at| {
+                                chip.parse_cells(tokens, report, at)
+                            })
+                        })
+                    },
+                    || {
+                        selection.nets.then(|| {
+                            parse_section(nets, |tokens, _, at| chip.parse_nets(tokens, at, false))
+                        })
+                    },
+                )
+            },
+            || {
+                selection.routes.then(|| {
+                    parse_section(routes, |tokens, report, at| {
+                        chip.parse_routes(tokens, report, at, net_count)
+                    })
+                })
+            },
+        );
+        let (cells, nets, routes) = (
+            cells.transpose()?.unwrap_or_default(),
+            nets.transpose()?.unwrap_or_default(),
+            routes.transpose()?,
+        );
+        for part in [&cells.1, &nets.1].iter() {
+            report.warnings.extend(part.warnings.iter().cloned());
+        }
+        let routes = match routes {
+            Some((routes, part)) => {
+                report.warnings.extend(part.warnings);
+                routes
+            }
+            None => RoutesSection::new(nets.0.layers.len()),
+        };
+        self.check_tolerated(&report)?;
+
+        self.cells = cells.0;
+        if selection.cells {
+            for (idx, pins) in nets.0.pins.iter().enumerate() {
+                for &(cell, pin) in pins.iter() {
+                    self.check_pin(cell, pin)
+                        .map_err(|err| anyhow!("In Net #{}: {}", idx + 1, err))?;
+                }
+            }
+        }
+        self.merge_sections(nets.0, routes, &mut report)?;
+        if selection.cells {
+            self.derive();
+        }
+
+        self.cell_areas = vec![None; self.cells.len()];
+        if selection.areas {
+            let areas = parse_section(rest, |tokens, report, at| {
+                self.parse_areas(tokens, report, at)
+            })?;
+            report.warnings.extend(areas.1.warnings);
+            self.check_tolerated(&report)?;
+        }
+
+        self.finish_report(&mut report);
+        report.elapsed = start.elapsed();
+        Ok(report)
+    }
+
+    /// Reads the design of a file without its routes, all that scoring outputs needs,
+    /// see `score_file`, so that nothing is built for routing.
+    pub fn read_unrouted(&mut self, filename: &str) -> Result<Report> {
+        self.read_selected(
+            filename,
+            Selection {
+                routes: false,
+                ..Selection::default()
+            },
+        )
+    }
+
+    /// Reads the content of a file section by section, one after the other,
+    /// measuring the throughput of parsing every section, to notice parser regressions.
+    pub fn bench_sections(&mut self, filename: &str) -> Result<Vec<SectionBench>> {
+        let mut content = String::new();
+        utilities::open(filename)?.read_to_string(&mut content)?;
+        let sections = Sections::index(&content)
+            .ok_or_else(|| anyhow!("The sections of {} cannot be found", filename))?;
+        let [head, mastercells, cells, nets, routes, rest] = sections.split(&content);
+
+        let (parsed, head) = SectionBench::measure("head", head.0, || {
+            parse_section(head, |tokens, report, at| {
+                self.parse_head(tokens, report, at)
+            })
+        });
+        let mut report = parsed?.1;
+        let mut benches = vec![head];
+
+        let (parsed, bench) = SectionBench::measure("mastercells", mastercells.0, || {
+            parse_section(mastercells, |tokens, report, at| {
+                self.parse_mastercells(tokens, report, at)
+            })
+        });
+        report.warnings.extend(parsed?.1.warnings);
+        benches.push(bench);
+
+        let (parsed, bench) = SectionBench::measure("cells", cells.0, || {
+            parse_section(cells, |tokens, report, at| {
+                self.parse_cells(tokens, report, at)
+            })
+        });
+        let (cells, part) = parsed?;
+        report.warnings.extend(part.warnings);
+        self.cells = cells;
+        benches.push(bench);
+
+        let (parsed, bench) = SectionBench::measure("nets", nets.0, || {
+            parse_section(nets, |tokens, _, at| self.parse_nets(tokens, at, true))
+        });
+        let (nets, part) = parsed?;
+        report.warnings.extend(part.warnings);
+        benches.push(bench);
+
+        let net_count = nets.layers.len();
+        let (parsed, bench) = SectionBench::measure("routes", routes.0, || {
+            parse_section(routes, |tokens, report, at| {
+                self.parse_routes(tokens, report, at, net_count)
+            })
+        });
+        let (routes, part) = parsed?;
+        report.warnings.extend(part.warnings);
+        benches.push(bench);
+
+        self.merge_sections(nets, routes, &mut report)?;
+        self.derive();
+        self.cell_areas = vec![None; self.cells.len()];
+
+        let (parsed, bench) = SectionBench::measure("areas", rest.0, || {
+            parse_section(rest, |tokens, report, at| {
+                self.parse_areas(tokens, report, at)
+            })
+        });
+        report.warnings.extend(parsed?.1.warnings);
+        benches.push(bench);
+
+        self.check_tolerated(&report)?;
+        self.finish_report(&mut report);
+        Ok(benches)
+    }
+
+    /// Reads a design in LEF and DEF files into memory, see `lefdef::translate_lef_def`.
+    /// Returns a report of what has been read, and the names of the design.
+    pub fn read_lef_def(&mut self, lef: &str, def: &str) -> Result<(Report, LefDefNames)> {
+        let (content, names) =
+            lefdef::translate_lef_def(&fs::read_to_string(lef)?, &fs::read_to_string(def)?)?;
+        Ok((self.read_str(&content)?, names))
+    }
+
+    /// Reads a design from a JSON file written by `write_json`.
+    /// Returns a report of what has been read.
+    pub fn read_json(&mut self, filename: &str) -> Result<Report> {
+        self.read_design(&Design::read_file(filename)?)
+    }
+
+    /// Builds the chip from a design, like reading the input it stands for.
+    /// The design is checked first, see `Design::check`.
+    /// Returns a report of what has been read.
+    pub fn read_design(&mut self, design: &Design) -> Result<Report> {
+        let start = Instant::now();
+        let mut report = Report::default();
+        design.check()?;
+
+        self.max_move = design.max_move;
+        self.dim = Pair(design.dim.0, design.dim.1);
+        for (id, layer) in design.layers.iter().enumerate() {
+            let direction = match &*layer.direction {
+                "H" => Direction::Horizontal,
+                _ => Direction::Vertical,
+            };
+            let capacity = self.recycle_grids(self.dim.size(), layer.supply);
+            self.layers.push(Layer {
+                id,
+                direction,
+                dim: self.dim,
+                supply: layer.supply,
+                adjustments: Vec::new(),
+                capacity,
+            });
+        }
+        for &(row, col, lay, change) in design.non_default_supply.iter() {
+            let layer = &mut self.layers[lay];
+            layer.adjustments.push((Pair(row, col), change));
+            let capacity = layer
+                .get_capacity_mut(row, col)
+                .expect("Cell index out of bounds");
+            *capacity = cmp::max(*capacity as isize + change, 0) as usize;
+        }
+
+        self.mastercells = design
+            .mastercells
+            .iter()
+            .enumerate()
+            .map(|(id, mc)| MasterCell {
+                id,
+                pins: mc
+                    .pins
+                    .iter()
+                    .enumerate()
+                    .map(|(id, &layer)| MasterPin { id, layer })
+                    .collect(),
+                blkgs: mc
+                    .blockages
+                    .iter()
+                    .enumerate()
+                    .map(|(id, &(layer, demand))| Blockage { id, layer, demand })
+                    .collect(),
+            })
+            .collect();
+
+        // rules are stored both ways, once per mastercell
+        for rule in design.extra_demand.iter() {
+            let kind = if rule.kind == "adjHGGrid" {
+                ConflictType::AdjHGGrid
+            } else {
+                ConflictType::SameGGrid
+            };
+            let (mc1, mc2) = rule.mastercells;
+            for &(mc, other) in [(mc1, mc2), (mc2, mc1)].iter() {
+                self.conflicts.entry(mc).or_default().insert(Conflict {
+                    kind,
+                    id: other,
+                    layer: rule.layer,
+                    demand: rule.demand,
+                });
+            }
+        }
+
+        let mut pin_count = 0;
+        for (id, cell) in design.cells.iter().enumerate() {
+            let length = self.mastercells[cell.mastercell].pins.len();
+            self.cells.push(Cell {
+                id,
+                mastercell: cell.mastercell,
+                movable: if cell.movable {
+                    CellType::Movable
+                } else {
+                    CellType::Fixed
+                },
+                moved: false,
+                position: Pair(cell.position.0, cell.position.1),
+                pins: (pin_count..pin_count + length).collect(),
+            });
+            pin_count += length;
+        }
+
+        let mut nets = NetsSection::default();
+        let mut routes = RoutesSection::new(design.nets.len());
+        for (id, net) in design.nets.iter().enumerate() {
+            let mut pins = Vec::with_capacity(net.pins.len());
+            for &pin in net.pins.iter() {
+                if pins.contains(&pin) {
+                    nets.duplicates += 1;
+                } else {
+                    pins.push(pin);
+                }
+            }
+            nets.layers.push(net.min_layer);
+            nets.pins.push(pins);
+
+            for &[srow, scol, slay, erow, ecol, elay] in net.routes.iter() {
+                let route = Route::raw(srow, scol, slay, erow, ecol, elay);
+                routes.insert(id, route, &self.layers);
+            }
+        }
+        self.merge_sections(nets, routes, &mut report)?;
+        self.derive();
+
+        self.cell_areas = vec![None; self.cells.len()];
+        for (idx, area) in design.voltage_areas.iter().enumerate() {
+            let mut cells = Vec::with_capacity(area.cells.len());
+            for &cell in area.cells.iter() {
+                // the first area is kept
+                if self.cell_areas[cell].is_some() {
+                    let at = ("voltage area", idx + 1);
+                    let err = anyhow!("Cell {} is in several voltage areas", Cell::from_num(cell)?);
+                    self.tolerate(&mut report, &at, err)?;
+                    continue;
+                }
+                self.cell_areas[cell] = Some(idx);
+                cells.push(cell);
+            }
+            self.voltage_areas.push(VoltageArea {
+                name: area.name.clone(),
+                grids: area
+                    .grids
+                    .iter()
+                    .map(|&(row, col)| Pair(row, col))
+                    .collect(),
+                cells,
+            });
+        }
+
+        self.finish_report(&mut report);
+        report.elapsed = start.elapsed();
+        Ok(report)
+    }
+
+    /// Reads a design through a binary cache next to the file, named after it with `.bin` added,
+    /// see `cache::read_cache`.
+    /// The cache is used if it was written from a file of the same size and modification time,
+    /// see `utilities::stamp`, otherwise the file is read and the cache written.
+    /// The cache holds the design as read, so warnings are only reported when the file is.
+    /// Returns a report of what has been read.
+    pub fn read_cached(&mut self, filename: &str) -> Result<Report> {
+        let cache = format!("{}.bin", filename);
+        let stamp = utilities::stamp(filename)?;
+        if let Ok((cached, design)) = cache::read_cache(&cache) {
+            // a corrupted cache is read again from the file
+            if cached == stamp && design.check().is_ok() {
+                return self.read_design(&design);
+            }
+        }
+
+        let report = self.read_file(filename)?;
+        if let Err(err) = cache::write_cache(&cache, &Design::from_chip(self), stamp) {
+            eprintln!("Cannot write the cache {}: {}", cache, err);
+        }
+        Ok(report)
+    }
+
+    /// Reads a file and patches merged into it, see `Design::merge`.
+    /// Returns a report of what has been read, once merged.
+    pub fn read_patched(&mut self, filename: &str, patches: &[&str]) -> Result<Report> {
+        let read = |filename: &str| -> Result<Design> {
+            let mut chip = Chip {
+                lenient: self.lenient,
+                ..Chip::default()
+            };
+            chip.read_file(filename)?;
+            Ok(Design::from_chip(&chip))
+        };
+
+        let mut design = read(filename)?;
+        for &patch in patches.iter() {
+            design
+                .merge(&read(patch)?)
+                .map_err(|err| anyhow!("In {}: {}", patch, err))?;
+        }
+        self.read_str(&design.to_input()?)
+    }
+
+    /// Checks that the design is read back the same from the input it is written as,
+    /// to catch anything the parser or the writer drops.
+    /// Fails listing the differences, see `Design::differences`.
+    pub fn check_round_trip(&self) -> Result<()> {
+        let mut design = Design::from_chip(self);
+        for net in design.nets.iter_mut() {
+            net.provenance.clear();
+        }
+
+        let mut reread = Chip {
+            lenient: self.lenient,
+            ..Chip::default()
+        };
+        reread.read_str(&design.to_input()?)?;
+
+        let differences = design.differences(&Design::from_chip(&reread));
+        if !differences.is_empty() {
+            return Err(anyhow!(
+                "The design is not read back the same:\n{}",
+                differences.join("\n")
+            ));
+        }
+        Ok(())
+    }
+
+    /// A hash of the design as it currently is, see `Design::fingerprint`.
+    /// Where route segments come from is not part of the design.
+    pub fn fingerprint(&self) -> u64 {
+        let mut design = Design::from_chip(self);
+        for net in design.nets.iter_mut() {
+            net.provenance.clear();
+        }
+        design.fingerprint()
+    }
+
+    /// Writes the design to a JSON file, see `Design`.
+    pub fn write_json(&self, filename: &str) -> Result<()> {
+        Design::from_chip(self).write_file(filename)
+    }
+
+    /// Reads a design in Bookshelf files, listed in a `.aux` file, into memory,
+    /// see `bookshelf::translate_bookshelf`.
+    /// Returns a report of what has been read, and the names of the design.
+    pub fn read_bookshelf(&mut self, aux: &str) -> Result<(Report, BookshelfNames)> {
+        let (content, names) = bookshelf::read_aux(aux)?;
+        Ok((self.read_str(&content)?, names))
+    }
+
+    /// Reads an ISPD global routing benchmark into memory, see `ispd::translate_ispd`.
+    /// Returns a report of what has been read, and the names of the nets.
+    pub fn read_ispd(&mut self, filename: &str) -> Result<(Report, Vec<String>)> {
+        let (content, names) = ispd::translate_ispd(&fs::read_to_string(filename)?)?;
+        Ok((self.read_str(&content)?, names))
     }
 
     /// Reads the content of a string into memory
     /// This function reads the input string and stores it into `self`
-    pub fn read_str(&mut self, content: &str) -> Result<()> {
-        use utilities::{check_eq, parse_numeric, parse_string};
+    /// Returns a report of what has been read.
+    pub fn read_str(&mut self, content: &str) -> Result<Report> {
+        self.read_tokens(&mut Tokens::new(content))
+    }
+
+    /// Reads the content of a file like `read_file`, showing the line of the first error,
+    /// for debugging inputs. The file is held in memory as a whole.
+    pub fn read_traced(&mut self, filename: &str) -> Result<Report> {
+        let mut content = String::new();
+        utilities::open(filename)?.read_to_string(&mut content)?;
 
-        let content = &mut content.split_whitespace();
+        let start = Instant::now();
+        let mut report = Report::default();
+        let mut at = ("MaxCellMove", 0);
+        let tokens = &mut Lookahead::new(Traced::new(&content));
+
+        self.parse_tokens(tokens, &mut report, &mut at)
+            .map_err(|err| {
+                let line = tokens.line();
+                let text = tokens.get_ref().text(line);
+                anyhow!("{}\n{:>6} | {}", locate(err, line, at), line, text)
+            })?;
+
+        self.finish_report(&mut report);
+        report.elapsed = start.elapsed();
+
+        Ok(report)
+    }
+
+    /// Reads tokens into memory and stores them into `self`.
+    /// Returns a report of what has been read.
+    fn read_tokens<T, S>(&mut self, tokens: &mut T) -> Result<Report>
+    where
+        T: Tokenizer<Item = S>,
+        S: Deref<Target = str>,
+    {
+        let start = Instant::now();
+        let mut report = Report::default();
+
+        // the record being parsed and its index (starting from 1), for error messages
+        let mut at = ("MaxCellMove", 0);
+        let tokens = &mut Lookahead::new(tokens);
+
+        self.parse_tokens(tokens, &mut report, &mut at)
+            .map_err(|err| locate(err, tokens.line(), at))?;
+
+        self.finish_report(&mut report);
+        report.elapsed = start.elapsed();
+
+        Ok(report)
+    }
+
+    /// Counts what has been read into a report, and sets the baseline.
+    /// Provenance tracking and inflation kept by `release` start over on the design read.
+    fn finish_report(&mut self, report: &mut Report) {
+        if self.provenance.is_some() {
+            self.track_provenance();
+        }
+        if let Some(predictor) = self.predictor.take() {
+            self.inflate(predictor);
+        }
+
+        report.num_layers = self.layers.len();
+        report.num_mastercells = self.mastercells.len();
+        report.num_cells = self.cells.len();
+        report.num_nets = self.nets.len();
+        report.num_routes = self.nets.iter().map(Net::num_routes).sum();
+        self.baseline = self.wirelength();
+        report.baseline = self.baseline;
+    }
+
+    /// Parses tokens into `self`, keeping track in `at` of the record being parsed.
+    fn parse_tokens<T, S>(
+        &mut self,
+        content: &mut Lookahead<T>,
+        report: &mut Report,
+        at: &mut (&'static str, usize),
+    ) -> Result<()>
+    where
+        T: Tokenizer<Item = S>,
+        S: Deref<Target = str>,
+    {
+        self.parse_head(content, report, at)?;
+        self.parse_mastercells(content, report, at)?;
+        self.cells = self.parse_cells(content, report, at)?;
+        let nets = self.parse_nets(content, at, true)?;
+        let routes = self.parse_routes(content, report, at, nets.layers.len())?;
+        self.merge_sections(nets, routes, report)?;
+        self.derive();
+        self.cell_areas = vec![None; self.cells.len()];
+        self.parse_areas(content, report, at)
+    }
+
+    /// Parses the head of an input into `self`: everything before the mastercells.
+    fn parse_head<T, S>(
+        &mut self,
+        content: &mut Lookahead<T>,
+        report: &mut Report,
+        at: &mut (&'static str, usize),
+    ) -> Result<()>
+    where
+        T: Tokenizer<Item = S>,
+        S: Deref<Target = str>,
+    {
+        use utilities::{check_eq, parse_numeric, parse_string};
 
         // MaxCellMove <maxMoveCount>
-        let keyword = parse_string(content)?;
+        let keyword: &str = &parse_string(content)?;
         check_eq(keyword, "MaxCellMove")?;
         let max_move: usize = parse_numeric(content)?;
         self.max_move = max_move;
 
         // GGridBoundaryIdx <rowBeginIdx> <colBeginIdx> <rowEndIdx> <colEndIdx>
-        let keyword = parse_string(content)?;
+        *at = ("GGridBoundaryIdx", 0);
+        let keyword: &str = &parse_string(content)?;
         check_eq(keyword, "GGridBoundaryIdx")?;
 
         let row_beg: usize = parse_numeric(content)?;
@@ -75,48 +799,63 @@ impl Chip {
         self.dim = Pair(num_rows, num_cols);
 
         // NumLayer <LayerCount>
-        let keyword = parse_string(content)?;
+        *at = ("NumLayer", 0);
+        let keyword: &str = &parse_string(content)?;
         check_eq(keyword, "NumLayer")?;
 
         let num_layers: usize = parse_numeric(content)?;
 
         // Lay <layerName> <Idx> <RoutingDirection> <defaultSupplyOfOneGGrid>
         for idx in 0..num_layers {
-            let keyword = parse_string(content)?;
+            *at = ("Lay", idx + 1);
+            let keyword: &str = &parse_string(content)?;
             check_eq(keyword, "Lay")?;
 
-            let name = parse_string(content)?;
+            let name: &str = &parse_string(content)?;
             let layer_id: usize = parse_numeric(content)?;
             let id: usize = Layer::from_str(name)?;
 
-            check_eq(layer_id, id + 1)?;
+            if let Err(err) = check_eq(layer_id, id + 1) {
+                self.tolerate(report, at, err)?;
+            }
 
-            let dir_str = parse_string(content)?;
-            let direction = if dir_str == "H" {
-                Direction::Horizontal
-            } else {
-                check_eq(dir_str, "V")?;
-                Direction::Vertical
+            let dir_str: &str = &parse_string(content)?;
+            let direction = match dir_str {
+                "H" => Direction::Horizontal,
+                "V" => Direction::Vertical,
+                "h" | "v" => {
+                    self.tolerate(report, at, anyhow!("Direction {} is lowercase", dir_str))?;
+                    if dir_str == "h" {
+                        Direction::Horizontal
+                    } else {
+                        Direction::Vertical
+                    }
+                }
+                _ => return Err(anyhow!("Expected \"H\" or \"V\", found {:?}", dir_str)),
             };
 
             let supply: usize = parse_numeric(content)?;
             let grid_size = self.dim.size();
-            let capacity = vec![supply; grid_size];
+            let capacity = self.recycle_grids(grid_size, supply);
             let dim = self.dim;
 
             self.layers.push(Layer {
                 id: idx,
                 direction,
                 dim,
+                supply,
+                adjustments: Vec::new(),
                 capacity,
             });
         }
 
         // NumNonDefaultSupplyGGrid <nonDefaultSupplyGGridCount>
-        let keyword = parse_string(content)?;
+        *at = ("NumNonDefaultSupplyGGrid", 0);
+        let keyword: &str = &parse_string(content)?;
         check_eq(keyword, "NumNonDefaultSupplyGGrid")?;
         let num_non_default: usize = parse_numeric(content)?;
-        for _ in 0..num_non_default {
+        for idx in 0..num_non_default {
+            *at = ("non default supply", idx + 1);
             // <rowIdx> <colIdx> <LayIdx> <incrOrDecrValue>
             let r: usize = parse_numeric(content)?;
             let c: usize = parse_numeric(content)?;
@@ -126,31 +865,58 @@ impl Chip {
             // - 1 is required in converting from name to id.
             // It is only written explicitly here  because other parts of the code
             // do it implicityly in the `FactoryID::from_str` trait method.
-            let (r, c, l) = (r - 1, c - 1, l - 1);
-
-            let dim = self.dim;
-            let layer_mut = self.get_layer_mut(l).expect("Layer index out of bounds");
+            let Point(r, c, l) = Point(r, c, l).internal()?;
 
-            debug_assert_eq!(dim, layer_mut.dim);
+            if let Err(err) = self.check_bounds(Point(r, c, l)) {
+                self.tolerate(report, at, err)?;
+                continue;
+            }
+            let supply = *self.layers[l]
+                .get_capacity(r, c)
+                .expect("Cell index out of bounds") as isize
+                + val;
+            if supply < 0 {
+                self.tolerate(report, at, anyhow!("Supply {} is negative", supply))?;
+            }
 
+            let layer_mut = self.get_layer_mut(l).expect("Layer index out of bounds");
+            layer_mut.adjustments.push((Pair(r, c), val));
             let cell_capacity = layer_mut
                 .get_capacity_mut(r, c)
                 .expect("Cell index out of bounds");
-
-            *cell_capacity = (*cell_capacity as isize + val) as usize;
+            *cell_capacity = cmp::max(supply, 0) as usize;
         }
 
+        Ok(())
+    }
+
+    /// Parses the mastercells of an input and the extra demand rules between them into `self`,
+    /// once its head is in.
+    fn parse_mastercells<T, S>(
+        &mut self,
+        content: &mut Lookahead<T>,
+        report: &mut Report,
+        at: &mut (&'static str, usize),
+    ) -> Result<()>
+    where
+        T: Tokenizer<Item = S>,
+        S: Deref<Target = str>,
+    {
+        use utilities::{check_eq, parse_numeric, parse_string};
+
         // NumMasterCell <masterCellCount>
-        let keyword = parse_string(content)?;
+        *at = ("NumMasterCell", 0);
+        let keyword: &str = &parse_string(content)?;
         check_eq(keyword, "NumMasterCell")?;
         let num_master_cell: usize = parse_numeric(content)?;
         // MasterCell <masterCellName> <pinCount> <blockageCount>
 
         for idx in 0..num_master_cell {
-            let keyword = parse_string(content)?;
+            *at = ("MasterCell", idx + 1);
+            let keyword: &str = &parse_string(content)?;
             check_eq(keyword, "MasterCell")?;
 
-            let name = parse_string(content)?;
+            let name: &str = &parse_string(content)?;
             check_eq(MasterCell::from_str(name)?, idx)?;
 
             let num_pins: usize = parse_numeric(content)?;
@@ -159,35 +925,37 @@ impl Chip {
             let mut pins = HashSet::with_capacity(num_pins);
             // Pin <pinName> <pinLayer>
             for _ in 0..num_pins {
-                let keyword = parse_string(content)?;
+                let keyword: &str = &parse_string(content)?;
                 check_eq(keyword, "Pin")?;
 
-                let pin_name = parse_string(content)?;
-                let pin_layer = parse_string(content)?;
+                let pin_name: &str = &parse_string(content)?;
+                let pin_layer: &str = &parse_string(content)?;
 
                 let pin_id = MasterPin::from_str(pin_name)?;
-                let layer_id = Layer::from_str(pin_layer)?;
+                let layer_id = self.parse_layer(pin_layer)?;
 
                 let avail = pins.insert(MasterPin {
                     id: pin_id,
                     layer: layer_id,
                 });
 
-                debug_assert!(avail);
+                if !avail {
+                    self.tolerate(report, at, anyhow!("Duplicate pin {}", pin_name))?;
+                }
             }
 
             let mut blkgs = HashSet::with_capacity(num_blkgs);
 
             // Blkg <blockageName> <blockageLayer> <demand>
             for _ in 0..num_blkgs {
-                let keyword = parse_string(content)?;
+                let keyword: &str = &parse_string(content)?;
                 check_eq(keyword, "Blkg")?;
 
-                let blkg_name = parse_string(content)?;
-                let blkg_layer = parse_string(content)?;
+                let blkg_name: &str = &parse_string(content)?;
+                let blkg_layer: &str = &parse_string(content)?;
                 let blkg_demand: usize = parse_numeric(content)?;
 
-                let layer_id = Layer::from_str(blkg_layer)?;
+                let layer_id = self.parse_layer(blkg_layer)?;
                 let blkg_id = Blockage::from_str(blkg_name)?;
 
                 let avail = blkgs.insert(Blockage {
@@ -196,7 +964,9 @@ impl Chip {
                     demand: blkg_demand,
                 });
 
-                debug_assert!(avail);
+                if !avail {
+                    self.tolerate(report, at, anyhow!("Duplicate blockage {}", blkg_name))?;
+                }
             }
 
             self.mastercells.push(MasterCell {
@@ -207,18 +977,21 @@ impl Chip {
         }
 
         // NumNeighborCellExtraDemand <count>
-        let keyword = parse_string(content)?;
+        *at = ("NumNeighborCellExtraDemand", 0);
+        let keyword: &str = &parse_string(content)?;
         check_eq(keyword, "NumNeighborCellExtraDemand")?;
         let extra_count: usize = parse_numeric(content)?;
 
         self.conflicts.reserve(2 * extra_count);
 
         let mut is_same: usize = 0;
+        let mut duplicate_rules: usize = 0;
 
         // sameGGrid <masterCellName1> <masterCellName2> <layerName> <demand>
         // adjHGGrid <masterCellName1> <masterCellName2> <layerName> <demand>
-        for _ in 0..extra_count {
-            let grid_type_str = parse_string(content)?;
+        for idx in 0..extra_count {
+            *at = ("extra demand", idx + 1);
+            let grid_type_str: &str = &parse_string(content)?;
             let adj_grid = if grid_type_str == "adjHGGrid" {
                 ConflictType::AdjHGGrid
             } else {
@@ -226,18 +999,19 @@ impl Chip {
                 ConflictType::SameGGrid
             };
 
-            let master_cell_1 = parse_string(content)?;
-            let master_cell_2 = parse_string(content)?;
+            let master_cell_1: &str = &parse_string(content)?;
+            let master_cell_2: &str = &parse_string(content)?;
 
-            let layer_name = parse_string(content)?;
+            let layer_name: &str = &parse_string(content)?;
             let layer_demand: usize = parse_numeric(content)?;
 
-            let mc_id_1 = MasterCell::from_str(master_cell_1)?;
-            let mc_id_2 = MasterCell::from_str(master_cell_2)?;
+            let mc_id_1 = self.parse_mastercell(master_cell_1)?;
+            let mc_id_2 = self.parse_mastercell(master_cell_2)?;
 
-            let layer_id = Layer::from_str(layer_name)?;
+            let layer_id = self.parse_layer(layer_name)?;
 
-            self.conflicts
+            let inserted = self
+                .conflicts
                 .entry(mc_id_1)
                 .or_insert_with(HashSet::new)
                 .insert(Conflict {
@@ -247,7 +1021,9 @@ impl Chip {
                     demand: layer_demand,
                 });
 
-            if mc_id_1 == mc_id_2 {
+            if !inserted {
+                duplicate_rules += 1;
+            } else if mc_id_1 == mc_id_2 {
                 is_same += 1;
             } else {
                 self.conflicts
@@ -269,39 +1045,77 @@ impl Chip {
             .map(HashSet::len)
             .sum();
 
-        debug_assert_eq!(num_elements + is_same, 2 * extra_count);
+        debug_assert_eq!(num_elements + is_same, 2 * (extra_count - duplicate_rules));
+
+        if duplicate_rules > 0 {
+            report.warn(format!(
+                "Ignored {} duplicate extra demand rules",
+                duplicate_rules
+            ));
+        }
+
+        Ok(())
+    }
+
+    /// Parses the cells of an input, once its head is in `self`.
+    fn parse_cells<T, S>(
+        &self,
+        content: &mut Lookahead<T>,
+        report: &mut Report,
+        at: &mut (&'static str, usize),
+    ) -> Result<Vec<Cell>>
+    where
+        T: Tokenizer<Item = S>,
+        S: Deref<Target = str>,
+    {
+        use utilities::{check_eq, parse_numeric, parse_string};
 
         // NumCellInst <cellInstCount>
-        let keyword = parse_string(content)?;
+        *at = ("NumCellInst", 0);
+        let keyword: &str = &parse_string(content)?;
         check_eq(keyword, "NumCellInst")?;
         let cell_count: usize = parse_numeric(content)?;
 
-        let mut pin_cell = Vec::new();
+        let mut cells = Vec::with_capacity(cell_count);
 
         let mut pin_count = 0;
         // CellInst <instName> <masterCellName> <gGridRowIdx> <gGridColIdx> <movableCstr>
         for idx in 0..cell_count {
-            let keyword = parse_string(content)?;
+            *at = ("CellInst", idx + 1);
+            let keyword: &str = &parse_string(content)?;
             check_eq(keyword, "CellInst")?;
 
-            let cell_name = parse_string(content)?;
+            let cell_name: &str = &parse_string(content)?;
             let id = Cell::from_str(cell_name)?;
             check_eq(id, idx)?;
 
-            let master_cell_name = parse_string(content)?;
+            let master_cell_name: &str = &parse_string(content)?;
 
-            let mc_id = MasterCell::from_str(master_cell_name)?;
+            let mc_id = self.parse_mastercell(master_cell_name)?;
 
             let row: usize = parse_numeric(content)?;
             let col: usize = parse_numeric(content)?;
-            let position = Pair(row, col);
-
-            let move_str = parse_string(content)?;
-            let movable = if move_str == "Movable" {
-                CellType::Movable
-            } else {
-                check_eq(move_str, "Fixed")?;
-                CellType::Fixed
+            let position = Pair(row, col).internal()?;
+            self.check_bounds(position.with(0))?;
+
+            let move_str: &str = &parse_string(content)?;
+            let movable = match move_str {
+                "Movable" => CellType::Movable,
+                "Fixed" => CellType::Fixed,
+                _ if move_str.eq_ignore_ascii_case("Movable") => {
+                    self.tolerate(report, at, anyhow!("{} is miscapitalized", move_str))?;
+                    CellType::Movable
+                }
+                _ if move_str.eq_ignore_ascii_case("Fixed") => {
+                    self.tolerate(report, at, anyhow!("{} is miscapitalized", move_str))?;
+                    CellType::Fixed
+                }
+                _ => {
+                    return Err(anyhow!(
+                        "Expected \"Movable\" or \"Fixed\", found {:?}",
+                        move_str
+                    ))
+                }
             };
 
             let mc = self.mastercells.get(mc_id).expect("MasterCell not found");
@@ -309,10 +1123,9 @@ impl Chip {
             let pins: Vec<_> = (pin_count..pin_count + length).collect();
             pin_count += length;
 
-            pin_cell.push(pin_count);
-
-            self.cells.push(Cell {
+            cells.push(Cell {
                 id,
+                mastercell: mc_id,
                 movable,
                 moved: false,
                 position,
@@ -320,37 +1133,57 @@ impl Chip {
             });
         }
 
+        Ok(cells)
+    }
+
+    /// Parses the nets of an input, once its head is in `self`,
+    /// checking their pins against the cells in `self` if `check_pins`.
+    fn parse_nets<T, S>(
+        &self,
+        content: &mut Lookahead<T>,
+        at: &mut (&'static str, usize),
+        check_pins: bool,
+    ) -> Result<NetsSection>
+    where
+        T: Tokenizer<Item = S>,
+        S: Deref<Target = str>,
+    {
+        use utilities::{check_eq, parse_numeric, parse_string};
+
         // NumNets <netCount>
-        let keyword = parse_string(content)?;
+        *at = ("NumNets", 0);
+        let keyword: &str = &parse_string(content)?;
         check_eq(keyword, "NumNets")?;
         let net_count: usize = parse_numeric(content)?;
 
         let mut net_layers = Vec::with_capacity(net_count);
         let mut net_pins = Vec::with_capacity(net_count);
+        let mut duplicate_pins: usize = 0;
         // Net <netName> <numPins> <minRoutingLayConstraint>
         for idx in 0..net_count {
-            let keyword = parse_string(content)?;
+            *at = ("Net", idx + 1);
+            let keyword: &str = &parse_string(content)?;
             check_eq(keyword, "Net")?;
 
-            let net_name = parse_string(content)?;
+            let net_name: &str = &parse_string(content)?;
             check_eq(Net::from_str(net_name)?, idx)?;
 
             let num_pins: usize = parse_numeric(content)?;
-            let layer = parse_string(content)?;
+            let layer: &str = &parse_string(content)?;
 
             let min_layer = if layer == "NoCstr" {
                 0
             } else {
-                Layer::from_str(layer)?
+                self.parse_layer(layer)?
             };
 
             let mut pins = Vec::with_capacity(num_pins);
             // Pin <instName>/<masterPinName>
             for _ in 0..num_pins {
-                let keyword = parse_string(content)?;
+                let keyword: &str = &parse_string(content)?;
                 check_eq(keyword, "Pin")?;
 
-                let next = parse_string(content)?;
+                let next: &str = &parse_string(content)?;
                 let pin_info = &mut next.split('/');
                 let cell_name = parse_string(pin_info)?;
                 let pin_name = parse_string(pin_info)?;
@@ -359,118 +1192,1671 @@ impl Chip {
                 let cell_id = Cell::from_str(cell_name)?;
                 let pin_id = MasterPin::from_str(pin_name)?;
 
-                pins.push(
-                    *self
-                        .cells
-                        .get(cell_id)
-                        .expect("Cell not found")
-                        .pins
-                        .get(pin_id)
-                        .expect("Pin not found"),
-                );
+                if check_pins {
+                    self.check_pin(cell_id, pin_id)?;
+                }
+
+                if pins.contains(&(cell_id, pin_id)) {
+                    duplicate_pins += 1;
+                } else {
+                    pins.push((cell_id, pin_id));
+                }
             }
 
             net_layers.push(min_layer);
             net_pins.push(pins);
         }
+
+        Ok(NetsSection {
+            layers: net_layers,
+            pins: net_pins,
+            duplicates: duplicate_pins,
+        })
+    }
+
+    /// Parses the routes of an input of `net_count` nets, once its head is in `self`.
+    fn parse_routes<T, S>(
+        &self,
+        content: &mut Lookahead<T>,
+        report: &mut Report,
+        at: &mut (&'static str, usize),
+        net_count: usize,
+    ) -> Result<RoutesSection>
+    where
+        T: Tokenizer<Item = S>,
+        S: Deref<Target = str>,
+    {
+        use utilities::{check_eq, parse_numeric, parse_string};
+
         // NumRoutes <routeSegmentCount>
-        let keyword = parse_string(content)?;
+        *at = ("NumRoutes", 0);
+        let keyword: &str = &parse_string(content)?;
         check_eq(keyword, "NumRoutes")?;
         let num_segments: usize = parse_numeric(content)?;
 
-        let mut routes = vec![HashSet::new(); net_count];
+        let mut routes = RoutesSection::new(net_count);
 
         // <sRowIdx> <sColIdx> <sLayIdx> <eRowIdx> <eColIdx> <eLayIdx> <netName>
-        for _ in 0..num_segments {
+        for idx in 0..num_segments {
+            *at = ("route", idx + 1);
             let srow: usize = parse_numeric(content)?;
             let scol: usize = parse_numeric(content)?;
             let slay: usize = parse_numeric(content)?;
             let erow: usize = parse_numeric(content)?;
             let ecol: usize = parse_numeric(content)?;
             let elay: usize = parse_numeric(content)?;
-            let net_name = parse_string(content)?;
+            let net_name: &str = &parse_string(content)?;
             let net_id = Net::from_str(net_name)?;
 
-            let route = Route::raw(srow, scol, slay, erow, ecol, elay);
-            routes
-                .get_mut(net_id)
-                .expect("Index out of bounds")
-                .insert(route);
+            let route = Route::raw(srow, scol, slay, erow, ecol, elay).internal()?;
+            let bounds = self
+                .check_bounds(route.source())
+                .and_then(|_| self.check_bounds(route.target()));
+            if let Err(err) = bounds {
+                self.tolerate(report, at, err)?;
+                continue;
+            }
+            if net_id >= net_count {
+                return Err(anyhow!("Net {} not found", net_name));
+            }
+            routes.insert(net_id, route, &self.layers);
         }
 
-        check_eq(routes.len(), net_count)?;
+        Ok(routes)
+    }
 
-        // TODO: self.nets
+    /// Builds the nets of `self` from the sections parsed.
+    fn merge_sections(
+        &mut self,
+        nets: NetsSection,
+        routes: RoutesSection,
+        report: &mut Report,
+    ) -> Result<()> {
+        use utilities::check_eq;
+
+        let net_count = nets.layers.len();
+        if nets.duplicates > 0 {
+            report.warn(format!(
+                "Ignored {} duplicate pins of nets",
+                nets.duplicates
+            ));
+        }
+        if routes.duplicates > 0 {
+            report.warn(format!("Ignored {} duplicate routes", routes.duplicates));
+        }
+        if routes.diagonals > 0 {
+            report.warn(format!("Split {} diagonal routes", routes.diagonals));
+        }
+
+        check_eq(routes.routes.len(), net_count)?;
+
+        self.nets = nets
+            .layers
+            .into_iter()
+            .zip(nets.pins)
+            .zip(routes.routes)
+            .enumerate()
+            .map(|(id, ((min_layer, pins), routes))| Net {
+                id,
+                min_layer,
+                pins,
+                routes,
+                packed: PackedRoutes::default(),
+                initial: PackedRoutes::default(),
+                dirty: true,
+            })
+            .collect();
+
+        let points: usize = self.nets.iter_mut().map(Net::remove_points).sum();
+        if points > 0 {
+            report.warn(format!("Removed {} zero-length routes", points));
+        }
+        for net in self.nets.iter_mut() {
+            net.merge_segments();
+            net.initial = PackedRoutes::pack(&net.routes);
+        }
 
-        // parsing ends here
-        check_eq(content.next(), None)?;
         Ok(())
     }
 
-    fn duration(args: &Args) -> Duration {
-        use crate::consts::*;
+    /// Derives from the cells and the nets in `self` where they are and how they are connected,
+    /// and the demand of every grid.
+    fn derive(&mut self) {
+        let net_count = self.nets.len();
+        self.cell_nets = recycle_lists(mem::take(&mut self.spare.cell_nets), self.cells.len());
+        for net in self.nets.iter() {
+            for &(cell, _) in net.pins.iter() {
+                self.cell_nets[cell].push(net.id);
+            }
+        }
+        // a cell may have pins of a net anywhere among its pins
+        for nets in self.cell_nets.iter_mut() {
+            nets.sort_unstable();
+            nets.dedup();
+        }
 
-        // By default duration is equal to 1 hr
-        match args {
-            Args {
-                sec: Some(sec),
-                min: None,
-                hr: None,
-                ..
-            } => Duration::from_secs(*sec as u64),
-            Args {
-                sec: None,
-                min: Some(min),
-                hr: None,
-                ..
-            } => Duration::from_secs(SECS_PER_MIN * *min as u64),
-            Args {
-                sec: None,
-                min: None,
-                hr: Some(hr),
-                ..
-            } => Duration::from_secs(SECS_PER_HR * *hr as u64),
-            _ => Duration::from_secs(SECS_PER_HR),
+        self.pin_refs = (0..net_count).map(|id| self.resolve_pins(id)).collect();
+        self.bounds = (0..net_count).map(|id| self.compute_bound(id)).collect();
+
+        self.cells_at = recycle_lists(mem::take(&mut self.spare.cells_at), self.dim.size());
+        for cell in self.cells.iter() {
+            let Pair(row, col) = cell.position;
+            self.cells_at[row * self.dim.y() + col].push(cell.id);
         }
+        let mut demand = self.recycle_grids(self.layers.len() * self.dim.size(), 0);
+        self.add_demand(&mut demand);
+        self.demand = demand;
     }
 
-    fn check_time(start: Instant, duration: Duration) -> Result<()> {
-        let now = Instant::now();
-        if now - start >= duration {
-            Ok(())
-        } else {
-            Err(anyhow!("Time's up!"))
+    /// Parses what is left of an input after the routes: voltage areas, if any.
+    fn parse_areas<T, S>(
+        &mut self,
+        content: &mut Lookahead<T>,
+        report: &mut Report,
+        at: &mut (&'static str, usize),
+    ) -> Result<()>
+    where
+        T: Tokenizer<Item = S>,
+        S: Deref<Target = str>,
+    {
+        use utilities::{check_eq, parse_numeric, parse_string};
+
+        // NumVoltageAreas <voltageAreaCount>, only in some inputs
+        *at = ("NumVoltageAreas", 0);
+        let has_areas = content
+            .peek()
+            .map_or(false, |keyword| &**keyword == "NumVoltageAreas");
+        if has_areas {
+            content.next();
+            let area_count: usize = parse_numeric(content)?;
+
+            for idx in 0..area_count {
+                *at = ("voltage area", idx + 1);
+
+                // Name <voltageAreaName>
+                let keyword: &str = &parse_string(content)?;
+                check_eq(keyword, "Name")?;
+                let name = parse_string(content)?.to_string();
+
+                // GGrids <gGridCount>
+                let keyword: &str = &parse_string(content)?;
+                check_eq(keyword, "GGrids")?;
+                let grid_count: usize = parse_numeric(content)?;
+
+                // <rowIdx> <colIdx>
+                let mut grids = HashSet::with_capacity(grid_count);
+                for _ in 0..grid_count {
+                    let row: usize = parse_numeric(content)?;
+                    let col: usize = parse_numeric(content)?;
+                    let grid = Pair(row, col).internal()?;
+                    self.check_bounds(grid.with(0))?;
+                    grids.insert(grid);
+                }
+
+                // Instances <instanceCount>
+                let keyword: &str = &parse_string(content)?;
+                check_eq(keyword, "Instances")?;
+                let cell_num: usize = parse_numeric(content)?;
+
+                // <instName>
+                let mut cells = Vec::with_capacity(cell_num);
+                for _ in 0..cell_num {
+                    let cell_name: &str = &parse_string(content)?;
+                    let cell = Cell::from_str(cell_name)?;
+                    match self.cell_areas.get(cell) {
+                        Some(None) => {}
+                        Some(Some(_)) => {
+                            // the first area is kept
+                            let err = anyhow!("Cell {} is in several voltage areas", cell_name);
+                            self.tolerate(report, at, err)?;
+                            continue;
+                        }
+                        None => return Err(anyhow!("Cell {} not found", cell_name)),
+                    }
+
+                    self.cell_areas[cell] = Some(idx);
+                    cells.push(cell);
+                }
+
+                self.voltage_areas.push(VoltageArea { name, grids, cells });
+            }
         }
-    }
 
-    /// Runs all operations.
-    pub fn run(&mut self, args: &Args) -> Result<()> {
-        let start = Instant::now();
-        let duration = Self::duration(args);
+        // parsing ends here
+        *at = ("end of input", 0);
+        if let Some(token) = content.next() {
+            let err = check_eq(Some(&*token), None).expect_err("Token matched");
+            self.tolerate(report, at, err)?;
+            content.for_each(drop);
+        }
 
-        match args {
-            Args { cell: true, .. } => loop {
-                Self::check_time(start, duration)?;
-                todo!()
-            },
-            Args { net: true, .. } => loop {
-                Self::check_time(start, duration)?;
-                todo!()
-            },
-            _ => Err(anyhow!("Do nothing.")),
+        if cfg!(debug_assertions) {
+            self.audit_indices()?;
         }
+
+        Ok(())
     }
 
-    /// Write the content stored in memory to a file
-    pub fn write_file(&mut self, filename: &str) -> Result<()> {
-        fs::write(filename, format!("{}\n", self))?;
+    /// Records a recoverable problem of the input as a warning if reading leniently,
+    /// failing otherwise or once there are more warnings than tolerated.
+    fn tolerate(&self, report: &mut Report, at: &(&str, usize), err: Error) -> Result<()> {
+        let max = match self.lenient {
+            Some(max) => max,
+            None => return Err(err),
+        };
 
+        match *at {
+            (record, 0) => report.warn(format!("In {}: {}", record, err)),
+            (record, idx) => report.warn(format!("In {} #{}: {}", record, idx, err)),
+        }
+        if report.warnings.len() > max {
+            return Err(anyhow!("More than {} warnings, the last one: {}", max, err));
+        }
         Ok(())
     }
 
-    /// Returns a reference to a layer
-    pub fn get_layer(&self, idx: usize) -> Option<&Layer> {
-        self.layers.get(idx)
+    /// Fails if more warnings than tolerated have been gathered,
+    /// for sections read apart which tolerate as many each.
+    fn check_tolerated(&self, report: &Report) -> Result<()> {
+        match (self.lenient, report.warnings.last()) {
+            (Some(max), Some(last)) if report.warnings.len() > max => Err(anyhow!(
+                "More than {} warnings, the last one: {}",
+                max,
+                last
+            )),
+            _ => Ok(()),
+        }
+    }
+
+    /// Checks that a pin of a cell that has been read exists.
+    fn check_pin(&self, cell: usize, pin: usize) -> Result<()> {
+        let found = match self.cells.get(cell) {
+            Some(found) => found,
+            None => return Err(anyhow!("Cell {} not found", Cell::from_num(cell)?)),
+        };
+        if pin >= found.pins.len() {
+            return Err(anyhow!(
+                "Pin {}/{} not found",
+                Cell::from_num(cell)?,
+                MasterPin::from_num(pin)?
+            ));
+        }
+        Ok(())
+    }
+
+    /// Parses the name of a layer that has been read.
+    fn parse_layer(&self, name: &str) -> Result<usize> {
+        let id = Layer::from_str(name)?;
+        if id >= self.layers.len() {
+            return Err(anyhow!("Layer {} not found", name));
+        }
+        Ok(id)
+    }
+
+    /// Parses the name of a mastercell that has been read.
+    fn parse_mastercell(&self, name: &str) -> Result<usize> {
+        let id = MasterCell::from_str(name)?;
+        if id >= self.mastercells.len() {
+            return Err(anyhow!("MasterCell {} not found", name));
+        }
+        Ok(id)
+    }
+
+    /// Checks that a grid is within the chip.
+    pub fn check_bounds(&self, point: Point<usize>) -> Result<()> {
+        let Pair(rows, cols) = self.dim;
+        if point.row() >= rows || point.col() >= cols || point.lay() >= self.layers.len() {
+            return Err(anyhow!("Grid {} is out of bounds", point.external()));
+        }
+        Ok(())
+    }
+
+    /// Checks that every stored index starts from 0 and is within bounds.
+    /// Meant to be run in debug builds, since indices in files start from 1.
+    pub fn audit_indices(&self) -> Result<()> {
+        let Pair(rows, cols) = self.dim;
+        let num_layers = self.layers.len();
+
+        let in_grid = |pair: Pair<usize>| pair.x() < rows && pair.y() < cols;
+        let in_chip = |point: Point<usize>| in_grid(point.flatten()) && point.lay() < num_layers;
+
+        for (idx, layer) in self.layers.iter().enumerate() {
+            if layer.id != idx || layer.dim != self.dim || layer.capacity.len() != self.dim.size() {
+                return Err(anyhow!("Layer {} is malformed", idx));
+            }
+        }
+
+        for mc in self.mastercells.iter() {
+            let mut layers = mc.pins.iter().map(|pin| pin.layer);
+            let mut blkg_layers = mc.blkgs.iter().map(|blkg| blkg.layer);
+            if layers.any(|layer| layer >= num_layers)
+                || blkg_layers.any(|layer| layer >= num_layers)
+            {
+                return Err(anyhow!("MasterCell {} uses a layer out of bounds", mc.id));
+            }
+        }
+
+        for conflict in self.conflicts.values().flatten() {
+            if conflict.layer >= num_layers || conflict.id >= self.mastercells.len() {
+                return Err(anyhow!("Conflict {:?} is out of bounds", conflict));
+            }
+        }
+
+        for cell in self.cells.iter() {
+            if !in_grid(cell.position) {
+                return Err(anyhow!("Cell {} is out of bounds", cell.id));
+            }
+        }
+
+        for net in self.nets.iter() {
+            if net.min_layer >= num_layers {
+                return Err(anyhow!("Net {} has a min layer out of bounds", net.id));
+            }
+
+            for route in net.segments().iter() {
+                if !in_chip(route.source()) || !in_chip(route.target()) {
+                    return Err(anyhow!("Net {} has a route out of bounds", net.id));
+                }
+            }
+
+            for pin in self.pins_of_net(net.id) {
+                if !in_chip(pin.position) {
+                    return Err(anyhow!("Net {} has a pin out of bounds", net.id));
+                }
+            }
+        }
+
+        Ok(())
+    }
+
+    /// Resolves the pins of a net to where they are.
+    fn resolve_pins(&self, net: usize) -> Vec<PinRef> {
+        self.nets[net]
+            .pins
+            .iter()
+            .map(|&(cell, pin)| {
+                let position = self.cells[cell].position;
+                let layer = self.mastercells[self.cells[cell].mastercell]
+                    .get_pin(pin)
+                    .expect("Pin not found")
+                    .layer;
+
+                PinRef {
+                    cell,
+                    pin,
+                    position: position.with(layer),
+                }
+            })
+            .collect()
+    }
+
+    /// The routes of a net as a tree over its pins, as they currently are.
+    pub fn route_tree(&self, net: usize) -> RouteTree {
+        let pins: Vec<_> = self
+            .pins_of_net(net)
+            .iter()
+            .map(|pin| pin.position)
+            .collect();
+        RouteTree::new(&self.nets[net].segments(), &pins)
+    }
+
+    /// A Steiner tree over the grids of the pins of a net in 2D, see `steiner_tree`.
+    pub fn steiner_topology(&self, net: usize) -> Topology {
+        let pins: Vec<_> = self
+            .pins_of_net(net)
+            .iter()
+            .map(|pin| pin.position.flatten())
+            .collect();
+        steiner_tree(&pins)
+    }
+
+    /// The connections of a net as 2-pin tasks between its pins,
+    /// along a minimum spanning tree over the grids of its pins, see `prim_tree`.
+    /// A pin on the grid of a pin before it is connected to that one by a via, first.
+    pub fn mst_connections(&self, net: usize) -> Vec<(Point<usize>, Point<usize>)> {
+        let mut first: HashMap<Pair<usize>, Point<usize>> = HashMap::new();
+        let mut tasks = Vec::new();
+        for pin in self.pins_of_net(net) {
+            let pos = pin.position;
+            let stacked = *first.entry(pos.flatten()).or_insert(pos);
+            if stacked != pos {
+                tasks.push((stacked, pos));
+            }
+        }
+
+        let grids: Vec<_> = self
+            .pins_of_net(net)
+            .iter()
+            .map(|pin| pin.position.flatten())
+            .collect();
+        tasks.extend(
+            prim_tree(&grids)
+                .connections()
+                .into_iter()
+                .map(|(a, b)| (first[&a], first[&b])),
+        );
+        tasks
+    }
+
+    /// The 2-pin tasks of a net along a topology over the grids of its pins,
+    /// like `steiner_topology` or a minimum spanning tree, see `Decomposition::new`.
+    pub fn decompose(&self, net: usize, topology: &Topology) -> Decomposition {
+        let pins: Vec<_> = self
+            .pins_of_net(net)
+            .iter()
+            .map(|pin| pin.position)
+            .collect();
+        Decomposition::new(topology, &pins)
+    }
+
+    /// Removes the dangling route segments of every net, ending at no pin, see `RouteTree::prune`.
+    /// Returns the number of nets pruned.
+    pub fn prune_dangling(&mut self) -> usize {
+        let mut pruned = 0;
+        for net in 0..self.nets.len() {
+            let mut tree = self.route_tree(net);
+            if tree.prune() > 0 {
+                self.set_routes(net, tree.edges().into_iter().collect());
+                pruned += 1;
+            }
+        }
+        pruned
+    }
+
+    /// The supply and demand of every grid, as they currently are.
+    pub fn routing_grid(&self) -> RoutingGrid {
+        RoutingGrid::from_chip(self)
+    }
+
+    /// The extra demand rules read, looked up by mastercells and layer.
+    pub fn extra_demand_rules(&self) -> ExtraDemandRules {
+        ExtraDemandRules::new(&self.conflicts)
+    }
+
+    /// The layers read, looked up by name or index.
+    pub fn layer_table(&self) -> LayerTable<'_> {
+        LayerTable::new(&self.layers)
+    }
+
+    /// The moves path search makes for a net, against layer directions only if `wrong_way` lets it,
+    /// costing the `weights` of the wirelength, inflated where congestion is predicted.
+    pub fn moves(&self, net: usize) -> Moves<'_> {
+        Moves::new(
+            self.layer_table(),
+            self.dim,
+            self.nets[net].min_layer,
+            self.wrong_way,
+            &self.weights,
+            &self.inflation,
+        )
+    }
+
+    /// The mastercells read, looked up by name.
+    pub fn library(&self) -> MasterCellLib<'_> {
+        MasterCellLib::new(&self.mastercells)
+    }
+
+    /// The resolved pins of a net.
+    pub fn pins_of_net(&self, net: usize) -> &[PinRef] {
+        &self.pin_refs[net]
+    }
+
+    /// Computes a lower bound of the wirelength of a net.
+    /// The routes need to span the bounding box of the pins,
+    /// going up to the min layer if the net spans more than one grid of a layer.
+    fn compute_bound(&self, net: usize) -> usize {
+        let mut positions = self.pins_of_net(net).iter().map(|pin| pin.position);
+
+        let first = match positions.next() {
+            Some(first) => first,
+            None => return 0,
+        };
+
+        let (lo, hi) = positions.fold((first, first), |(lo, hi), pos| {
+            (
+                Point(
+                    cmp::min(lo.row(), pos.row()),
+                    cmp::min(lo.col(), pos.col()),
+                    cmp::min(lo.lay(), pos.lay()),
+                ),
+                Point(
+                    cmp::max(hi.row(), pos.row()),
+                    cmp::max(hi.col(), pos.col()),
+                    cmp::max(hi.lay(), pos.lay()),
+                ),
+            )
+        });
+
+        let (mut lmin, mut lmax) = (lo.lay(), hi.lay());
+        if lo.flatten() != hi.flatten() {
+            let min_layer = self.nets[net].min_layer;
+            lmin = cmp::min(lmin, min_layer);
+            lmax = cmp::max(lmax, min_layer);
+        }
+
+        match (hi.row() - lo.row()) + (hi.col() - lo.col()) + (lmax - lmin) {
+            0 => 0,
+            span => span + 1,
+        }
+    }
+
+    /// The lower bound of the wirelength of a net.
+    pub fn bound(&self, net: usize) -> usize {
+        self.bounds[net]
+    }
+
+    /// The 2D box covering the pins and the routes of a net.
+    pub fn bounding_box(&self, net: usize) -> (Pair<usize>, Pair<usize>) {
+        let pins = self
+            .pins_of_net(net)
+            .iter()
+            .map(|pin| pin.position.flatten());
+        let segments = self.nets[net].segments();
+        let routes = segments
+            .iter()
+            .flat_map(|route| vec![route.source().flatten(), route.target().flatten()]);
+
+        pins.chain(routes).fold(
+            (Pair(usize::MAX, usize::MAX), Pair(0, 0)),
+            |(lo, hi), pos| {
+                (
+                    Pair(cmp::min(lo.x(), pos.x()), cmp::min(lo.y(), pos.y())),
+                    Pair(cmp::max(hi.x(), pos.x()), cmp::max(hi.y(), pos.y())),
+                )
+            },
+        )
+    }
+
+    /// The total weighted wirelength of all nets.
+    pub fn wirelength(&self) -> f64 {
+        self.nets
+            .iter()
+            .map(|net| self.weighted_length(net.id, &net.segments()))
+            .sum()
+    }
+
+    /// The weighted wirelength of routes of a net, critical nets weighing more.
+    pub fn weighted_length(&self, net: usize, routes: &HashSet<Route<usize>>) -> f64 {
+        self.criticality.weight(net) * self.weights.length_of(routes)
+    }
+
+    /// How much shorter the weighted wirelength is than the initial one, in percents.
+    pub fn improvement(&self) -> f64 {
+        if self.baseline == 0. {
+            return 0.;
+        }
+        100. * (self.baseline - self.wirelength()) / self.baseline
+    }
+
+    /// Replaces the weights of the wirelength, scoring the baseline again.
+    /// Must be called before any route changes, since the baseline is the score of the initial routes.
+    pub fn set_weights(&mut self, weights: Weights) {
+        self.weights = weights;
+        self.baseline = self.wirelength();
+    }
+
+    /// Replaces the criticality of the nets, scoring the baseline again.
+    /// Must be called before any route changes, like `set_weights`.
+    pub fn set_criticality(&mut self, criticality: Criticality) -> Result<()> {
+        if let Some(net) = criticality.max_net() {
+            if net >= self.nets.len() {
+                return Err(anyhow!("Net {} not found", Net::from_num(net)?));
+            }
+        }
+
+        self.criticality = criticality;
+        self.baseline = self.wirelength();
+        Ok(())
+    }
+
+    /// Dirty nets whose wirelength can still be improved,
+    /// skipping the ones already at their lower bound.
+    /// Only the forced nets if there are some, wherever they are.
+    /// Broken nets come first in any case, then the critical nets longer than allowed,
+    /// as they must be repaired.
+    pub fn improvable_nets(&self) -> Vec<usize> {
+        let mut nets = self.broken_nets();
+        nets.extend(
+            self.over_length_nets()
+                .into_iter()
+                .filter(|net| !self.broken.contains(net)),
+        );
+        let urgent: HashSet<_> = nets.iter().copied().collect();
+
+        if !self.forced.is_empty() {
+            let mut forced: Vec<_> = self
+                .forced
+                .iter()
+                .copied()
+                .filter(|net| !urgent.contains(net))
+                .collect();
+            forced.sort_unstable();
+            nets.extend(forced);
+            return nets;
+        }
+
+        nets.extend(
+            self.nets
+                .iter()
+                .filter(|net| !urgent.contains(&net.id))
+                .filter(|net| net.dirty && net.length() > self.bound(net.id))
+                .map(|net| net.id),
+        );
+        nets
+    }
+
+    /// Critical nets longer than their maximum length, sorted.
+    pub fn over_length_nets(&self) -> Vec<usize> {
+        let mut nets: Vec<_> = self
+            .criticality
+            .max_lengths
+            .keys()
+            .copied()
+            .filter(|&net| self.criticality.over_length(net, self.nets[net].length()))
+            .collect();
+        nets.sort_unstable();
+        nets
+    }
+
+    /// Nets whose routes no longer connect their pins since a cell moved, sorted.
+    pub fn broken_nets(&self) -> Vec<usize> {
+        let mut broken: Vec<_> = self.broken.iter().copied().collect();
+        broken.sort_unstable();
+        broken
+    }
+
+    /// Forces the nets whose names match one of `patterns` to be ripped up and rerouted,
+    /// leaving the other nets untouched, and reroutes them right away, see `reroute`.
+    /// Forced nets which cannot be routed keep their routes.
+    /// Returns the number of forced nets.
+    pub fn force_reroute(&mut self, patterns: &[Regex]) -> Result<usize> {
+        for net in self.nets.iter_mut() {
+            let name = Net::from_num(net.id)?;
+            let matched = patterns.iter().any(|pattern| pattern.is_match(&name));
+
+            net.dirty = matched;
+            if matched {
+                self.forced.insert(net.id);
+            }
+        }
+
+        let pass = mem::replace(&mut self.pass, Provenance::Maze(0));
+        let mut forced: Vec<_> = self.forced.iter().copied().collect();
+        forced.sort_unstable();
+        for net in forced {
+            optimizer::reroute(self, net, Escalation::after(0), None);
+        }
+        self.pass = pass;
+
+        Ok(self.forced.len())
+    }
+
+    /// Whether a cell may be at a position, given its voltage area.
+    pub fn allowed(&self, cell: usize, pos: Pair<usize>) -> bool {
+        match self.cell_areas.get(cell).copied().flatten() {
+            Some(area) => self.voltage_areas[area].grids.contains(&pos),
+            None => true,
+        }
+    }
+
+    /// Checks that a cell may be moved to `to`: it exists, is movable,
+    /// and `to` is within the chip and its voltage area.
+    pub fn check_move(&self, cell: usize, to: Pair<usize>) -> Result<()> {
+        let name = Cell::from_num(cell)?;
+        match self.cells.get(cell) {
+            None => return Err(anyhow!("Cell {} not found", name)),
+            Some(cell) if cell.movable == CellType::Fixed => {
+                return Err(anyhow!("Cell {} is fixed", name))
+            }
+            Some(_) => {}
+        }
+        if to.x() >= self.dim.x() || to.y() >= self.dim.y() {
+            return Err(anyhow!("Cell {} cannot leave the chip", name));
+        }
+        if !self.allowed(cell, to) {
+            return Err(anyhow!("Cell {} cannot leave its voltage area", name));
+        }
+        Ok(())
+    }
+
+    /// Moves a cell to `to`, refreshing the pins of the nets connected to it.
+    /// Whether it may be moved is not checked, see `check_move`.
+    pub fn move_cell(&mut self, id: usize, to: Pair<usize>) {
+        let Pair(_, cols) = self.dim;
+        let from = self.cells.get(id).expect("Cell not found").position;
+
+        // grids whose extra demand may change
+        let mut affected = self.neighborhood(from);
+        for pos in self.neighborhood(to) {
+            if !affected.contains(&pos) {
+                affected.push(pos);
+            }
+        }
+
+        self.update_extra_demand(&affected, false);
+        self.update_blockage_demand(id, false);
+
+        let cell = &mut self.cells[id];
+        if !cell.moved {
+            cell.moved = true;
+            self.already_moved += 1;
+        }
+        cell.position = to;
+
+        self.cells_at[from.x() * cols + from.y()].retain(|&other| other != id);
+        self.cells_at[to.x() * cols + to.y()].push(id);
+
+        self.update_blockage_demand(id, true);
+        self.update_extra_demand(&affected, true);
+
+        for idx in 0..self.cell_nets[id].len() {
+            let net = self.cell_nets[id][idx];
+            self.pin_refs[net] = self.resolve_pins(net);
+            self.bounds[net] = self.compute_bound(net);
+            self.touched_nets.insert(net);
+
+            // moving back may repair a net as well
+            if self.connects(net, &self.nets[net].segments()) {
+                self.broken.remove(&net);
+            } else {
+                self.broken.insert(net);
+                self.nets[net].dirty = true;
+            }
+        }
+    }
+
+    /// Reuses the solution of a previous version of the same benchmark.
+    /// Entities are matched by name (hence by id).
+    /// Cells that did not change take their previous positions,
+    /// and nets that did not change keep their previous routes and are no longer dirty.
+    /// Returns the number of reused nets.
+    pub fn warm_start(&mut self, old: &Chip, solution: &Solution) -> usize {
+        // decided on the input positions, before any cell is moved
+        let unchanged_cells: Vec<_> = self
+            .cells
+            .iter()
+            .map(|cell| match old.cells.get(cell.id) {
+                Some(prev) => {
+                    prev.mastercell == cell.mastercell
+                        && prev.movable == cell.movable
+                        && prev.position == cell.position
+                }
+                None => false,
+            })
+            .collect();
+
+        // where the previous solution put a cell
+        let final_position = |id: usize| {
+            solution
+                .cells
+                .get(&id)
+                .copied()
+                .or_else(|| old.cells.get(id).map(|cell| cell.position))
+        };
+
+        // moves the new input does not allow are skipped
+        for id in 0..self.cells.len() {
+            if self.already_moved >= self.max_move || !unchanged_cells[id] {
+                continue;
+            }
+            match solution.cells.get(&id) {
+                Some(&position) if position != self.cells[id].position => {
+                    if self.check_move(id, position).is_ok() {
+                        self.move_cell(id, position);
+                    }
+                }
+                _ => {}
+            }
+        }
+
+        let cells = &self.cells;
+        let unchanged: Vec<_> = self
+            .nets
+            .iter()
+            .filter(|net| match old.nets.get(net.id) {
+                Some(prev) => {
+                    prev.min_layer == net.min_layer
+                        && prev.pins == net.pins
+                        && net.pins.iter().all(|&(cell, _)| {
+                            unchanged_cells[cell]
+                                && final_position(cell) == Some(cells[cell].position)
+                        })
+                }
+                None => false,
+            })
+            .map(|net| net.id)
+            .collect();
+
+        let pass = mem::replace(&mut self.pass, Provenance::WarmStart);
+        for &net in unchanged.iter() {
+            if let Some(routes) = solution.routes.get(&net) {
+                self.set_routes(net, routes.clone());
+            }
+            self.nets[net].dirty = false;
+        }
+        self.pass = pass;
+
+        unchanged.len()
+    }
+
+    /// Applies an output file or a snapshot read as `solution`:
+    /// moves the cells it moves, and sets the routes of the nets it routes.
+    /// Nothing is applied if it does not fit the chip, see `Solution::check`,
+    /// like moving a fixed cell or a cell out of its voltage area.
+    pub fn apply(&mut self, solution: &Solution) -> Result<()> {
+        solution.check(self)?;
+        let pass = mem::replace(&mut self.pass, Provenance::Applied);
+
+        let mut cells: Vec<_> = solution.cells.iter().collect();
+        cells.sort_unstable();
+        for (&cell, &position) in cells {
+            if self.cells[cell].position != position {
+                self.move_cell(cell, position);
+            }
+        }
+
+        for (&net, routes) in solution.routes.iter() {
+            self.set_routes(net, routes.clone());
+        }
+
+        self.pass = pass;
+        Ok(())
+    }
+
+    fn duration(args: &Args) -> Duration {
+        use crate::consts::*;
+
+        // By default duration is equal to 1 hr
+        match args {
+            Args {
+                sec: Some(sec),
+                min: None,
+                hr: None,
+                ..
+            } => Duration::from_secs(*sec as u64),
+            Args {
+                sec: None,
+                min: Some(min),
+                hr: None,
+                ..
+            } => Duration::from_secs(SECS_PER_MIN * *min as u64),
+            Args {
+                sec: None,
+                min: None,
+                hr: Some(hr),
+                ..
+            } => Duration::from_secs(SECS_PER_HR * *hr as u64),
+            _ => Duration::from_secs(SECS_PER_HR),
+        }
+    }
+
+    /// Checks that time remains since `start`, failing once `duration` has passed.
+    fn check_time(start: Instant, duration: Duration) -> Result<()> {
+        let now = Instant::now();
+        if now - start < duration {
+            Ok(())
+        } else {
+            Err(anyhow!("Time's up!"))
+        }
+    }
+
+    /// Runs all operations.
+    pub fn run(&mut self, args: &Args) -> Result<()> {
+        let start = Instant::now();
+        let duration = Self::duration(args);
+
+        // the one optimizer searches one net at a time, watched if `--watchdog` is given
+        let progress = Arc::new(Progress::new());
+        let _watchdog = args
+            .watchdog
+            .map(|secs| Watchdog::spawn(vec![Arc::clone(&progress)], Duration::from_secs(secs)));
+
+        use crate::consts::*;
+        let deadline = start + duration;
+        let slice = Duration::from_millis(SLICE_MILLIS);
+
+        // the dashboard and restarts run in the background, restarts keeping the optimizer busy
+        let mut background: Vec<Box<dyn Task>> = Vec::new();
+        if args.tui {
+            background.push(Box::new(Dashboard::new(
+                start,
+                deadline,
+                Duration::from_millis(DASHBOARD_MILLIS),
+            )));
+        }
+        if let Some(secs) = args.restart_after {
+            background.push(Box::new(Restart::new(
+                self,
+                Duration::from_secs(secs),
+                Duration::from_secs(PLATEAU_CHECK_SECS),
+                RESTART_MOVES,
+                args.seed.unwrap_or(0),
+            )));
+        }
+        let optimizer = |cells: bool, nets: bool| {
+            let optimizer = Optimizer::new(cells, nets, Arc::clone(&progress));
+            let optimizer = if args.bundles {
+                optimizer.bundles()
+            } else {
+                optimizer
+            };
+            match args.restart_after {
+                Some(_) => optimizer.endless(),
+                None => optimizer,
+            }
+        };
+
+        // routing and cell moving in the foreground, both unless told which
+        let (cells, nets) = match (args.cell, args.net) {
+            (false, false) => (true, true),
+            flags => flags,
+        };
+
+        if args.single {
+            let mut scheduler = Scheduler::new(slice);
+            scheduler.spawn(Box::new(optimizer(cells, nets)));
+            scheduler.spawn_background(Box::new(Flush::new(
+                self,
+                &args.outfile,
+                Duration::from_secs(FLUSH_SECS),
+            )));
+            for task in background {
+                scheduler.spawn_background(task);
+            }
+            return scheduler.run(self, deadline);
+        }
+
+        let mut optimizer = optimizer(cells, nets);
+
+        // every pass is an iteration
+        let mut iteration = 0;
+        while Self::check_time(start, duration).is_ok() {
+            if optimizer.between_passes() {
+                self.checkpoint(args, &mut iteration)?;
+            }
+            if optimizer.step(self, deadline.min(Instant::now() + slice))? == Poll::Done {
+                break;
+            }
+            for task in background.iter_mut() {
+                task.step(self, deadline.min(Instant::now() + slice))
+                    .map_err(|err| anyhow!("{}: {}", task.name(), err))?;
+            }
+        }
+
+        optimizer.finish(self)?;
+        for task in background.iter_mut() {
+            task.finish(self)
+                .map_err(|err| anyhow!("{}: {}", task.name(), err))?;
+        }
+        Ok(())
+    }
+
+    /// Asks the plugin, if any, about moving a cell to `to`.
+    /// Returns `None` if the move is vetoed, its score otherwise.
+    /// Without a plugin every move scores 0.
+    pub fn judge_move(&mut self, cell: usize, to: Pair<usize>) -> Result<Option<f64>> {
+        let from = self.cells.get(cell).expect("Cell not found").position;
+
+        match self.plugin.as_mut() {
+            Some(plugin) => plugin.judge(cell, from, to),
+            None => Ok(Some(0.)),
+        }
+    }
+
+    /// Features of every grid as seen by a congestion predictor.
+    /// Grids are indexed like `Layer::capacity`, one layer after another.
+    pub fn grid_features(&self) -> Vec<[f64; NUM_FEATURES]> {
+        let Pair(rows, cols) = self.dim;
+        let size = self.dim.size();
+
+        // number of pins on every grid of every layer
+        let mut pins = vec![0_usize; self.layers.len() * size];
+        for cell in self.cells.iter() {
+            let Pair(row, col) = cell.position;
+            let mc = self
+                .mastercells
+                .get(cell.mastercell)
+                .expect("MasterCell not found");
+            for pin in mc.pins.iter() {
+                pins[pin.layer * size + row * cols + col] += 1;
+            }
+        }
+
+        // number of nets whose bounding box covers a grid, as a 2D difference array first
+        let width = cols + 1;
+        let mut cover = vec![0_isize; (rows + 1) * width];
+        for net in self.nets.iter().filter(|net| !net.pins.is_empty()) {
+            let (rmin, rmax, cmin, cmax) = net
+                .pins
+                .iter()
+                .map(|&(cell, _)| self.cells[cell].position)
+                .fold(
+                    (usize::MAX, usize::MIN, usize::MAX, usize::MIN),
+                    |(rmin, rmax, cmin, cmax), Pair(row, col)| {
+                        (
+                            cmp::min(rmin, row),
+                            cmp::max(rmax, row),
+                            cmp::min(cmin, col),
+                            cmp::max(cmax, col),
+                        )
+                    },
+                );
+
+            cover[rmin * width + cmin] += 1;
+            cover[rmin * width + cmax + 1] -= 1;
+            cover[(rmax + 1) * width + cmin] -= 1;
+            cover[(rmax + 1) * width + cmax + 1] += 1;
+        }
+        for row in 0..rows {
+            for col in 0..cols {
+                let idx = row * width + col;
+                if col > 0 {
+                    cover[idx] += cover[idx - 1];
+                }
+                if row > 0 {
+                    cover[idx] += cover[idx - width];
+                }
+                if row > 0 && col > 0 {
+                    cover[idx] -= cover[idx - width - 1];
+                }
+            }
+        }
+
+        self.layers
+            .iter()
+            .flat_map(|layer| {
+                let pins = &pins;
+                let cover = &cover;
+                (0..size).map(move |idx| {
+                    let (row, col) = (idx / cols, idx % cols);
+                    [
+                        layer.capacity[idx] as f64,
+                        pins[layer.id * size + idx] as f64,
+                        cover[row * width + col] as f64,
+                    ]
+                })
+            })
+            .collect()
+    }
+
+    /// Index of a grid in vectors indexed like `Layer::capacity`, one layer after another.
+    pub fn grid_index(&self, point: Point<usize>) -> usize {
+        let Pair(_, cols) = self.dim;
+        point.lay() * self.dim.size() + point.row() * cols + point.col()
+    }
+
+    /// Computes the demand of every grid from scratch, indexed like `grid_index`.
+    /// Every net going through a grid (vias following the via model), every blockage of a cell on it
+    /// and every extra demand between cells of conflicting mastercells count.
+    pub fn compute_demand(&self) -> Vec<usize> {
+        let mut demand = vec![0; self.layers.len() * self.dim.size()];
+        self.add_demand(&mut demand);
+        demand
+    }
+
+    /// Adds the demand of every grid to `demand`, see `compute_demand`.
+    fn add_demand(&self, demand: &mut [usize]) {
+        let positions: Vec<_> = self.cells.iter().map(|cell| cell.position).collect();
+        self.add_cell_demand(&positions, demand);
+
+        for net in self.nets.iter() {
+            let points: PointSet = net
+                .segments()
+                .iter()
+                .flat_map(|&route| self.via_model.points(route))
+                .collect();
+            for point in points.iter() {
+                demand[self.grid_index(point)] += 1;
+            }
+        }
+    }
+
+    /// Computes the demand of every grid due to cells only, were they at `positions`:
+    /// the demand of blockages and the extra demand between cells.
+    pub fn cell_demand(&self, positions: &[Pair<usize>]) -> Vec<usize> {
+        let mut demand = vec![0; self.layers.len() * self.dim.size()];
+        self.add_cell_demand(positions, &mut demand);
+        demand
+    }
+
+    /// Adds the demand of every grid due to cells to `demand`, see `cell_demand`.
+    fn add_cell_demand(&self, positions: &[Pair<usize>], demand: &mut [usize]) {
+        let Pair(rows, cols) = self.dim;
+
+        let mut cells_at = vec![Vec::new(); self.dim.size()];
+        for (cell, &Pair(row, col)) in positions.iter().enumerate() {
+            cells_at[row * cols + col].push(cell);
+        }
+
+        for (cell, &position) in self.cells.iter().zip(positions.iter()) {
+            let mc = &self.mastercells[cell.mastercell];
+            for blkg in mc.blkgs.iter() {
+                demand[self.grid_index(position.with(blkg.layer))] += blkg.demand;
+            }
+        }
+
+        for row in 0..rows {
+            for col in 0..cols {
+                let pos = Pair(row, col);
+                for (layer, extra) in self.extra_demand_with(&cells_at, pos) {
+                    demand[self.grid_index(pos.with(layer))] += extra;
+                }
+            }
+        }
+    }
+
+    /// The grid and its horizontal neighbors, which share extra demand.
+    pub fn neighborhood(&self, pos: Pair<usize>) -> Vec<Pair<usize>> {
+        let mut grids = vec![pos];
+        grids.extend(pos.horizontal_neighbors(self.dim));
+        grids
+    }
+
+    /// Extra demand on a grid as (layer, demand),
+    /// from the pairs of conflicting cells the cells on the grid are part of.
+    pub fn extra_demand_at(&self, pos: Pair<usize>) -> Vec<(usize, usize)> {
+        self.extra_demand_with(&self.cells_at, pos)
+    }
+
+    /// Extra demand of a grid like `extra_demand_at`, were the cells on every grid `cells_at`.
+    pub fn extra_demand_with(
+        &self,
+        cells_at: &[Vec<usize>],
+        pos: Pair<usize>,
+    ) -> Vec<(usize, usize)> {
+        let Pair(row, col) = pos;
+        let cols = self.dim.y();
+
+        let count = |pos: Pair<usize>, mc: usize| {
+            cells_at[pos.x() * cols + pos.y()]
+                .iter()
+                .filter(|&&cell| self.cells[cell].mastercell == mc)
+                .count()
+        };
+
+        let mut mcs: Vec<_> = cells_at[row * cols + col]
+            .iter()
+            .map(|&cell| self.cells[cell].mastercell)
+            .collect();
+        mcs.sort_unstable();
+        mcs.dedup();
+
+        let mut extra = Vec::new();
+        for mc in mcs {
+            let conflicts = match self.conflicts.get(&mc) {
+                Some(conflicts) => conflicts,
+                None => continue,
+            };
+
+            let num = count(pos, mc);
+            for conflict in conflicts.iter() {
+                let other = conflict.id;
+                let pairs = match conflict.kind {
+                    ConflictType::SameGGrid if other == mc => num / 2,
+                    // counted once, from the side of the smaller id
+                    ConflictType::SameGGrid if mc < other => cmp::min(num, count(pos, other)),
+                    ConflictType::SameGGrid => 0,
+                    ConflictType::AdjHGGrid => {
+                        let sides: usize = pos
+                            .horizontal_neighbors(self.dim)
+                            .into_iter()
+                            .map(|side| count(side, other))
+                            .sum();
+                        let same = if other == mc {
+                            num - 1
+                        } else {
+                            count(pos, other)
+                        };
+                        cmp::min(num, sides + same)
+                    }
+                };
+
+                if pairs > 0 {
+                    extra.push((conflict.layer, pairs * conflict.demand));
+                }
+            }
+        }
+
+        extra
+    }
+
+    /// Adds or removes the extra demand on some grids.
+    fn update_extra_demand(&mut self, positions: &[Pair<usize>], add: bool) {
+        for &pos in positions.iter() {
+            for (layer, extra) in self.extra_demand_at(pos) {
+                let idx = self.grid_index(pos.with(layer));
+                if add {
+                    self.demand[idx] += extra;
+                } else {
+                    self.demand[idx] -= extra;
+                }
+            }
+        }
+    }
+
+    /// Adds or removes the demand of the blockages of a cell.
+    fn update_blockage_demand(&mut self, cell: usize, add: bool) {
+        let Cell {
+            position,
+            mastercell,
+            ..
+        } = self.cells[cell];
+
+        for blkg in self.mastercells[mastercell].blkgs.iter() {
+            let idx = self.grid_index(position.with(blkg.layer));
+            if add {
+                self.demand[idx] += blkg.demand;
+            } else {
+                self.demand[idx] -= blkg.demand;
+            }
+        }
+    }
+
+    /// Packs the routes of all nets but the forced ones to save memory.
+    /// Routes are unpacked again when set, and decoded on the fly when read.
+    pub fn pack_routes(&mut self) {
+        for net in self.nets.iter_mut() {
+            if !self.forced.contains(&net.id) {
+                net.pack();
+            }
+        }
+    }
+
+    /// Starts tracking which pass commits every route segment, see `set_routes`.
+    /// The current segments are tagged as read from the input.
+    pub fn track_provenance(&mut self) {
+        self.provenance = Some(
+            self.nets
+                .iter()
+                .map(|net| {
+                    net.segments()
+                        .iter()
+                        .map(|&route| (route, Provenance::Input))
+                        .collect()
+                })
+                .collect(),
+        );
+    }
+
+    /// Pass which committed a route segment of a net, if tracked.
+    pub fn provenance_of(&self, net: usize, route: &Route<usize>) -> Option<Provenance> {
+        self.provenance.as_ref()?.get(net)?.get(route).copied()
+    }
+
+    /// Number of route segments committed by every pass which are still there, if tracked.
+    pub fn provenance_counts(&self) -> Option<Vec<(Provenance, usize)>> {
+        let mut counts = HashMap::new();
+        for provenance in self.provenance.as_ref()?.iter() {
+            for &pass in provenance.values() {
+                *counts.entry(pass).or_insert(0) += 1;
+            }
+        }
+
+        let mut counts: Vec<_> = counts.into_iter().collect();
+        counts.sort_unstable();
+        Some(counts)
+    }
+
+    /// Replaces the routes of a net, updating the demand of the grids they go through.
+    /// New segments are tagged with the current pass if provenance is tracked.
+    pub fn set_routes(&mut self, net: usize, routes: HashSet<Route<usize>>) {
+        self.nets[net].unpack();
+        let old: HashSet<_> = self.nets[net]
+            .routes
+            .iter()
+            .flat_map(|&route| self.via_model.points(route))
+            .collect();
+        let new: HashSet<_> = routes
+            .iter()
+            .flat_map(|&route| self.via_model.points(route))
+            .collect();
+
+        for point in old.difference(&new) {
+            let idx = self.grid_index(*point);
+            self.demand[idx] -= 1;
+        }
+        for point in new.difference(&old) {
+            let idx = self.grid_index(*point);
+            self.demand[idx] += 1;
+        }
+
+        let pass = self.pass;
+        if let Some(provenance) = self.provenance.as_mut() {
+            // segments kept as they are keep where they come from
+            let old = mem::take(&mut provenance[net]);
+            provenance[net] = routes
+                .iter()
+                .map(|&route| (route, old.get(&route).copied().unwrap_or(pass)))
+                .collect();
+        }
+
+        self.nets[net].routes = routes;
+        self.touched_nets.insert(net);
+
+        if self.broken.contains(&net) && self.connects(net, &self.nets[net].routes) {
+            self.broken.remove(&net);
+        }
+    }
+
+    /// Replaces the routes of a net by routes found by the router, see `set_routes`.
+    /// During maze passes, new segments found by patterns are tagged as such.
+    pub fn set_routed(&mut self, net: usize, routed: Routed) {
+        let old: HashSet<_> = match (&self.provenance, self.pass) {
+            (Some(provenance), Provenance::Maze(_)) => provenance[net].keys().copied().collect(),
+            _ => return self.set_routes(net, routed.routes),
+        };
+        self.set_routes(net, routed.routes);
+
+        if let Some(provenance) = self.provenance.as_mut() {
+            for route in routed.patterns.difference(&old) {
+                if let Some(pass) = provenance[net].get_mut(route) {
+                    *pass = Provenance::Pattern;
+                }
+            }
+        }
+    }
+
+    /// Whether routes connect all the pins of a net.
+    pub fn connects(&self, net: usize, routes: &HashSet<Route<usize>>) -> bool {
+        let pins: Vec<_> = self
+            .pins_of_net(net)
+            .iter()
+            .map(|pin| pin.position)
+            .collect();
+        utilities::connected(&pins, routes)
+    }
+
+    /// How much the grids exceed their supply, among `points`.
+    pub fn overflow(&self, points: &HashSet<Point<usize>>) -> usize {
+        points
+            .iter()
+            .map(|&point| {
+                let supply = *self.layers[point.lay()]
+                    .get_capacity(point.row(), point.col())
+                    .expect("Cell index out of bounds");
+                self.demand[self.grid_index(point)].saturating_sub(supply)
+            })
+            .sum()
+    }
+
+    /// Number of grids with more demand than supply.
+    pub fn overflowed_grids(&self) -> usize {
+        let supply = self.layers.iter().flat_map(|layer| layer.capacity.iter());
+        self.demand
+            .iter()
+            .zip(supply)
+            .filter(|(&demand, &supply)| demand > supply)
+            .count()
+    }
+
+    /// Recomputes the demand from scratch and compares it with the one maintained incrementally.
+    /// Returns an error pointing at the first grid where they differ.
+    pub fn audit_demand(&self) -> Result<()> {
+        let expected = self.compute_demand();
+        let Pair(_, cols) = self.dim;
+        let size = self.dim.size();
+
+        match (0..expected.len()).find(|&idx| expected[idx] != self.demand[idx]) {
+            Some(idx) => {
+                let (lay, rest) = (idx / size, idx % size);
+                let point = Point(rest / cols, rest % cols, lay).external();
+                Err(anyhow!(
+                    "Demand of grid {} is {}, expected {}",
+                    point,
+                    self.demand[idx],
+                    expected[idx]
+                ))
+            }
+            None => Ok(()),
+        }
+    }
+
+    /// Which grids still have free capacity on the lowest layer, given the demand of every grid.
+    pub fn free_grids(&self, demand: &[usize]) -> Vec<bool> {
+        match self.layers.first() {
+            Some(layer) => layer
+                .capacity
+                .iter()
+                .zip(demand.iter())
+                .map(|(supply, demand)| supply > demand)
+                .collect(),
+            None => Vec::new(),
+        }
+    }
+
+    /// Candidate positions of a cell, which are the grids in the bounding box
+    /// of the other pins of its nets, skipping its current grid, the saturated ones
+    /// and the ones out of its voltage area.
+    /// Fixed cells have none.
+    pub fn candidate_grids(&self, cell: usize, free: &[bool]) -> Vec<Pair<usize>> {
+        if self.cells[cell].movable == CellType::Fixed {
+            return Vec::new();
+        }
+        let current = self.cells[cell].position;
+        let Pair(_, cols) = self.dim;
+
+        let positions = self.cell_nets[cell]
+            .iter()
+            .flat_map(|&net| self.pins_of_net(net).iter())
+            .filter(|pin| pin.cell != cell)
+            .map(|pin| pin.position.flatten());
+
+        let (rmin, rmax, cmin, cmax) = positions.fold(
+            (usize::MAX, usize::MIN, usize::MAX, usize::MIN),
+            |(rmin, rmax, cmin, cmax), Pair(row, col)| {
+                (
+                    cmp::min(rmin, row),
+                    cmp::max(rmax, row),
+                    cmp::min(cmin, col),
+                    cmp::max(cmax, col),
+                )
+            },
+        );
+
+        if rmin > rmax {
+            return Vec::new();
+        }
+
+        (rmin..=rmax)
+            .flat_map(|row| (cmin..=cmax).map(move |col| Pair(row, col)))
+            .filter(|&pos| pos != current && free[pos.x() * cols + pos.y()])
+            .filter(|&pos| self.allowed(cell, pos))
+            .collect()
+    }
+
+    /// Which 2D grids are overflowed on some layer, given the demand of every grid,
+    /// indexed like `Layer::capacity`. Connected, they make congested corridors.
+    pub fn congested_grids(&self, demand: &[usize]) -> Vec<bool> {
+        let size = self.dim.size();
+
+        let mut overflowed = vec![false; size];
+        for layer in self.layers.iter() {
+            let demand = &demand[layer.id * size..(layer.id + 1) * size];
+            for (idx, (supply, demand)) in layer.capacity.iter().zip(demand).enumerate() {
+                overflowed[idx] |= demand > supply;
+            }
+        }
+        overflowed
+    }
+
+    /// Groups the nets going through the same congested corridor, given the demand of every grid.
+    /// A corridor is a set of connected grids overflowed on some layer, see `congested_grids`.
+    /// Nets of a bundle are meant to be ripped up and rerouted together,
+    /// since rerouting them one by one only pushes the congestion back and forth.
+    /// Bundles of a single net are left out, biggest bundles come first.
+    pub fn congested_bundles(&self, demand: &[usize]) -> Vec<Vec<usize>> {
+        let Pair(rows, cols) = self.dim;
+        let size = self.dim.size();
+
+        let overflowed = self.congested_grids(demand);
+
+        let mut corridors = UnionFind::new(size);
+        for row in 0..rows {
+            for col in 0..cols {
+                let idx = row * cols + col;
+                if !overflowed[idx] {
+                    continue;
+                }
+                // right and down, the other sides being done from the other grid
+                let pos = Pair(row, col);
+                for next in [pos.offset(0, 1, self.dim), pos.offset(1, 0, self.dim)]
+                    .iter()
+                    .flatten()
+                {
+                    let other = next.x() * cols + next.y();
+                    if overflowed[other] {
+                        corridors.union(idx, other);
+                    }
+                }
+            }
+        }
+
+        let mut bundles: HashMap<usize, HashSet<usize>> = HashMap::new();
+        for net in self.nets.iter() {
+            for point in net.segments().iter().flat_map(Route::points) {
+                let idx = point.row() * cols + point.col();
+                if overflowed[idx] {
+                    let corridor = corridors.find_mut(idx).expect("Index out of bounds");
+                    bundles
+                        .entry(corridor)
+                        .or_insert_with(HashSet::new)
+                        .insert(net.id);
+                }
+            }
+        }
+
+        let mut bundles: Vec<Vec<usize>> = bundles
+            .into_iter()
+            .map(|(_, nets)| nets.into_iter().collect::<Vec<_>>())
+            .filter(|nets| nets.len() > 1)
+            .map(|mut nets| {
+                nets.sort_unstable();
+                nets
+            })
+            .collect();
+        bundles.sort_by(|a, b| b.len().cmp(&a.len()).then_with(|| a.cmp(b)));
+        bundles
+    }
+
+    /// Inflates the cost of grids a predictor thinks are going to be congested.
+    /// The predictor is kept, and inflates the designs read after `release` too.
+    pub fn inflate(&mut self, predictor: Box<dyn Predictor>) {
+        self.inflation = self
+            .grid_features()
+            .iter()
+            .map(|features| 1. + predictor.predict(features).max(0.))
+            .collect();
+        self.predictor = Some(predictor);
+    }
+
+    /// Write the content stored in memory to a file.
+    /// Nets broken by moved cells are written anyway, with a warning, as the file would be illegal.
+    /// The standard output is written if the file is named `-`.
+    pub fn write_file(&mut self, filename: &str) -> Result<()> {
+        let content = format!("{}\n", self);
+        if filename == STDIO {
+            io::stdout().write_all(content.as_bytes())?;
+        } else {
+            fs::write(filename, content)?;
+        }
+
+        if !self.broken.is_empty() {
+            let names = self
+                .broken_nets()
+                .into_iter()
+                .map(Net::from_num)
+                .collect::<Result<Vec<_>>>()?;
+            eprintln!(
+                "Warning: {} is illegal, {} nets are broken by moved cells: {}",
+                filename,
+                names.len(),
+                names.join(" ")
+            );
+        }
+
+        let over_length = self.over_length_nets();
+        if !over_length.is_empty() {
+            let names = over_length
+                .into_iter()
+                .map(Net::from_num)
+                .collect::<Result<Vec<_>>>()?;
+            eprintln!(
+                "Warning: {} is illegal, {} critical nets are too long: {}",
+                filename,
+                names.len(),
+                names.join(" ")
+            );
+        }
+
+        Ok(())
+    }
+
+    /// Writes a snapshot if `--snapshots` is given,
+    /// audits the demand every `--audit` iterations, and counts the iteration.
+    fn checkpoint(&mut self, args: &Args, iteration: &mut usize) -> Result<()> {
+        if let Some(dir) = &args.snapshots {
+            self.write_snapshot(dir, *iteration)?;
+        }
+        match args.audit {
+            Some(every) if every > 0 && *iteration % every == 0 => self.audit_demand()?,
+            _ => {}
+        }
+        *iteration += 1;
+        Ok(())
+    }
+
+    /// Writes the moved cells and the nets changed since the last snapshot
+    /// to `<dir>/<iteration>.txt`, in the output format.
+    pub fn write_snapshot(&mut self, dir: &str, iteration: usize) -> Result<()> {
+        let mut touched: Vec<_> = self.touched_nets.drain().collect();
+        touched.sort_unstable();
+
+        let moved: Vec<_> = self.cells.iter().filter(|cell| cell.moved).collect();
+        let num_routes: usize = touched
+            .iter()
+            .map(|&net| self.nets[net].merged().len())
+            .sum();
+
+        let mut content = format!("NumMovedCellInst {}\n", moved.len());
+        for cell in moved {
+            content.push_str(&format!("{}\n", cell));
+        }
+        content.push_str(&format!("NumRoutes {}\n", num_routes));
+        for net in touched {
+            content.push_str(&self.nets[net].to_string());
+        }
+
+        fs::write(
+            Path::new(dir).join(format!("{:06}.txt", iteration)),
+            content,
+        )?;
+
+        Ok(())
+    }
+
+    /// Write the final cell positions in a simple placement format.
+    /// Every line is `<instName> <rowIdx> <colIdx>`.
+    pub fn write_placement(&self, filename: &str) -> Result<()> {
+        let content: String = self
+            .cells
+            .iter()
+            .map(|cell| -> Result<String> {
+                Ok(format!(
+                    "{} {}\n",
+                    Cell::from_num(cell.id)?,
+                    cell.position.external()
+                ))
+            })
+            .collect::<Result<_>>()?;
+
+        fs::write(filename, content)?;
+
+        Ok(())
+    }
+
+    /// Returns a reference to a layer
+    pub fn get_layer(&self, idx: usize) -> Option<&Layer> {
+        self.layers.get(idx)
     }
 
     /// Returns a mutable reference to a layer
@@ -489,17 +2875,18 @@ impl Display for Chip {
         // NumMovedCellInst <movedCellInstCount>
         writeln!(f, "NumMovedCellInst {}", self.already_moved)?;
 
+        // cells and nets go by id, and routes are sorted, so that the same chip is always written the same
         let mut num_moved = 0;
-        for cell in self.cells.iter() {
-            if cell.moved {
-                num_moved += 1;
-            }
+        for cell in self.cells.iter().filter(|cell| cell.moved) {
+            num_moved += 1;
             writeln!(f, "{}", cell)?;
         }
         debug_assert_eq!(num_moved, self.already_moved);
 
         // NumRoutes <routeSegmentCount>
-        writeln!(f, "NumRoutes {}", self.nets.len())?;
+        // routes are merged as they are written, see `Net::merged`
+        let num_routes: usize = self.nets.par_iter().map(|net| net.merged().len()).sum();
+        writeln!(f, "NumRoutes {}", num_routes)?;
 
         // `fold_with + reduce_with` is the parallel iterators' equivalent to `fold_with` of iterators
         let names: String = self
@@ -507,9 +2894,43 @@ impl Display for Chip {
             .par_iter()
             .map(ToString::to_string)
             .fold_with(String::new(), accumulate)
-            .reduce_with(accumulate)
-            .ok_or(FmtError)?;
+            .reduce(String::new, accumulate);
 
         write!(f, "{}", names)
     }
 }
+
+/// `len` empty lists, reusing `lists` and the lists in it.
+fn recycle_lists(mut lists: Vec<Vec<usize>>, len: usize) -> Vec<Vec<usize>> {
+    lists.iter_mut().for_each(Vec::clear);
+    lists.resize_with(len, Vec::new);
+    lists
+}
+
+/// Adds to an error where it happened: near `line`, in the record `at`.
+fn locate(err: Error, line: usize, at: (&str, usize)) -> Error {
+    match at {
+        (record, 0) => anyhow!("Near line {}, in {}: {}", line, record, err),
+        (record, idx) => anyhow!("Near line {}, in {} #{}: {}", line, record, idx, err),
+    }
+}
+
+/// Parses a section of an input starting at a line with `parse`, locating errors.
+/// The section must be parsed to its end, there is nothing to tolerate in between sections.
+/// Returns what has been parsed, and a report of the warnings of the section.
+fn parse_section<'a, P, R>((content, line): (&'a str, usize), parse: P) -> Result<(R, Report)>
+where
+    P: FnOnce(&mut Lookahead<Tokens<'a>>, &mut Report, &mut (&'static str, usize)) -> Result<R>,
+{
+    let mut report = Report::default();
+    let mut at = ("MaxCellMove", 0);
+    let tokens = &mut Lookahead::new(Tokens::at_line(content, line));
+
+    let parsed =
+        parse(tokens, &mut report, &mut at).map_err(|err| locate(err, tokens.line(), at))?;
+    if let Some(token) = tokens.next() {
+        let err = anyhow!("Expected the end of the section, found {:?}", token);
+        return Err(locate(err, tokens.line(), ("end of section", 0)));
+    }
+    Ok((parsed, report))
+}
@@ -1,8 +1,13 @@
-use anyhow::{Error, Result};
+use crate::{
+    packed::PackedRoutes,
+    utilities::{to_external, to_internal},
+};
+use anyhow::{anyhow, Error, Result};
 use num::Num;
 use std::{
+    borrow::Cow,
     cmp,
-    collections::HashSet,
+    collections::{HashMap, HashSet},
     fmt::{Display, Error as FmtError, Formatter, Result as FmtResult},
     ops,
     str::FromStr,
@@ -25,18 +30,32 @@ pub trait FactoryID {
     where
         Error: From<<usize as FromStr>::Err>,
     {
-        // subtracted by one because of the offset
-        let length = Self::prefix().len();
+        let number = match name.strip_prefix(Self::prefix()) {
+            Some(number) => number,
+            None => {
+                return Err(anyhow!(
+                    "Expected a name starting with {:?}, found {:?}",
+                    Self::prefix(),
+                    name
+                ))
+            }
+        };
 
-        let parsednum = name[length..].parse::<usize>().map_err(Error::from)?;
-        let id = parsednum - 1;
-        Ok(id)
+        // subtracted by one because of the offset
+        let parsednum = number.parse::<usize>().map_err(|_| {
+            anyhow!(
+                "Expected a number after {:?}, found {:?}",
+                Self::prefix(),
+                name
+            )
+        })?;
+        to_internal(parsednum)
     }
 
     /// Converts from usize to String.
     fn from_num(id: usize) -> Result<String> {
         // added by one because of the offset
-        let strnum = id + 1;
+        let strnum = to_external(id);
         Ok(format!("{}{}", Self::prefix(), strnum))
     }
 }
@@ -56,12 +75,30 @@ pub enum ConflictType {
 }
 
 /// Whether a cell is movable
-#[derive(Debug)]
+#[derive(Clone, Copy, Debug, Eq, Hash, PartialEq)]
 pub enum CellType {
     Movable,
     Fixed,
 }
 
+/// How a via consumes the supply of the layers it goes through
+#[derive(Clone, Copy, Debug, Eq, Hash, PartialEq)]
+pub enum ViaModel {
+    /// on every layer, from the bottom one to the top one
+    Both,
+    /// on every layer but the bottom one
+    Upper,
+}
+
+/// How path search treats moves against the direction of a layer
+#[derive(Clone, Copy, Debug, Eq, Hash, PartialEq)]
+pub enum WrongWay {
+    /// never made
+    Refused,
+    /// made at a cost of this many grids more
+    Penalized(usize),
+}
+
 /// Towards a direction
 #[derive(Clone, Copy, Debug, Eq, Hash, PartialEq)]
 pub enum Towards {
@@ -73,20 +110,43 @@ pub enum Towards {
     Bottom,
 }
 
+/// Which pass of the flow committed a route segment
+#[derive(Clone, Copy, Debug, Eq, Hash, Ord, PartialEq, PartialOrd)]
+pub enum Provenance {
+    /// read from the input
+    Input,
+    /// routed by patterns
+    Pattern,
+    /// routed by the given iteration of maze routing
+    Maze(usize),
+    /// routed to repair a net broken by a moved cell
+    Repair,
+    /// taken from another solution by an ensemble
+    Ensemble,
+    /// merged from the solution of a tile
+    Tiles,
+    /// reused from a previous version of the input
+    WarmStart,
+    /// restored from the best solution seen, as by a restart
+    Restart,
+    /// read from an applied output file
+    Applied,
+}
+
 /// A 2-dimension tuple representing a Pair.
-#[derive(Clone, Copy, Debug, Default, Eq, Hash, PartialEq)]
+#[derive(Clone, Copy, Debug, Default, Eq, Hash, Ord, PartialEq, PartialOrd)]
 pub struct Pair<T>(pub T, pub T)
 where
     T: Copy + Num;
 
 /// A 3-dimension tuple representing a Point.
-#[derive(Clone, Copy, Debug, Default, Eq, Hash, PartialEq)]
+#[derive(Clone, Copy, Debug, Default, Eq, Hash, Ord, PartialEq, PartialOrd)]
 pub struct Point<T>(pub T, pub T, pub T)
 where
     T: Copy + Num;
 
 /// A source point and a target point representing a Route.
-#[derive(Clone, Copy, Debug, Default, Eq, Hash, PartialEq)]
+#[derive(Clone, Copy, Debug, Default, Eq, Hash, Ord, PartialEq, PartialOrd)]
 pub struct Route<T>(pub Point<T>, pub Point<T>)
 where
     T: Copy + Num;
@@ -100,6 +160,10 @@ pub struct Layer {
     pub direction: Direction,
     /// dimensions
     pub dim: Pair<usize>,
+    /// default supply of a grid
+    pub supply: usize,
+    /// non default supplies as (grid, change), in the order read
+    pub adjustments: Vec<(Pair<usize>, isize)>,
     /// all grids' capacity
     pub capacity: Vec<usize>,
 }
@@ -154,6 +218,8 @@ pub struct Conflict {
 pub struct Cell {
     /// id of the cell
     pub id: usize,
+    /// id of the mastercell
+    pub mastercell: usize,
     /// if the cell can be moved
     pub movable: CellType,
     /// whether the cell has moved
@@ -164,6 +230,28 @@ pub struct Cell {
     pub pins: Vec<usize>,
 }
 
+/// A region some cells must stay in.
+#[derive(Clone, Debug, Default, Eq, PartialEq)]
+pub struct VoltageArea {
+    /// name of the area
+    pub name: String,
+    /// grids of the area
+    pub grids: HashSet<Pair<usize>>,
+    /// cells restricted to the area
+    pub cells: Vec<usize>,
+}
+
+/// A pin of a net resolved to where it is.
+#[derive(Clone, Copy, Debug, Eq, Hash, PartialEq)]
+pub struct PinRef {
+    /// id of the cell
+    pub cell: usize,
+    /// id of the pin
+    pub pin: usize,
+    /// row and column of the cell, layer of the pin
+    pub position: Point<usize>,
+}
+
 /// Pointer points to the nearby node.
 #[derive(Clone, Copy, Debug, Eq, Hash, PartialEq)]
 pub struct Pointer {
@@ -201,7 +289,16 @@ pub struct Net {
     pub id: usize,
     /// min layer id
     pub min_layer: usize,
-    // TODO: fields that backs the actual implementation
+    /// pins as (cell id, pin id)
+    pub pins: Vec<(usize, usize)>,
+    /// route segments
+    pub routes: HashSet<Route<usize>>,
+    /// route segments while packed, in which case `routes` is empty
+    pub packed: PackedRoutes,
+    /// route segments as read, packed
+    pub initial: PackedRoutes,
+    /// whether the net still needs to be solved
+    pub dirty: bool,
 }
 
 impl<T> Pair<T>
@@ -276,6 +373,84 @@ where
     }
 }
 
+impl Pair<usize> {
+    /// Converts from 1-based indices in files.
+    pub fn internal(&self) -> Result<Self> {
+        Ok(Pair(to_internal(self.x())?, to_internal(self.y())?))
+    }
+
+    /// Converts to 1-based indices in files.
+    pub fn external(&self) -> Self {
+        Pair(to_external(self.x()), to_external(self.y()))
+    }
+
+    /// The grid `drow` rows and `dcol` columns away, if it is on a grid of `dim`.
+    /// Grids off the edges are `None` rather than clamped or wrapped around.
+    pub fn offset(&self, drow: isize, dcol: isize, dim: Pair<usize>) -> Option<Self> {
+        let &Pair(row, col) = self;
+        let Pair(rows, cols) = dim;
+
+        let row = (row as isize).checked_add(drow)?;
+        let col = (col as isize).checked_add(dcol)?;
+        if row < 0 || col < 0 || row as usize >= rows || col as usize >= cols {
+            return None;
+        }
+        Some(Pair(row as usize, col as usize))
+    }
+
+    /// The grids left and right of this one (same row) on a grid of `dim`,
+    /// fewer at the edges.
+    pub fn horizontal_neighbors(&self, dim: Pair<usize>) -> Vec<Self> {
+        [self.offset(0, -1, dim), self.offset(0, 1, dim)]
+            .iter()
+            .flatten()
+            .copied()
+            .collect()
+    }
+
+    /// The grids above and below this one (same column) on a grid of `dim`,
+    /// fewer at the edges.
+    pub fn vertical_neighbors(&self, dim: Pair<usize>) -> Vec<Self> {
+        [self.offset(-1, 0, dim), self.offset(1, 0, dim)]
+            .iter()
+            .flatten()
+            .copied()
+            .collect()
+    }
+}
+
+impl Point<usize> {
+    /// Converts from 1-based indices in files.
+    pub fn internal(&self) -> Result<Self> {
+        Ok(Point(
+            to_internal(self.row())?,
+            to_internal(self.col())?,
+            to_internal(self.lay())?,
+        ))
+    }
+
+    /// Converts to 1-based indices in files.
+    pub fn external(&self) -> Self {
+        Point(
+            to_external(self.row()),
+            to_external(self.col()),
+            to_external(self.lay()),
+        )
+    }
+}
+
+impl Route<usize> {
+    /// Converts from 1-based indices in files.
+    pub fn internal(&self) -> Result<Self> {
+        Ok(Route(self.source().internal()?, self.target().internal()?))
+    }
+
+    /// Converts to 1-based indices in files.
+    pub fn external(&self) -> Self {
+        Route(self.source().external(), self.target().external())
+    }
+}
+
 impl Layer {
     pub fn get_capacity(&self, row: usize, col: usize) -> Option<&usize> {
         self.capacity.get(row * self.dim.y() + col)
@@ -286,6 +461,13 @@ impl Layer {
     }
 }
 
+impl MasterCell {
+    /// Finds a pin by its id.
+    pub fn get_pin(&self, id: usize) -> Option<&MasterPin> {
+        self.pins.iter().find(|pin| pin.id == id)
+    }
+}
+
 impl FactoryID for Layer {
     fn prefix() -> &'static str {
         "M"
@@ -345,35 +527,181 @@ impl Route<usize> {
         )
     }
 
+    /// All the grids the route goes through, both ends included.
+    pub fn points(&self) -> impl Iterator<Item = Point<usize>> {
+        let Route(source, target) = *self;
+        let (rmin, rmax) = (
+            cmp::min(source.row(), target.row()),
+            cmp::max(source.row(), target.row()),
+        );
+        let (cmin, cmax) = (
+            cmp::min(source.col(), target.col()),
+            cmp::max(source.col(), target.col()),
+        );
+        let (lmin, lmax) = (
+            cmp::min(source.lay(), target.lay()),
+            cmp::max(source.lay(), target.lay()),
+        );
+
+        (rmin..=rmax).flat_map(move |row| {
+            (cmin..=cmax).flat_map(move |col| (lmin..=lmax).map(move |lay| Point(row, col, lay)))
+        })
+    }
+
+    /// Whether the route starts and ends on the same grid,
+    /// which marks a grid as used by the net, like a pin or a via would.
+    pub fn is_point(&self) -> bool {
+        self.source() == self.target()
+    }
+
+    /// The same route with its ends in order, so that a route and its reverse compare equal.
+    pub fn normalized(&self) -> Self {
+        let Route(source, target) = *self;
+        Route(cmp::min(source, target), cmp::max(source, target))
+    }
+
+    /// Checks that the route goes along a single axis.
+    pub fn validate(&self) -> Result<()> {
+        let Point(row, col, lay) = self.vector();
+        let axes = [row, col, lay].iter().filter(|&&len| len != 0).count();
+
+        if axes <= 1 {
+            Ok(())
+        } else {
+            Err(anyhow!("Route {} is diagonal", self.external()))
+        }
+    }
+
+    /// Splits a route into routes along a single axis,
+    /// going along rows first, then columns, then layers.
+    /// Every leg along rows or columns goes on the layer nearest to where it starts
+    /// whose direction it follows, joined to the others by vias.
+    /// Legs stay on their layer if no layer has their direction.
+    pub fn split(&self, layers: &[Layer]) -> Vec<Self> {
+        let Route(source, target) = *self;
+
+        // nearest layer of a direction, ties broken towards the target
+        let nearest = |lay: usize, direction: Direction| {
+            layers
+                .iter()
+                .filter(|layer| layer.direction == direction)
+                .min_by_key(|layer| {
+                    let distance = |to: usize| cmp::max(layer.id, to) - cmp::min(layer.id, to);
+                    (distance(lay), distance(target.lay()))
+                })
+                .map_or(lay, |layer| layer.id)
+        };
+
+        let mut corners = vec![source];
+        let mut at = source;
+        if at.row() != target.row() {
+            let lay = nearest(at.lay(), Direction::Vertical);
+            corners.push(Point(at.row(), at.col(), lay));
+            at = Point(target.row(), at.col(), lay);
+            corners.push(at);
+        }
+        if at.col() != target.col() {
+            let lay = nearest(at.lay(), Direction::Horizontal);
+            corners.push(Point(at.row(), at.col(), lay));
+            at = Point(at.row(), target.col(), lay);
+            corners.push(at);
+        }
+        corners.push(target);
+
+        corners
+            .windows(2)
+            .map(|pair| Route(pair[0], pair[1]))
+            .filter(|route| !route.is_point())
+            .collect()
+    }
+
     /// Categorizes the result of `vector`.
-    pub fn towards(&self) -> Towards {
+    /// Returns `None` if the route is a point, or diagonal as it goes nowhere in particular,
+    /// see `validate`.
+    pub fn towards(&self) -> Option<Towards> {
         match self.vector() {
-            // A vector can only be of (a, 0, 0), (0, b, 0), (0, 0, c) with a, b, c != 0
-            // Hence the unreachable arm.
-            Point(0, 0, 0) => unreachable!(),
-            Point(row, 0, 0) => {
-                if row > 0 {
-                    Towards::Right
-                } else {
-                    Towards::Left
+            // A validated route has a vector of (a, 0, 0), (0, b, 0) or (0, 0, c).
+            Point(0, 0, 0) => None,
+            Point(row, 0, 0) => Some(if row > 0 {
+                Towards::Right
+            } else {
+                Towards::Left
+            }),
+            Point(0, col, 0) => Some(if col > 0 { Towards::Up } else { Towards::Down }),
+            Point(0, 0, lay) => Some(if lay > 0 {
+                Towards::Top
+            } else {
+                Towards::Bottom
+            }),
+            _ => None,
+        }
+    }
+
+    /// Merges collinear routes that overlap or share an end into maximal routes,
+    /// and drops the points on grids the merged routes go through.
+    /// Diagonal routes are kept as they are.
+    /// The routes go through the same grids before and after.
+    pub fn merge(routes: &HashSet<Self>) -> HashSet<Self> {
+        // routes on the same line go along the same axis, with the other coordinates equal
+        let mut lines: HashMap<(usize, [usize; 3]), Vec<(usize, usize)>> = HashMap::new();
+        let mut points = Vec::new();
+        let mut merged = HashSet::new();
+        for route in routes {
+            let axis = match route.towards() {
+                None if route.is_point() => {
+                    points.push(*route);
+                    continue;
                 }
-            }
-            Point(0, col, 0) => {
-                if col > 0 {
-                    Towards::Up
-                } else {
-                    Towards::Down
+                None => {
+                    merged.insert(*route);
+                    continue;
                 }
-            }
-            Point(0, 0, lay) => {
-                if lay > 0 {
-                    Towards::Top
+                Some(Towards::Left) | Some(Towards::Right) => 0,
+                Some(Towards::Up) | Some(Towards::Down) => 1,
+                Some(Towards::Top) | Some(Towards::Bottom) => 2,
+            };
+            let Route(Point(sr, sc, sl), Point(tr, tc, tl)) = *route;
+            let (source, target) = ([sr, sc, sl], [tr, tc, tl]);
+
+            let mut line = source;
+            line[axis] = 0;
+            let (lo, hi) = (
+                cmp::min(source[axis], target[axis]),
+                cmp::max(source[axis], target[axis]),
+            );
+            lines.entry((axis, line)).or_default().push((lo, hi));
+        }
+
+        for ((axis, line), mut spans) in lines {
+            spans.sort_unstable();
+
+            let point = |at: usize| {
+                let mut coords = line;
+                coords[axis] = at;
+                Point(coords[0], coords[1], coords[2])
+            };
+            let mut spans = spans.into_iter();
+            let (mut lo, mut hi) = spans.next().expect("Lines have at least one route");
+            for (start, end) in spans {
+                // merged only when sharing a grid, as routes on next grids are not connected
+                if start <= hi {
+                    hi = cmp::max(hi, end);
                 } else {
-                    Towards::Bottom
+                    merged.insert(Route(point(lo), point(hi)));
+                    lo = start;
+                    hi = end;
                 }
             }
-            _ => unreachable!(),
+            merged.insert(Route(point(lo), point(hi)));
         }
+
+        let covered: HashSet<_> = merged.iter().flat_map(Route::points).collect();
+        merged.extend(
+            points
+                .into_iter()
+                .filter(|route| !covered.contains(&route.source())),
+        );
+        merged
     }
 }
 
@@ -402,13 +730,61 @@ impl ops::Neg for Towards {
     }
 }
 
+impl Default for ViaModel {
+    fn default() -> Self {
+        Self::Both
+    }
+}
+
+impl ViaModel {
+    /// The grids whose supply a route consumes.
+    /// Routes along a layer consume all the grids they go through.
+    pub fn points(self, route: Route<usize>) -> impl Iterator<Item = Point<usize>> {
+        let Route(source, target) = route;
+        let bottom = cmp::min(source.lay(), target.lay());
+        let skipped = self == Self::Upper && source.lay() != target.lay();
+
+        route
+            .points()
+            .filter(move |point| !(skipped && point.lay() == bottom))
+    }
+}
+
+impl Default for WrongWay {
+    fn default() -> Self {
+        Self::Refused
+    }
+}
+
+impl Default for Provenance {
+    fn default() -> Self {
+        Self::Input
+    }
+}
+
+impl Display for Provenance {
+    fn fmt(&self, f: &mut Formatter) -> FmtResult {
+        match self {
+            Self::Input => write!(f, "input"),
+            Self::Pattern => write!(f, "pattern"),
+            Self::Maze(iteration) => write!(f, "maze #{}", iteration),
+            Self::Repair => write!(f, "repair"),
+            Self::Ensemble => write!(f, "ensemble"),
+            Self::Tiles => write!(f, "tiles"),
+            Self::WarmStart => write!(f, "warm start"),
+            Self::Restart => write!(f, "restart"),
+            Self::Applied => write!(f, "applied"),
+        }
+    }
+}
+
 impl Display for Cell {
     fn fmt(&self, f: &mut Formatter) -> FmtResult {
         write!(
             f,
             "CellInst {} {}",
             Self::from_num(self.id).map_err(|_| FmtError)?,
-            self.position
+            self.position.external()
         )
     }
 }
@@ -443,12 +819,101 @@ impl PosNode {
     }
 }
 
-impl Net {}
+impl Net {
+    /// Removes the routes that are points on grids other routes already go through.
+    /// Points on grids no other route reaches are kept as markers.
+    /// Returns the number of removed routes.
+    pub fn remove_points(&mut self) -> usize {
+        let covered: HashSet<_> = self
+            .routes
+            .iter()
+            .filter(|route| !route.is_point())
+            .flat_map(Route::points)
+            .collect();
+
+        let before = self.routes.len();
+        self.routes
+            .retain(|route| !route.is_point() || !covered.contains(&route.source()));
+        before - self.routes.len()
+    }
+
+    /// Merges the collinear routes that overlap or share an end, see `Route::merge`.
+    /// Returns the number of routes fewer.
+    pub fn merge_segments(&mut self) -> usize {
+        let before = self.routes.len();
+        self.routes = Route::merge(&self.routes);
+        before - self.routes.len()
+    }
+
+    /// The routes with collinear ones merged, as they are written out.
+    pub fn merged(&self) -> HashSet<Route<usize>> {
+        Route::merge(&self.segments())
+    }
+
+    /// Packs the routes to save memory while the net is not processed.
+    pub fn pack(&mut self) {
+        if !self.routes.is_empty() {
+            self.packed = PackedRoutes::pack(&self.routes);
+            self.routes = HashSet::new();
+        }
+    }
+
+    /// Unpacks the routes for the net to be processed.
+    pub fn unpack(&mut self) {
+        if !self.packed.is_empty() {
+            self.routes = self.packed.unpack();
+            self.packed = PackedRoutes::default();
+        }
+    }
+
+    /// The routes, decoded on the fly if packed.
+    pub fn segments(&self) -> Cow<'_, HashSet<Route<usize>>> {
+        if self.packed.is_empty() {
+            Cow::Borrowed(&self.routes)
+        } else {
+            Cow::Owned(self.packed.unpack())
+        }
+    }
+
+    /// Number of route segments, packed or not.
+    pub fn num_routes(&self) -> usize {
+        self.routes.len() + self.packed.len()
+    }
+
+    /// Route segments added and removed since the net was read, each sorted.
+    pub fn delta(&self) -> (Vec<Route<usize>>, Vec<Route<usize>>) {
+        let current = self.segments();
+        let initial = self.initial.unpack();
+
+        let mut added: Vec<_> = current.difference(&initial).copied().collect();
+        let mut removed: Vec<_> = initial.difference(&current).copied().collect();
+        added.sort_unstable();
+        removed.sort_unstable();
+        (added, removed)
+    }
+
+    /// The wirelength of the net, which is the number of grids its routes go through.
+    pub fn length(&self) -> usize {
+        self.segments()
+            .iter()
+            .flat_map(Route::points)
+            .collect::<HashSet<_>>()
+            .len()
+    }
+}
 
 impl Display for Net {
-    /// Converts `Net` to `String`
-    fn fmt(&self, _f: &mut Formatter) -> FmtResult {
-        unimplemented!()
+    /// Converts `Net` to `String`, with routes merged and sorted
+    fn fmt(&self, f: &mut Formatter) -> FmtResult {
+        let name = Self::from_num(self.id).map_err(|_| FmtError)?;
+        let segments = self.merged();
+        let mut sorted: Vec<_> = segments.iter().collect();
+        sorted.sort_unstable();
+
+        for route in sorted {
+            writeln!(f, "{} {}", route.external(), name)?;
+        }
+        Ok(())
     }
 }
 
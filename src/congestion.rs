@@ -0,0 +1,160 @@
+use crate::{
+    components::{Pair, Point},
+    grid::RoutingGrid,
+};
+use std::cmp;
+
+/// Demand over supply, infinite if there is demand but no supply.
+fn ratio(demand: usize, supply: usize) -> f64 {
+    match supply {
+        0 if demand == 0 => 0.,
+        0 => f64::INFINITY,
+        _ => demand as f64 / supply as f64,
+    }
+}
+
+/// Utilization (demand over supply) of every grid of a routing grid,
+/// of every GCell (all the layers of a row and column) and of every layer.
+#[derive(Clone, Debug, Default, PartialEq)]
+pub struct CongestionMap {
+    /// rows and columns
+    pub dim: Pair<usize>,
+    /// number of layers
+    pub layers: usize,
+    /// utilization of every grid, indexed like `RoutingGrid::index`
+    grids: Vec<f64>,
+    /// demand and supply of every GCell, row by row
+    gcells: Vec<(usize, usize)>,
+    /// demand and supply of every layer
+    per_layer: Vec<(usize, usize)>,
+}
+
+impl CongestionMap {
+    /// The congestion of a routing grid, as it currently is.
+    pub fn new(grid: &RoutingGrid) -> Self {
+        let size = grid.dim.size();
+
+        let grids = grid
+            .gcells()
+            .iter()
+            .map(|gcell| ratio(gcell.demand(), gcell.supply()))
+            .collect();
+
+        let mut gcells = vec![(0, 0); size];
+        let mut per_layer = vec![(0, 0); grid.layers];
+        for (idx, gcell) in grid.gcells().iter().enumerate() {
+            let (demand, supply) = (gcell.demand(), gcell.supply());
+            let gcell = &mut gcells[idx % size];
+            gcell.0 += demand;
+            gcell.1 += supply;
+            let layer = &mut per_layer[idx / size];
+            layer.0 += demand;
+            layer.1 += supply;
+        }
+
+        Self {
+            dim: grid.dim,
+            layers: grid.layers,
+            grids,
+            gcells,
+            per_layer,
+        }
+    }
+
+    /// Utilization of a grid.
+    pub fn grid(&self, point: Point<usize>) -> f64 {
+        let Pair(_, cols) = self.dim;
+        self.grids[point.lay() * self.dim.size() + point.row() * cols + point.col()]
+    }
+
+    /// Utilization of a GCell, over all its layers.
+    pub fn gcell(&self, pos: Pair<usize>) -> f64 {
+        let (demand, supply) = self.gcells[pos.x() * self.dim.y() + pos.y()];
+        ratio(demand, supply)
+    }
+
+    /// Utilization of a layer, over all its grids.
+    pub fn layer(&self, lay: usize) -> f64 {
+        let (demand, supply) = self.per_layer[lay];
+        ratio(demand, supply)
+    }
+
+    /// The `count` most utilized grids with their utilization, the most utilized first.
+    pub fn hottest_grids(&self, count: usize) -> Vec<(Point<usize>, f64)> {
+        let Pair(rows, cols) = self.dim;
+        let mut grids: Vec<_> = self
+            .grids
+            .iter()
+            .enumerate()
+            .map(|(idx, &utilization)| {
+                let (lay, rest) = (idx / (rows * cols), idx % (rows * cols));
+                (Point(rest / cols, rest % cols, lay), utilization)
+            })
+            .collect();
+        grids.sort_by(|(a, x), (b, y)| y.partial_cmp(x).expect("NaN utilization").then(a.cmp(b)));
+        grids.truncate(count);
+        grids
+    }
+
+    /// The `count` most utilized regions of `size` × `size` GCells which do not overlap,
+    /// as their top left GCell and their utilization over all their layers,
+    /// the most utilized first. Regions are clipped to the chip.
+    pub fn hottest_regions(&self, size: usize, count: usize) -> Vec<(Pair<usize>, f64)> {
+        let Pair(rows, cols) = self.dim;
+        let size = cmp::max(size, 1);
+        let (height, width) = (cmp::min(size, rows), cmp::min(size, cols));
+        if height == 0 || width == 0 {
+            return Vec::new();
+        }
+
+        // sums of demand and supply of the GCells above and left of every GCell, exclusive
+        let mut sums = vec![(0, 0); (rows + 1) * (cols + 1)];
+        for row in 0..rows {
+            for col in 0..cols {
+                let (demand, supply) = self.gcells[row * cols + col];
+                let at = |row: usize, col: usize| sums[row * (cols + 1) + col];
+                let (up, left, both) = (at(row, col + 1), at(row + 1, col), at(row, col));
+                sums[(row + 1) * (cols + 1) + col + 1] = (
+                    demand + up.0 + left.0 - both.0,
+                    supply + up.1 + left.1 - both.1,
+                );
+            }
+        }
+        let window = |row: usize, col: usize| {
+            let at = |row: usize, col: usize| sums[row * (cols + 1) + col];
+            let (end, up, left, both) = (
+                at(row + height, col + width),
+                at(row, col + width),
+                at(row + height, col),
+                at(row, col),
+            );
+            ratio(
+                end.0 + both.0 - up.0 - left.0,
+                end.1 + both.1 - up.1 - left.1,
+            )
+        };
+
+        let mut windows: Vec<_> = (0..=rows - height)
+            .flat_map(|row| (0..=cols - width).map(move |col| Pair(row, col)))
+            .map(|pos| (pos, window(pos.x(), pos.y())))
+            .collect();
+        windows.sort_by(|(a, x), (b, y)| y.partial_cmp(x).expect("NaN utilization").then(a.cmp(b)));
+
+        let mut regions: Vec<(Pair<usize>, f64)> = Vec::new();
+        for (pos, utilization) in windows {
+            if regions.len() >= count {
+                break;
+            }
+            let overlaps = regions.iter().any(|(other, _)| {
+                pos.x() < other.x() + height
+                    && other.x() < pos.x() + height
+                    && pos.y() < other.y() + width
+                    && other.y() < pos.y() + width
+            });
+            if !overlaps {
+                regions.push((pos, utilization));
+            }
+        }
+        regions
+    }
+}
@@ -1,3 +1,19 @@
 pub const SECS_PER_MIN: u64 = 60;
 pub const MINS_PER_HR: u64 = 60;
 pub const SECS_PER_HR: u64 = SECS_PER_MIN * MINS_PER_HR;
+pub const SLICE_MILLIS: u64 = 50;
+pub const FLUSH_SECS: u64 = 60;
+pub const BOX_MARGIN: usize = 2;
+pub const MAX_BOX_MARGIN: usize = 64;
+pub const MOVE_AFTER_FAILURES: usize = 3;
+pub const MAX_TOLERANCE: usize = 4;
+pub const BOOKSHELF_GCELL_ROWS: usize = 4;
+pub const BOOKSHELF_LAYERS: usize = 4;
+pub const BOOKSHELF_SUPPLY: usize = 20;
+pub const PLATEAU_CHECK_SECS: u64 = 1;
+pub const RESTART_MOVES: usize = 4;
+pub const DASHBOARD_MILLIS: u64 = 500;
+pub const EXACT_STEINER_PINS: usize = 4;
+pub const GRID_COST: usize = 100;
+pub const CANDIDATE_MOVES: usize = 8;
+pub const CORRIDOR_COST: usize = 4;
@@ -0,0 +1,80 @@
+use crate::{
+    components::{FactoryID, Net},
+    utilities,
+};
+use anyhow::{anyhow, Result};
+use std::{collections::HashMap, fs};
+
+/// Criticality of nets, as given by a timing file.
+/// Critical nets weigh more in the wirelength, and some must not be longer than required,
+/// which makes outputs where they are illegal.
+#[derive(Clone, Debug, Default, PartialEq)]
+pub struct Criticality {
+    /// weight of the wirelength of every net, 1 if missing
+    pub weights: HashMap<usize, f64>,
+    /// maximum length of some nets, in grids
+    pub max_lengths: HashMap<usize, usize>,
+}
+
+impl Criticality {
+    /// Reads criticality from a file.
+    pub fn read_file(filename: &str) -> Result<Self> {
+        let content: String = fs::read_to_string(filename)?;
+        Self::read_str(&content)
+    }
+
+    /// Reads criticality from a string.
+    /// Every entry is either `Weight <netName> <weight>` or `MaxLength <netName> <grids>`.
+    pub fn read_str(content: &str) -> Result<Self> {
+        use utilities::{parse_numeric, parse_string};
+
+        let content = &mut content.split_whitespace();
+        let mut criticality = Self::default();
+
+        while let Some(keyword) = content.next() {
+            let name = parse_string(content)?;
+            let net = Net::from_str(name)?;
+
+            match keyword {
+                "Weight" => {
+                    let weight: f64 = parse_numeric(content)?;
+                    if !(weight >= 0.) {
+                        return Err(anyhow!("Weight {} of {} is negative", weight, name));
+                    }
+                    criticality.weights.insert(net, weight);
+                }
+                "MaxLength" => {
+                    let length: usize = parse_numeric(content)?;
+                    criticality.max_lengths.insert(net, length);
+                }
+                _ => return Err(anyhow!("Expected Weight or MaxLength, found {}", keyword)),
+            }
+        }
+
+        Ok(criticality)
+    }
+
+    /// Weight of the wirelength of a net.
+    pub fn weight(&self, net: usize) -> f64 {
+        self.weights.get(&net).copied().unwrap_or(1.)
+    }
+
+    /// Maximum length of a net, if any.
+    pub fn max_length(&self, net: usize) -> Option<usize> {
+        self.max_lengths.get(&net).copied()
+    }
+
+    /// Whether a net of `length` grids is longer than allowed.
+    pub fn over_length(&self, net: usize, length: usize) -> bool {
+        self.max_length(net).map_or(false, |max| length > max)
+    }
+
+    /// The highest id of a net mentioned, if any.
+    pub fn max_net(&self) -> Option<usize> {
+        self.weights
+            .keys()
+            .chain(self.max_lengths.keys())
+            .copied()
+            .max()
+    }
+}
@@ -0,0 +1,142 @@
+use crate::{
+    chip::Chip,
+    scheduler::{Poll, Task},
+};
+use anyhow::Result;
+use std::{
+    fmt::Write as FmtWrite,
+    io::{self, Write},
+    time::{Duration, Instant},
+};
+
+/// Clears the line of the cursor.
+const CLEAR_LINE: &str = "\x1b[2K";
+/// Starts bold text.
+const BOLD: &str = "\x1b[1m";
+/// Ends bold text.
+const RESET: &str = "\x1b[0m";
+
+/// A live summary of a run, redrawn in place on the terminal instead of scrolling logs:
+/// the wirelength, the overflow, the moves used, the phase and the time left.
+/// Plain ANSI escape codes, on stderr.
+#[derive(Debug)]
+pub struct Dashboard {
+    /// time the run started
+    start: Instant,
+    /// time the run must end
+    deadline: Instant,
+    /// time between two redraws
+    period: Duration,
+    /// time of the last redraw
+    last: Option<Instant>,
+    /// number of lines drawn last time, to be drawn over
+    lines: usize,
+}
+
+impl Dashboard {
+    /// Creates a dashboard of a run from `start` to `deadline`, redrawn every `period`.
+    pub fn new(start: Instant, deadline: Instant, period: Duration) -> Self {
+        Self {
+            start,
+            deadline,
+            period,
+            last: None,
+            lines: 0,
+        }
+    }
+
+    /// What the run is doing, judging by what is left to do.
+    fn phase(chip: &Chip) -> String {
+        let broken = chip.broken_nets().len();
+        if broken > 0 {
+            return format!("repairing {} broken nets", broken);
+        }
+        let over_length = chip.over_length_nets().len();
+        if over_length > 0 {
+            return format!("shortening {} critical nets", over_length);
+        }
+        match chip.improvable_nets().len() {
+            0 => "idle, nothing left to improve".to_string(),
+            nets => format!("improving {} nets", nets),
+        }
+    }
+
+    /// The lines of the dashboard.
+    fn render(&self, chip: &Chip) -> Result<Vec<String>> {
+        let now = Instant::now();
+        let elapsed = now - self.start;
+        let left = self.deadline.saturating_duration_since(now);
+
+        Ok(vec![
+            format!(
+                "{}Wirelength{} {:.2}, {:.2}% better than the initial {:.2}",
+                BOLD,
+                RESET,
+                chip.wirelength(),
+                chip.improvement(),
+                chip.baseline
+            ),
+            format!(
+                "{}Overflow{}   {} grids",
+                BOLD,
+                RESET,
+                chip.overflowed_grids()
+            ),
+            format!(
+                "{}Moves{}      {} / {}",
+                BOLD, RESET, chip.already_moved, chip.max_move
+            ),
+            format!("{}Phase{}      {}", BOLD, RESET, Self::phase(chip)),
+            format!(
+                "{}Time{}       {}s elapsed, {}s left",
+                BOLD,
+                RESET,
+                elapsed.as_secs(),
+                left.as_secs()
+            ),
+        ])
+    }
+
+    /// Draws the dashboard over the previous one.
+    pub fn draw(&mut self, chip: &Chip) -> Result<()> {
+        let lines = self.render(chip)?;
+
+        let mut text = String::new();
+        if self.lines > 0 {
+            // back to the first line of the previous dashboard
+            write!(text, "\x1b[{}A", self.lines)?;
+        }
+        for line in lines.iter() {
+            writeln!(text, "\r{}{}", CLEAR_LINE, line)?;
+        }
+
+        let stderr = io::stderr();
+        let mut stderr = stderr.lock();
+        stderr.write_all(text.as_bytes())?;
+        stderr.flush()?;
+
+        self.lines = lines.len();
+        self.last = Some(Instant::now());
+        Ok(())
+    }
+}
+
+impl Task for Dashboard {
+    fn name(&self) -> &str {
+        "dashboard"
+    }
+
+    fn step(&mut self, chip: &mut Chip, _until: Instant) -> Result<Poll> {
+        let due = self.last.map_or(true, |last| last.elapsed() >= self.period);
+        if due {
+            self.draw(chip)?;
+        }
+
+        Ok(Poll::Pending)
+    }
+
+    fn finish(&mut self, chip: &mut Chip) -> Result<()> {
+        // the final state, whenever the last redraw was
+        self.draw(chip)
+    }
+}
@@ -0,0 +1,176 @@
+use crate::{
+    components::{Pair, Point},
+    topology::Topology,
+    utilities::UnionFind,
+};
+use std::collections::HashMap;
+
+/// A connection between two pins of a net to route, along edges of its topology.
+#[derive(Clone, Debug, Eq, Hash, PartialEq)]
+pub struct TwoPinTask {
+    /// pin already connected when the task is routed
+    pub source: Point<usize>,
+    /// pin the task connects
+    pub target: Point<usize>,
+    /// edges of the topology from `source` to `target`, by index, none for a via between stacked pins
+    pub edges: Vec<usize>,
+}
+
+/// The 2-pin tasks of a multi-pin net, ordered so that the source of every task
+/// is connected by the tasks before, with which tasks go along every edge of the topology.
+/// Tasks share edges from a pin to a Steiner point, so that ripping up one of them
+/// may take the others along, see `subnet`.
+#[derive(Clone, Debug, Default, Eq, PartialEq)]
+pub struct Decomposition {
+    /// tasks in the order to route them
+    pub tasks: Vec<TwoPinTask>,
+    /// tasks going along every edge of the topology, by index in `tasks`
+    pub edge_tasks: Vec<Vec<usize>>,
+}
+
+impl Decomposition {
+    /// Decomposes a net with pins at `pins` along `topology`, a tree over the grids of the pins.
+    /// The tree is walked from its first pin, breadth first, and every pin reached
+    /// is connected to the nearest pin on the way back, through the Steiner points between.
+    /// Pins on the grid of a pin before them are connected to that one by a via, once it is.
+    pub fn new(topology: &Topology, pins: &[Point<usize>]) -> Self {
+        // the first pin on every grid, and the others on it to connect by vias
+        let mut first: HashMap<Pair<usize>, Point<usize>> = HashMap::new();
+        let mut stacked: HashMap<Pair<usize>, Vec<Point<usize>>> = HashMap::new();
+        for &pin in pins {
+            let kept = *first.entry(pin.flatten()).or_insert(pin);
+            let others = stacked.entry(pin.flatten()).or_default();
+            if kept != pin && !others.contains(&pin) {
+                others.push(pin);
+            }
+        }
+        let mut tasks = Vec::new();
+        let mut stack = |tasks: &mut Vec<TwoPinTask>, source: Point<usize>| {
+            for target in stacked.remove(&source.flatten()).unwrap_or_default() {
+                tasks.push(TwoPinTask {
+                    source,
+                    target,
+                    edges: Vec::new(),
+                });
+            }
+        };
+
+        // pin of every point of the topology, none for Steiner points
+        let pin_of: Vec<_> = topology
+            .points
+            .iter()
+            .enumerate()
+            .map(|(idx, grid)| {
+                if idx < topology.pins {
+                    first.get(grid).copied()
+                } else {
+                    None
+                }
+            })
+            .collect();
+
+        let len = topology.points.len();
+        let mut adjacent = vec![Vec::new(); len];
+        for (edge, &(a, b)) in topology.edges.iter().enumerate() {
+            adjacent[a].push((b, edge));
+            adjacent[b].push((a, edge));
+        }
+
+        // points in breadth first order, with the point and the edge each is reached from
+        let mut order = Vec::with_capacity(len);
+        let mut parent: Vec<Option<(usize, usize)>> = vec![None; len];
+        let mut seen = vec![false; len];
+        if len > 0 {
+            seen[0] = true;
+            order.push(0);
+        }
+        let mut head = 0;
+        while head < order.len() {
+            let point = order[head];
+            head += 1;
+            for &(next, edge) in adjacent[point].iter() {
+                if !seen[next] {
+                    seen[next] = true;
+                    parent[next] = Some((point, edge));
+                    order.push(next);
+                }
+            }
+        }
+
+        if let Some(&Some(root)) = pin_of.first() {
+            stack(&mut tasks, root);
+        }
+        for &point in order.iter().skip(1) {
+            let target = match pin_of[point] {
+                Some(pin) => pin,
+                None => continue,
+            };
+
+            let mut edges = Vec::new();
+            let mut at = point;
+            let source = loop {
+                let (up, edge) = parent[at].expect("Points reached have a parent");
+                edges.push(edge);
+                at = up;
+                if let Some(pin) = pin_of[at] {
+                    break pin;
+                }
+            };
+            edges.reverse();
+
+            tasks.push(TwoPinTask {
+                source,
+                target,
+                edges,
+            });
+            stack(&mut tasks, target);
+        }
+
+        let mut edge_tasks = vec![Vec::new(); topology.edges.len()];
+        for (idx, task) in tasks.iter().enumerate() {
+            for &edge in task.edges.iter() {
+                edge_tasks[edge].push(idx);
+            }
+        }
+
+        Self { tasks, edge_tasks }
+    }
+
+    /// Number of tasks.
+    pub fn len(&self) -> usize {
+        self.tasks.len()
+    }
+
+    /// Whether there is no task.
+    pub fn is_empty(&self) -> bool {
+        self.tasks.is_empty()
+    }
+
+    /// The other tasks going along an edge of a task, sorted.
+    pub fn shared_with(&self, task: usize) -> Vec<usize> {
+        let mut shared: Vec<_> = self.tasks[task]
+            .edges
+            .iter()
+            .flat_map(|&edge| self.edge_tasks[edge].iter().copied())
+            .filter(|&other| other != task)
+            .collect();
+        shared.sort_unstable();
+        shared.dedup();
+        shared
+    }
+
+    /// The tasks tied to a task by shared edges, even through other tasks, itself included, sorted.
+    /// Ripping up and rerouting them together keeps the edges they share in one piece.
+    pub fn subnet(&self, task: usize) -> Vec<usize> {
+        let mut groups = UnionFind::new(self.tasks.len());
+        for tasks in self.edge_tasks.iter() {
+            for pair in tasks.windows(2) {
+                groups.union(pair[0], pair[1]);
+            }
+        }
+
+        (0..self.tasks.len())
+            .filter(|&other| groups.grouped(task, other) == Some(true))
+            .collect()
+    }
+}
@@ -0,0 +1,97 @@
+use crate::consts::{BOX_MARGIN, MAX_BOX_MARGIN, MAX_TOLERANCE, MOVE_AFTER_FAILURES};
+use std::collections::{HashMap, VecDeque};
+
+/// How hard to try routing a net that failed before.
+#[derive(Clone, Copy, Debug, Default, Eq, Hash, PartialEq)]
+pub struct Escalation {
+    /// number of grids the bounding box is expanded by on every side
+    pub margin: usize,
+    /// overflow allowed on every grid
+    pub tolerance: usize,
+    /// whether cells should be moved to open a path
+    pub move_cells: bool,
+}
+
+/// Nets that failed to route, waiting for another try.
+/// Every failure escalates the effort put into a net:
+/// its bounding box doubles, more overflow is tolerated,
+/// and after a few failures cells around it get moved.
+#[derive(Clone, Debug, Default)]
+pub struct Deferred {
+    /// number of failures of every net
+    failures: HashMap<usize, usize>,
+    /// nets waiting, in order of failure
+    queue: VecDeque<usize>,
+}
+
+impl Escalation {
+    /// The escalation after `failures` failures.
+    /// The margin and the tolerance stop growing at their max.
+    pub fn after(failures: usize) -> Self {
+        // doubled explicitly, as shifting would drop the bits pushed out
+        let mut margin = BOX_MARGIN;
+        for _ in 0..failures {
+            if margin >= MAX_BOX_MARGIN {
+                break;
+            }
+            margin = margin.saturating_mul(2);
+        }
+
+        Self {
+            margin: margin.min(MAX_BOX_MARGIN),
+            tolerance: failures.min(MAX_TOLERANCE),
+            move_cells: failures >= MOVE_AFTER_FAILURES,
+        }
+    }
+}
+
+impl Deferred {
+    /// Creates an empty queue.
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Number of nets waiting.
+    pub fn len(&self) -> usize {
+        self.queue.len()
+    }
+
+    /// Whether no net is waiting.
+    pub fn is_empty(&self) -> bool {
+        self.queue.is_empty()
+    }
+
+    /// Records a failure of a net and puts it at the back of the queue.
+    /// Gives up on a net failing at the highest escalation, which is forgotten instead.
+    /// Returns whether the net is waiting for another try.
+    pub fn defer(&mut self, net: usize) -> bool {
+        let failures = self.failures.get(&net).copied().unwrap_or(0);
+        if Escalation::after(failures) == Escalation::after(failures + 1) {
+            self.succeed(net);
+            return false;
+        }
+
+        self.failures.insert(net, failures + 1);
+        if !self.queue.contains(&net) {
+            self.queue.push_back(net);
+        }
+        true
+    }
+
+    /// Records a success of a net, which resets its escalation.
+    pub fn succeed(&mut self, net: usize) {
+        self.failures.remove(&net);
+        self.queue.retain(|&other| other != net);
+    }
+
+    /// How hard to try routing a net.
+    pub fn escalation(&self, net: usize) -> Escalation {
+        Escalation::after(self.failures.get(&net).copied().unwrap_or(0))
+    }
+
+    /// Takes the next net to retry and how hard to try it.
+    pub fn pop(&mut self) -> Option<(usize, Escalation)> {
+        let net = self.queue.pop_front()?;
+        Some((net, self.escalation(net)))
+    }
+}
@@ -0,0 +1,764 @@
+use crate::{
+    chip::Chip,
+    components::{
+        Blockage, Cell, CellType, ConflictType, Direction, FactoryID, Layer, MasterCell, MasterPin,
+        Net, Point, Route,
+    },
+    schema::{read_versioned, write_versioned, Migration},
+    utilities::Fnv,
+};
+use anyhow::{anyhow, Result};
+use serde::{Deserialize, Serialize};
+use std::{
+    cmp,
+    collections::HashMap,
+    fmt::{Debug, Display, Formatter, Result as FmtResult, Write},
+    fs,
+};
+
+/// A design as read from an input file, in a form meant for JSON and external tools.
+/// Indices are the internal ones (starting from 0), and entities are named after their ids.
+/// Cells are where they currently are, and nets have their current routes.
+#[derive(Clone, Debug, Default, Deserialize, Eq, PartialEq, Serialize)]
+pub struct Design {
+    /// maximum movement count
+    pub max_move: usize,
+    /// number of rows and columns
+    pub dim: (usize, usize),
+    /// layers, bottom up
+    pub layers: Vec<DesignLayer>,
+    /// grids whose supply differs from their layer, as (row, col, lay, change)
+    pub non_default_supply: Vec<(usize, usize, usize, isize)>,
+    /// mastercells
+    pub mastercells: Vec<DesignMasterCell>,
+    /// extra demand rules
+    pub extra_demand: Vec<DesignRule>,
+    /// cells
+    pub cells: Vec<DesignCell>,
+    /// nets
+    pub nets: Vec<DesignNet>,
+    /// voltage areas
+    pub voltage_areas: Vec<DesignArea>,
+}
+
+/// A layer of a design.
+#[derive(Clone, Debug, Default, Deserialize, Eq, PartialEq, Serialize)]
+pub struct DesignLayer {
+    /// `H` or `V`
+    pub direction: String,
+    /// default supply of its grids
+    pub supply: usize,
+}
+
+/// A mastercell of a design.
+#[derive(Clone, Debug, Default, Deserialize, Eq, PartialEq, Serialize)]
+pub struct DesignMasterCell {
+    /// layer of every pin
+    pub pins: Vec<usize>,
+    /// layer and demand of every blockage
+    pub blockages: Vec<(usize, usize)>,
+}
+
+/// An extra demand rule of a design.
+#[derive(Clone, Debug, Default, Deserialize, Eq, PartialEq, Serialize)]
+pub struct DesignRule {
+    /// `sameGGrid` or `adjHGGrid`
+    pub kind: String,
+    /// the two mastercells
+    pub mastercells: (usize, usize),
+    /// layer of the demand
+    pub layer: usize,
+    /// extra demand
+    pub demand: usize,
+}
+
+/// A cell of a design.
+#[derive(Clone, Debug, Default, Deserialize, Eq, PartialEq, Serialize)]
+pub struct DesignCell {
+    /// mastercell
+    pub mastercell: usize,
+    /// row and column
+    pub position: (usize, usize),
+    /// whether the cell can be moved
+    pub movable: bool,
+}
+
+/// A net of a design.
+#[derive(Clone, Debug, Default, Deserialize, Eq, PartialEq, Serialize)]
+pub struct DesignNet {
+    /// min routing layer, 0 being no constraint
+    pub min_layer: usize,
+    /// pins as (cell, pin)
+    pub pins: Vec<(usize, usize)>,
+    /// route segments
+    pub routes: Vec<[usize; 6]>,
+    /// pass which committed every route segment, if tracked, for debugging only
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub provenance: Vec<String>,
+}
+
+/// A voltage area of a design.
+#[derive(Clone, Debug, Default, Deserialize, Eq, PartialEq, Serialize)]
+pub struct DesignArea {
+    /// name of the area
+    pub name: String,
+    /// grids as (row, col)
+    pub grids: Vec<(usize, usize)>,
+    /// cells restricted to the area
+    pub cells: Vec<usize>,
+}
+
+/// Something wrong with a design, found by `Design::validate`.
+/// Entities are named like in input files.
+#[derive(Clone, Debug, Eq, Hash, PartialEq)]
+pub enum Violation {
+    /// `from` refers to `to`, which does not exist
+    MissingReference { from: String, to: String },
+    /// `what` is at a grid (row, col), 1-based, out of the grid
+    OutOfBounds { what: String, grid: (usize, usize) },
+    /// `what` is on a layer, 1-based, which does not exist
+    MissingLayer { what: String, layer: usize },
+    /// `what` has an invalid value
+    Invalid { what: String, value: String },
+}
+
+impl Display for Violation {
+    fn fmt(&self, f: &mut Formatter) -> FmtResult {
+        match self {
+            Self::MissingReference { from, to } => {
+                write!(f, "{} refers to {}, not found", from, to)
+            }
+            Self::OutOfBounds { what, grid } => {
+                write!(f, "{} is at ({}, {}), out of bounds", what, grid.0, grid.1)
+            }
+            Self::MissingLayer { what, layer } => {
+                write!(f, "{} is on layer {}, not found", what, layer)
+            }
+            Self::Invalid { what, value } => write!(f, "{} is invalid: {}", what, value),
+        }
+    }
+}
+
+/// Migrations of design files, see `schema`.
+const DESIGN_MIGRATIONS: [Migration; 0] = [];
+
+impl Design {
+    /// A hash of the design, stable across runs and platforms,
+    /// to record which input a run solved and notice inputs that changed.
+    pub fn fingerprint(&self) -> u64 {
+        let mut hash = Fnv::new();
+        serde_json::to_writer(&mut hash, self).expect("Design cannot be serialized");
+        hash.finish()
+    }
+
+    /// The design in `chip`, as it currently is.
+    pub fn from_chip(chip: &Chip) -> Self {
+        let layers: Vec<_> = chip
+            .layers
+            .iter()
+            .map(|layer| DesignLayer {
+                direction: match layer.direction {
+                    Direction::Horizontal => "H".to_string(),
+                    Direction::Vertical => "V".to_string(),
+                },
+                supply: most_common(&layer.capacity),
+            })
+            .collect();
+
+        let cols = chip.dim.1;
+        let non_default_supply = chip
+            .layers
+            .iter()
+            .zip(layers.iter())
+            .flat_map(|(layer, design)| {
+                layer
+                    .capacity
+                    .iter()
+                    .enumerate()
+                    .filter(move |&(_, &supply)| supply != design.supply)
+                    .map(move |(idx, &supply)| {
+                        let change = supply as isize - design.supply as isize;
+                        (idx / cols, idx % cols, layer.id, change)
+                    })
+            })
+            .collect();
+
+        let mastercells = chip
+            .mastercells
+            .iter()
+            .map(|mc| {
+                let mut pins: Vec<_> = mc.pins.iter().map(|pin| (pin.id, pin.layer)).collect();
+                pins.sort_unstable();
+                let mut blockages: Vec<_> = mc
+                    .blkgs
+                    .iter()
+                    .map(|blkg| (blkg.id, blkg.layer, blkg.demand))
+                    .collect();
+                blockages.sort_unstable();
+
+                DesignMasterCell {
+                    pins: pins.into_iter().map(|(_, layer)| layer).collect(),
+                    blockages: blockages
+                        .into_iter()
+                        .map(|(_, layer, demand)| (layer, demand))
+                        .collect(),
+                }
+            })
+            .collect();
+
+        // rules are stored both ways, once per mastercell
+        let mut rules: Vec<_> = chip
+            .conflicts
+            .iter()
+            .flat_map(|(&mc, conflicts)| {
+                conflicts
+                    .iter()
+                    .filter(move |conflict| mc <= conflict.id)
+                    .map(move |conflict| {
+                        let same = conflict.kind == ConflictType::SameGGrid;
+                        (same, mc, conflict.id, conflict.layer, conflict.demand)
+                    })
+            })
+            .collect();
+        rules.sort_unstable();
+        let extra_demand = rules
+            .into_iter()
+            .map(|(same, mc1, mc2, layer, demand)| DesignRule {
+                kind: if same { "sameGGrid" } else { "adjHGGrid" }.to_string(),
+                mastercells: (mc1, mc2),
+                layer,
+                demand,
+            })
+            .collect();
+
+        let cells = chip
+            .cells
+            .iter()
+            .map(|cell| DesignCell {
+                mastercell: cell.mastercell,
+                position: (cell.position.0, cell.position.1),
+                movable: cell.movable == CellType::Movable,
+            })
+            .collect();
+
+        let nets = chip
+            .nets
+            .iter()
+            .map(|net| {
+                let segments = net.segments();
+                let mut sorted: Vec<_> = segments.iter().collect();
+                sorted.sort_unstable_by_key(|route| to_raw(route));
+                let provenance = sorted
+                    .iter()
+                    .filter_map(|route| chip.provenance_of(net.id, route))
+                    .map(|pass| pass.to_string())
+                    .collect();
+                DesignNet {
+                    min_layer: net.min_layer,
+                    pins: net.pins.clone(),
+                    routes: sorted.into_iter().map(to_raw).collect(),
+                    provenance,
+                }
+            })
+            .collect();
+
+        let voltage_areas = chip
+            .voltage_areas
+            .iter()
+            .map(|area| {
+                let mut grids: Vec<_> = area.grids.iter().map(|pos| (pos.0, pos.1)).collect();
+                grids.sort_unstable();
+                DesignArea {
+                    name: area.name.clone(),
+                    grids,
+                    cells: area.cells.clone(),
+                }
+            })
+            .collect();
+
+        Self {
+            max_move: chip.max_move,
+            dim: (chip.dim.0, chip.dim.1),
+            layers,
+            non_default_supply,
+            mastercells,
+            extra_demand,
+            cells,
+            nets,
+            voltage_areas,
+        }
+    }
+
+    /// Checks that every reference of the design is to something that exists,
+    /// every grid is in bounds and every layer exists.
+    /// Returns all the violations found, in the order of the design.
+    pub fn validate(&self) -> Vec<Violation> {
+        let mut violations = Vec::new();
+        let (rows, cols) = self.dim;
+        let layers = self.layers.len();
+
+        let name = |what: fn(usize) -> Result<String>, id: usize| {
+            what(id).unwrap_or_else(|_| id.to_string())
+        };
+        let grid = |what: &dyn Fn() -> String, (row, col): (usize, usize)| {
+            if row >= rows || col >= cols {
+                Some(Violation::OutOfBounds {
+                    what: what(),
+                    grid: (row + 1, col + 1),
+                })
+            } else {
+                None
+            }
+        };
+        let layer = |what: &dyn Fn() -> String, lay: usize| {
+            if lay >= layers {
+                Some(Violation::MissingLayer {
+                    what: what(),
+                    layer: lay + 1,
+                })
+            } else {
+                None
+            }
+        };
+
+        if rows == 0 || cols == 0 {
+            violations.push(Violation::Invalid {
+                what: "Grid".to_string(),
+                value: format!("{} by {}", rows, cols),
+            });
+        }
+
+        for (lay, design) in self.layers.iter().enumerate() {
+            if design.direction != "H" && design.direction != "V" {
+                violations.push(Violation::Invalid {
+                    what: name(Layer::from_num, lay),
+                    value: format!("direction {}", design.direction),
+                });
+            }
+        }
+
+        for &(row, col, lay, change) in self.non_default_supply.iter() {
+            let what = || format!("Supply of ({}, {}, {})", row + 1, col + 1, lay + 1);
+            violations.extend(grid(&what, (row, col)));
+            match self.layers.get(lay) {
+                Some(design) if design.supply as isize + change < 0 => {
+                    violations.push(Violation::Invalid {
+                        what: what(),
+                        value: format!("{}", design.supply as isize + change),
+                    })
+                }
+                Some(_) => {}
+                None => violations.extend(layer(&what, lay)),
+            }
+        }
+
+        for (id, mc) in self.mastercells.iter().enumerate() {
+            for (pin, &lay) in mc.pins.iter().enumerate() {
+                let what = || {
+                    format!(
+                        "{}/{}",
+                        name(MasterCell::from_num, id),
+                        name(MasterPin::from_num, pin)
+                    )
+                };
+                violations.extend(layer(&what, lay));
+            }
+            for (blkg, &(lay, _)) in mc.blockages.iter().enumerate() {
+                let what = || {
+                    format!(
+                        "{}/{}",
+                        name(MasterCell::from_num, id),
+                        name(Blockage::from_num, blkg)
+                    )
+                };
+                violations.extend(layer(&what, lay));
+            }
+        }
+
+        for (idx, rule) in self.extra_demand.iter().enumerate() {
+            let what = || format!("Extra demand rule #{}", idx + 1);
+            if rule.kind != "sameGGrid" && rule.kind != "adjHGGrid" {
+                violations.push(Violation::Invalid {
+                    what: what(),
+                    value: format!("kind {}", rule.kind),
+                });
+            }
+            let (mc1, mc2) = rule.mastercells;
+            for &mc in [mc1, mc2].iter() {
+                if mc >= self.mastercells.len() {
+                    violations.push(Violation::MissingReference {
+                        from: what(),
+                        to: name(MasterCell::from_num, mc),
+                    });
+                }
+            }
+            violations.extend(layer(&what, rule.layer));
+        }
+
+        for (id, cell) in self.cells.iter().enumerate() {
+            let what = || name(Cell::from_num, id);
+            if cell.mastercell >= self.mastercells.len() {
+                violations.push(Violation::MissingReference {
+                    from: what(),
+                    to: name(MasterCell::from_num, cell.mastercell),
+                });
+            }
+            violations.extend(grid(&what, cell.position));
+        }
+
+        for (id, net) in self.nets.iter().enumerate() {
+            let what = || name(Net::from_num, id);
+            violations.extend(layer(&what, net.min_layer));
+
+            for &(cell, pin) in net.pins.iter() {
+                let pin_name = || {
+                    format!(
+                        "{}/{}",
+                        name(Cell::from_num, cell),
+                        name(MasterPin::from_num, pin)
+                    )
+                };
+                let pins = self
+                    .cells
+                    .get(cell)
+                    .and_then(|cell| self.mastercells.get(cell.mastercell))
+                    .map(|mc| mc.pins.len());
+                match pins {
+                    Some(pins) if pin < pins => {}
+                    Some(_) => violations.push(Violation::MissingReference {
+                        from: what(),
+                        to: pin_name(),
+                    }),
+                    None if cell < self.cells.len() => {}
+                    None => violations.push(Violation::MissingReference {
+                        from: what(),
+                        to: name(Cell::from_num, cell),
+                    }),
+                }
+            }
+
+            for raw in net.routes.iter() {
+                let route = from_raw(raw);
+                let what = || format!("Route {} of {}", route.external(), name(Net::from_num, id));
+                for point in [route.source(), route.target()].iter() {
+                    violations.extend(grid(&what, (point.row(), point.col())));
+                    violations.extend(layer(&what, point.lay()));
+                }
+            }
+        }
+
+        for area in self.voltage_areas.iter() {
+            let what = || format!("Voltage area {}", area.name);
+            for &pos in area.grids.iter() {
+                violations.extend(grid(&what, pos));
+            }
+            for &cell in area.cells.iter() {
+                if cell >= self.cells.len() {
+                    violations.push(Violation::MissingReference {
+                        from: what(),
+                        to: name(Cell::from_num, cell),
+                    });
+                }
+            }
+        }
+
+        violations
+    }
+
+    /// Merges a patch into the design, like a file with some more cells and nets.
+    /// Entities are named after their ids, so the patch lists the cells and the nets
+    /// of the design it builds on, before its own, with the same head (layers and mastercells).
+    /// Cells, nets and voltage areas named like ones of the design must be the same,
+    /// the others are added.
+    pub fn merge(&mut self, patch: &Self) -> Result<()> {
+        let head = |design: &Self| {
+            (
+                design.max_move,
+                design.dim,
+                design.layers.clone(),
+                design.non_default_supply.clone(),
+                design.mastercells.clone(),
+                design.extra_demand.clone(),
+            )
+        };
+        if head(self) != head(patch) {
+            return Err(anyhow!("The patch has another head than the design"));
+        }
+
+        for (id, cell) in patch.cells.iter().enumerate() {
+            match self.cells.get(id) {
+                Some(other) if other != cell => {
+                    return Err(anyhow!("Cell {} differs in the patch", Cell::from_num(id)?))
+                }
+                Some(_) => {}
+                None => self.cells.push(cell.clone()),
+            }
+        }
+        for (id, net) in patch.nets.iter().enumerate() {
+            match self.nets.get(id) {
+                Some(other) if other != net => {
+                    return Err(anyhow!("Net {} differs in the patch", Net::from_num(id)?))
+                }
+                Some(_) => {}
+                None => self.nets.push(net.clone()),
+            }
+        }
+        for area in patch.voltage_areas.iter() {
+            match self
+                .voltage_areas
+                .iter()
+                .find(|other| other.name == area.name)
+            {
+                Some(other) if other != area => {
+                    return Err(anyhow!("Voltage area {} differs in the patch", area.name))
+                }
+                Some(_) => {}
+                None => self.voltage_areas.push(area.clone()),
+            }
+        }
+        Ok(())
+    }
+
+    /// How the design differs from `other`, field by field,
+    /// with the first differing entry of every list. Empty if they are equal.
+    pub fn differences(&self, other: &Self) -> Vec<String> {
+        let mut differences = Vec::new();
+        if self.max_move != other.max_move {
+            differences.push(format!("max_move: {} vs {}", self.max_move, other.max_move));
+        }
+        if self.dim != other.dim {
+            differences.push(format!("dim: {:?} vs {:?}", self.dim, other.dim));
+        }
+        differ("layers", &self.layers, &other.layers, &mut differences);
+        differ(
+            "non_default_supply",
+            &self.non_default_supply,
+            &other.non_default_supply,
+            &mut differences,
+        );
+        differ(
+            "mastercells",
+            &self.mastercells,
+            &other.mastercells,
+            &mut differences,
+        );
+        differ(
+            "extra_demand",
+            &self.extra_demand,
+            &other.extra_demand,
+            &mut differences,
+        );
+        differ("cells", &self.cells, &other.cells, &mut differences);
+        differ("nets", &self.nets, &other.nets, &mut differences);
+        differ(
+            "voltage_areas",
+            &self.voltage_areas,
+            &other.voltage_areas,
+            &mut differences,
+        );
+        differences
+    }
+
+    /// The content of the input file of the design.
+    pub fn to_input(&self) -> Result<String> {
+        let mut text = String::new();
+        writeln!(text, "MaxCellMove {}", self.max_move)?;
+        writeln!(text, "GGridBoundaryIdx 1 1 {} {}", self.dim.0, self.dim.1)?;
+
+        writeln!(text, "NumLayer {}", self.layers.len())?;
+        for (lay, layer) in self.layers.iter().enumerate() {
+            writeln!(
+                text,
+                "Lay {} {} {} {}",
+                Layer::from_num(lay)?,
+                lay + 1,
+                layer.direction,
+                layer.supply
+            )?;
+        }
+        writeln!(
+            text,
+            "NumNonDefaultSupplyGGrid {}",
+            self.non_default_supply.len()
+        )?;
+        for &(row, col, lay, change) in self.non_default_supply.iter() {
+            writeln!(text, "{} {} {} {}", row + 1, col + 1, lay + 1, change)?;
+        }
+
+        writeln!(text, "NumMasterCell {}", self.mastercells.len())?;
+        for (id, mc) in self.mastercells.iter().enumerate() {
+            writeln!(
+                text,
+                "MasterCell {} {} {}",
+                MasterCell::from_num(id)?,
+                mc.pins.len(),
+                mc.blockages.len()
+            )?;
+            for (pin, &layer) in mc.pins.iter().enumerate() {
+                writeln!(
+                    text,
+                    "Pin {} {}",
+                    MasterPin::from_num(pin)?,
+                    Layer::from_num(layer)?
+                )?;
+            }
+            for (blkg, &(layer, demand)) in mc.blockages.iter().enumerate() {
+                writeln!(
+                    text,
+                    "Blkg {} {} {}",
+                    Blockage::from_num(blkg)?,
+                    Layer::from_num(layer)?,
+                    demand
+                )?;
+            }
+        }
+
+        writeln!(
+            text,
+            "NumNeighborCellExtraDemand {}",
+            self.extra_demand.len()
+        )?;
+        for rule in self.extra_demand.iter() {
+            let (mc1, mc2) = rule.mastercells;
+            writeln!(
+                text,
+                "{} {} {} {} {}",
+                rule.kind,
+                MasterCell::from_num(mc1)?,
+                MasterCell::from_num(mc2)?,
+                Layer::from_num(rule.layer)?,
+                rule.demand
+            )?;
+        }
+
+        writeln!(text, "NumCellInst {}", self.cells.len())?;
+        for (id, cell) in self.cells.iter().enumerate() {
+            writeln!(
+                text,
+                "CellInst {} {} {} {} {}",
+                Cell::from_num(id)?,
+                MasterCell::from_num(cell.mastercell)?,
+                cell.position.0 + 1,
+                cell.position.1 + 1,
+                if cell.movable { "Movable" } else { "Fixed" }
+            )?;
+        }
+
+        writeln!(text, "NumNets {}", self.nets.len())?;
+        for (id, net) in self.nets.iter().enumerate() {
+            let min_layer = match net.min_layer {
+                0 => "NoCstr".to_string(),
+                layer => Layer::from_num(layer)?,
+            };
+            writeln!(
+                text,
+                "Net {} {} {}",
+                Net::from_num(id)?,
+                net.pins.len(),
+                min_layer
+            )?;
+            for &(cell, pin) in net.pins.iter() {
+                writeln!(
+                    text,
+                    "Pin {}/{}",
+                    Cell::from_num(cell)?,
+                    MasterPin::from_num(pin)?
+                )?;
+            }
+        }
+
+        let num_routes: usize = self.nets.iter().map(|net| net.routes.len()).sum();
+        writeln!(text, "NumRoutes {}", num_routes)?;
+        for (id, net) in self.nets.iter().enumerate() {
+            let name = Net::from_num(id)?;
+            for raw in net.routes.iter() {
+                writeln!(text, "{} {}", from_raw(raw).external(), name)?;
+            }
+        }
+
+        if !self.voltage_areas.is_empty() {
+            writeln!(text, "NumVoltageAreas {}", self.voltage_areas.len())?;
+            for area in self.voltage_areas.iter() {
+                writeln!(text, "Name {}", area.name)?;
+                writeln!(text, "GGrids {}", area.grids.len())?;
+                for &(row, col) in area.grids.iter() {
+                    writeln!(text, "{} {}", row + 1, col + 1)?;
+                }
+                writeln!(text, "Instances {}", area.cells.len())?;
+                for &cell in area.cells.iter() {
+                    writeln!(text, "{}", Cell::from_num(cell)?)?;
+                }
+            }
+        }
+
+        Ok(text)
+    }
+
+    /// Reads a design from a JSON file, migrating it if written by an older version.
+    pub fn read_file(filename: &str) -> Result<Self> {
+        let content: String = fs::read_to_string(filename)?;
+        let design: Self = read_versioned(&content, &DESIGN_MIGRATIONS)
+            .map_err(|err| anyhow!("In {}: {}", filename, err))?;
+
+        design
+            .check()
+            .map_err(|err| anyhow!("In {}:\n{}", filename, err))?;
+        Ok(design)
+    }
+
+    /// Fails listing all the violations of the design if any, see `validate`.
+    pub fn check(&self) -> Result<()> {
+        let violations = self.validate();
+        if !violations.is_empty() {
+            let lines: Vec<_> = violations.iter().map(Violation::to_string).collect();
+            return Err(anyhow!("{}", lines.join("\n")));
+        }
+        Ok(())
+    }
+
+    /// Writes a design to a JSON file.
+    pub fn write_file(&self, filename: &str) -> Result<()> {
+        fs::write(filename, write_versioned(self, &DESIGN_MIGRATIONS)?)?;
+        Ok(())
+    }
+}
+
+/// Adds to `differences` how two lists differ, by length and by their first differing entry.
+fn differ<T: Debug + PartialEq>(what: &str, a: &[T], b: &[T], differences: &mut Vec<String>) {
+    if a.len() != b.len() {
+        differences.push(format!("{}: {} vs {} entries", what, a.len(), b.len()));
+    }
+    if let Some(idx) = (0..cmp::min(a.len(), b.len())).find(|&idx| a[idx] != b[idx]) {
+        differences.push(format!(
+            "{} #{}: {:?} vs {:?}",
+            what,
+            idx + 1,
+            a[idx],
+            b[idx]
+        ));
+    }
+}
+
+/// The most common of some numbers, the smallest one on ties, 0 if there are none.
+fn most_common(numbers: &[usize]) -> usize {
+    let mut counts = HashMap::new();
+    for &number in numbers {
+        *counts.entry(number).or_insert(0) += 1;
+    }
+    counts
+        .into_iter()
+        .max_by_key(|&(number, count)| (count, cmp::Reverse(number)))
+        .map_or(0, |(number, _)| number)
+}
+
+/// Converts a route to plain numbers.
+fn to_raw(route: &Route<usize>) -> [usize; 6] {
+    let Route(Point(srow, scol, slay), Point(erow, ecol, elay)) = *route;
+    [srow, scol, slay, erow, ecol, elay]
+}
+
+/// Converts plain numbers to a route.
+fn from_raw(raw: &[usize; 6]) -> Route<usize> {
+    let [srow, scol, slay, erow, ecol, elay] = *raw;
+    Route::raw(srow, scol, slay, erow, ecol, elay)
+}
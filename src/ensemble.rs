@@ -0,0 +1,176 @@
+use crate::{
+    chip::Chip,
+    components::{Pair, Point, Provenance, Route},
+    solution::Solution,
+};
+use std::{borrow::Cow, collections::HashSet, mem};
+
+/// Routes of a net in a solution, falling back to the current ones if the solution lacks the net.
+fn routes_of<'a>(
+    chip: &'a Chip,
+    solution: &'a Solution,
+    net: usize,
+) -> Cow<'a, HashSet<Route<usize>>> {
+    match solution.routes.get(&net) {
+        Some(routes) => Cow::Borrowed(routes),
+        None => chip.nets[net].segments(),
+    }
+}
+
+/// Candidate routes of a net from all solutions and the current ones, shortest first.
+fn candidates(chip: &Chip, solutions: &[Solution], net: usize) -> Vec<HashSet<Route<usize>>> {
+    let current = chip.nets[net].segments();
+    let mut candidates: Vec<_> = solutions
+        .iter()
+        .filter_map(|solution| solution.routes.get(&net))
+        .chain(Some(current.as_ref()))
+        .map(|routes| (chip.weights.length_of(routes), routes))
+        .collect();
+    candidates.sort_by(|(a, _), (b, _)| a.partial_cmp(b).expect("NaN length"));
+
+    let mut unique: Vec<HashSet<_>> = Vec::with_capacity(candidates.len());
+    for (_, routes) in candidates {
+        if !unique.contains(routes) {
+            unique.push(routes.clone());
+        }
+    }
+    unique
+}
+
+/// Routes a net with the shortest candidate that connects its pins
+/// without making the grids around more overflowed than `limit`, given the grids `region` to look at.
+/// Returns whether a candidate has been found.
+fn route_net(
+    chip: &mut Chip,
+    solutions: &[Solution],
+    net: usize,
+    region: &HashSet<Point<usize>>,
+    limit: usize,
+) -> bool {
+    let old = chip.nets[net].segments().into_owned();
+
+    for routes in candidates(chip, solutions, net) {
+        if !chip.connects(net, &routes) {
+            continue;
+        }
+
+        chip.set_routes(net, routes);
+        if chip.overflow(region) <= limit {
+            return true;
+        }
+    }
+
+    chip.set_routes(net, old);
+    false
+}
+
+/// Merges several solutions of the same input, typically from different seeds or strategies.
+/// Every cell takes the position of the solution where its nets are the shortest,
+/// as long as the limit of moved cells allows and its nets can then be routed
+/// by some solution without making congestion worse, biggest gains first.
+/// Every net then takes the shortest routes connecting its pins without making congestion worse.
+/// Returns the number of nets whose routes changed.
+pub fn ensemble(chip: &mut Chip, solutions: &[Solution]) -> usize {
+    let pass = mem::replace(&mut chip.pass, Provenance::Ensemble);
+    let before: Vec<_> = chip
+        .nets
+        .iter()
+        .map(|net| net.segments().into_owned())
+        .collect();
+
+    let local_length = |chip: &Chip, solution: Option<&Solution>, cell: usize| -> f64 {
+        chip.cell_nets[cell]
+            .iter()
+            .map(|&net| match solution {
+                Some(solution) => chip.weighted_length(net, &routes_of(chip, solution, net)),
+                None => chip.weighted_length(net, &chip.nets[net].segments()),
+            })
+            .sum()
+    };
+
+    // the best position of every cell and how much shorter its nets get
+    let mut moves: Vec<(usize, Pair<usize>, f64)> = Vec::new();
+    for cell in chip.cells.iter() {
+        let current = local_length(chip, None, cell.id);
+        let best = solutions
+            .iter()
+            .filter_map(|solution| {
+                let &position = solution.cells.get(&cell.id)?;
+                Some((position, local_length(chip, Some(solution), cell.id)))
+            })
+            .filter(|&(position, _)| {
+                position != cell.position && chip.check_move(cell.id, position).is_ok()
+            })
+            .min_by(|(_, a), (_, b)| a.partial_cmp(b).expect("NaN length"));
+
+        if let Some((position, length)) = best {
+            if length < current {
+                moves.push((cell.id, position, current - length));
+            }
+        }
+    }
+    moves.sort_by(|(_, _, a), (_, _, b)| b.partial_cmp(a).expect("NaN gain"));
+
+    for (cell, to, _) in moves {
+        if chip.already_moved >= chip.max_move {
+            break;
+        }
+
+        let from = chip.cells[cell].position;
+        let was_moved = chip.cells[cell].moved;
+        let nets = chip.cell_nets[cell].clone();
+        let old: Vec<_> = nets
+            .iter()
+            .map(|&net| chip.nets[net].segments().into_owned())
+            .collect();
+
+        let mut region: HashSet<_> = nets
+            .iter()
+            .flat_map(|&net| candidates(chip, solutions, net))
+            .flat_map(|routes| routes.into_iter().flat_map(|route| route.points()))
+            .collect();
+        for pos in chip
+            .neighborhood(from)
+            .into_iter()
+            .chain(chip.neighborhood(to))
+        {
+            let Pair(row, col) = pos;
+            region.extend((0..chip.layers.len()).map(|lay| Point(row, col, lay)));
+        }
+        let limit = chip.overflow(&region);
+
+        chip.move_cell(cell, to);
+        let routed = nets
+            .iter()
+            .all(|&net| route_net(chip, solutions, net, &region, limit));
+
+        if !routed {
+            for (&net, routes) in nets.iter().zip(old.into_iter()) {
+                chip.set_routes(net, routes);
+            }
+            chip.move_cell(cell, from);
+
+            // moving back is not a move
+            if !was_moved {
+                chip.cells[cell].moved = false;
+                chip.already_moved -= 1;
+            }
+        }
+    }
+
+    for net in 0..chip.nets.len() {
+        let region: HashSet<_> = candidates(chip, solutions, net)
+            .into_iter()
+            .flat_map(|routes| routes.into_iter().flat_map(|route| route.points()))
+            .collect();
+        let limit = chip.overflow(&region);
+        route_net(chip, solutions, net, &region, limit);
+    }
+
+    chip.pass = pass;
+    chip.nets
+        .iter()
+        .zip(before.iter())
+        .filter(|(net, routes)| *net.segments() != **routes)
+        .count()
+}
@@ -0,0 +1,189 @@
+use crate::{
+    chip::Chip,
+    components::{Cell, FactoryID, Layer, MasterPin, Net, Pair, Point, Route},
+};
+use anyhow::Result;
+use std::{collections::HashSet, fmt::Write};
+
+/// Cost of going through a grid: the weight of its layer, inflated if the grid is predicted congested.
+fn grid_cost(chip: &Chip, point: Point<usize>) -> f64 {
+    let inflation = chip
+        .inflation
+        .get(chip.grid_index(point))
+        .copied()
+        .unwrap_or(1.);
+    chip.weights.layer(point.lay()) * inflation
+}
+
+/// Explains a net in a human readable way, for debugging quality issues:
+/// its pins, its min layer, its routes with the cost and congestion of every segment,
+/// and its wirelength against its lower bound.
+/// Positions are the ones of the input file (starting from 1).
+pub fn explain(chip: &Chip, net: usize) -> Result<String> {
+    let mut text = String::new();
+    let routes = chip.nets[net].segments();
+
+    writeln!(
+        text,
+        "Net {} with min layer {}",
+        Net::from_num(net)?,
+        Layer::from_num(chip.nets[net].min_layer)?
+    )?;
+
+    writeln!(text, "Pins:")?;
+    for pin in chip.pins_of_net(net).iter() {
+        writeln!(
+            text,
+            "  {}/{} at ({})",
+            Cell::from_num(pin.cell)?,
+            MasterPin::from_num(pin.pin)?,
+            pin.position.external()
+        )?;
+    }
+
+    let mut sorted: Vec<_> = routes.iter().collect();
+    sorted.sort_unstable();
+
+    // grids already counted by a previous segment cost nothing more
+    let mut counted = HashSet::new();
+
+    writeln!(text, "Routes:")?;
+    for route in sorted {
+        let points: Vec<_> = route.points().collect();
+        let new: Vec<_> = points
+            .iter()
+            .copied()
+            .filter(|&point| counted.insert(point))
+            .collect();
+        let cost: f64 = new.iter().map(|&point| grid_cost(chip, point)).sum();
+
+        let (mut worst, mut overflowed) = ((0, 0), 0);
+        for &point in points.iter() {
+            let demand = chip.demand[chip.grid_index(point)];
+            let supply = *chip.layers[point.lay()]
+                .get_capacity(point.row(), point.col())
+                .expect("Cell index out of bounds");
+            if demand > supply {
+                overflowed += 1;
+            }
+            if demand * worst.1 >= worst.0 * supply {
+                worst = (demand, supply);
+            }
+        }
+
+        write!(
+            text,
+            "  {}: {} grids ({} new), cost {:.2}, most congested {}/{}, {} overflowed",
+            route.external(),
+            points.len(),
+            new.len(),
+            cost,
+            worst.0,
+            worst.1,
+            overflowed
+        )?;
+        if let Some(provenance) = chip.provenance_of(net, route) {
+            write!(text, ", from {}", provenance)?;
+        }
+        writeln!(text)?;
+    }
+
+    writeln!(
+        text,
+        "Wirelength {} (weighted {:.2}), lower bound {}",
+        chip.nets[net].length(),
+        chip.weighted_length(net, &chip.nets[net].segments()),
+        chip.bound(net)
+    )?;
+    if let Some(max) = chip.criticality.max_length(net) {
+        writeln!(
+            text,
+            "Critical, weight {}, at most {} long",
+            chip.criticality.weight(net),
+            max
+        )?;
+    }
+
+    Ok(text)
+}
+
+/// Describes a grid in a human readable way, for checking the demand of a grid by hand:
+/// its supply, its demand from blockages, wires and extra demand rules,
+/// the cells on it and the nets going through it.
+/// Positions are the ones of the input file (starting from 1).
+pub fn query(chip: &Chip, point: Point<usize>) -> Result<String> {
+    let mut text = String::new();
+    let Point(row, col, lay) = point;
+    let pos = Pair(row, col);
+    let cells = &chip.cells_at[row * chip.dim.y() + col];
+
+    let supply = *chip.layers[lay]
+        .get_capacity(row, col)
+        .expect("Cell index out of bounds");
+    let blockage: usize = cells
+        .iter()
+        .flat_map(|&cell| chip.mastercells[chip.cells[cell].mastercell].blkgs.iter())
+        .filter(|blkg| blkg.layer == lay)
+        .map(|blkg| blkg.demand)
+        .sum();
+    let extra: usize = chip
+        .extra_demand_at(pos)
+        .into_iter()
+        .filter(|&(layer, _)| layer == lay)
+        .map(|(_, demand)| demand)
+        .sum();
+    let nets: Vec<_> = chip
+        .nets
+        .iter()
+        .filter(|net| {
+            net.segments()
+                .iter()
+                .any(|route| route_has(chip, route, point))
+        })
+        .map(|net| net.id)
+        .collect();
+    let demand = chip.demand[chip.grid_index(point)];
+
+    writeln!(
+        text,
+        "Grid {} on {}",
+        point.external(),
+        Layer::from_num(lay)?
+    )?;
+    writeln!(text, "Supply {}", supply)?;
+    writeln!(
+        text,
+        "Demand {} = {} blockage + {} wire + {} extra{}",
+        demand,
+        blockage,
+        nets.len(),
+        extra,
+        if demand > supply { ", overflowed" } else { "" }
+    )?;
+    if blockage + nets.len() + extra != demand {
+        writeln!(
+            text,
+            "Warning: the demand should be {}",
+            blockage + nets.len() + extra
+        )?;
+    }
+
+    let names = cells
+        .iter()
+        .map(|&cell| Cell::from_num(cell))
+        .collect::<Result<Vec<_>>>()?;
+    writeln!(text, "Cells: {}", names.join(" "))?;
+
+    let names = nets
+        .into_iter()
+        .map(Net::from_num)
+        .collect::<Result<Vec<_>>>()?;
+    writeln!(text, "Nets: {}", names.join(" "))?;
+
+    Ok(text)
+}
+
+/// Whether a route consumes the supply of a grid.
+fn route_has(chip: &Chip, route: &Route<usize>, point: Point<usize>) -> bool {
+    chip.via_model.points(*route).any(|other| other == point)
+}
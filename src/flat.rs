@@ -0,0 +1,221 @@
+use crate::components::Point;
+use std::{cmp, iter::FromIterator, mem};
+
+/// Multiplier of Fibonacci hashing, 2^64 divided by the golden ratio.
+const FIBONACCI: u64 = 0x9e37_79b9_7f4a_7c15;
+
+/// Packs a point into a single integer:
+/// 24 bits of row, 24 bits of column and 16 bits of layer.
+fn key(point: Point<usize>) -> u64 {
+    let Point(row, col, lay) = point;
+    debug_assert!(row < 1 << 24 && col < 1 << 24 && lay < 1 << 16);
+    (row as u64) << 40 | (col as u64) << 16 | lay as u64
+}
+
+/// Unpacks a point packed by `key`.
+fn point(key: u64) -> Point<usize> {
+    Point(
+        (key >> 40) as usize,
+        (key >> 16 & 0xff_ffff) as usize,
+        (key & 0xffff) as usize,
+    )
+}
+
+/// A map keyed by points, much faster than `HashMap` on the many small maps of routing.
+/// Points are packed into integers and stored in a single open addressing table
+/// probed linearly, so that looking a point up is a multiplication and a few comparisons.
+/// Entries cannot be removed.
+#[derive(Clone, Debug)]
+pub struct PointMap<V> {
+    /// slots of the table, a power of two of them
+    slots: Vec<Option<(u64, V)>>,
+    /// number of entries
+    len: usize,
+}
+
+/// A set of points, see `PointMap`.
+#[derive(Clone, Debug, Default)]
+pub struct PointSet(PointMap<()>);
+
+impl<V> PointMap<V> {
+    /// Creates an empty map.
+    pub fn new() -> Self {
+        Self::with_capacity(0)
+    }
+
+    /// Creates an empty map holding `capacity` entries without growing.
+    pub fn with_capacity(capacity: usize) -> Self {
+        let slots = cmp::max(capacity * 4 / 3 + 1, 8).next_power_of_two();
+        Self {
+            slots: (0..slots).map(|_| None).collect(),
+            len: 0,
+        }
+    }
+
+    /// Index of the slot holding `key`, or of the empty slot where it would go.
+    fn slot(&self, key: u64) -> usize {
+        let mask = self.slots.len() - 1;
+        let shift = 64 - self.slots.len().trailing_zeros();
+
+        let mut idx = (key.wrapping_mul(FIBONACCI) >> shift) as usize;
+        loop {
+            match &self.slots[idx] {
+                Some((other, _)) if *other != key => idx = (idx + 1) & mask,
+                _ => return idx,
+            }
+        }
+    }
+
+    /// Doubles the table if one more entry would fill more than 3/4 of it.
+    fn reserve_one(&mut self) {
+        self.reserve(1);
+    }
+
+    /// Grows the table at once so that `additional` more entries fill no more than 3/4 of it.
+    pub fn reserve(&mut self, additional: usize) {
+        if (self.len + additional) * 4 <= self.slots.len() * 3 {
+            return;
+        }
+
+        let mut size = 2 * self.slots.len();
+        while (self.len + additional) * 4 > size * 3 {
+            size *= 2;
+        }
+        let old = mem::replace(&mut self.slots, (0..size).map(|_| None).collect());
+        for (key, value) in old.into_iter().flatten() {
+            let idx = self.slot(key);
+            self.slots[idx] = Some((key, value));
+        }
+    }
+
+    /// The value of a point.
+    pub fn get(&self, point: Point<usize>) -> Option<&V> {
+        let idx = self.slot(key(point));
+        self.slots[idx].as_ref().map(|(_, value)| value)
+    }
+
+    /// The value of a point, mutably.
+    pub fn get_mut(&mut self, point: Point<usize>) -> Option<&mut V> {
+        let idx = self.slot(key(point));
+        self.slots[idx].as_mut().map(|(_, value)| value)
+    }
+
+    /// Sets the value of a point, returning the previous one.
+    pub fn insert(&mut self, point: Point<usize>, value: V) -> Option<V> {
+        self.reserve_one();
+
+        let key = key(point);
+        let idx = self.slot(key);
+        let old = self.slots[idx].replace((key, value));
+        if old.is_none() {
+            self.len += 1;
+        }
+        old.map(|(_, value)| value)
+    }
+
+    /// The value of a point, set by `default` first if missing.
+    pub fn get_or_insert_with<F>(&mut self, point: Point<usize>, default: F) -> &mut V
+    where
+        F: FnOnce() -> V,
+    {
+        self.reserve_one();
+
+        let key = key(point);
+        let idx = self.slot(key);
+        if self.slots[idx].is_none() {
+            self.slots[idx] = Some((key, default()));
+            self.len += 1;
+        }
+
+        match &mut self.slots[idx] {
+            Some((_, value)) => value,
+            None => unreachable!(),
+        }
+    }
+
+    /// Number of entries.
+    pub fn len(&self) -> usize {
+        self.len
+    }
+
+    /// Whether there is no entry.
+    pub fn is_empty(&self) -> bool {
+        self.len == 0
+    }
+
+    /// All the entries, in no particular order.
+    pub fn iter(&self) -> impl Iterator<Item = (Point<usize>, &V)> {
+        self.slots
+            .iter()
+            .flatten()
+            .map(|(key, value)| (point(*key), value))
+    }
+}
+
+impl<V> Default for PointMap<V> {
+    fn default() -> Self {
+        Self::new()
+    }
+}
+
+impl PointSet {
+    /// Creates an empty set.
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Creates an empty set holding `capacity` points without growing.
+    pub fn with_capacity(capacity: usize) -> Self {
+        Self(PointMap::with_capacity(capacity))
+    }
+
+    /// Adds a point, returning whether it was missing.
+    pub fn insert(&mut self, point: Point<usize>) -> bool {
+        self.0.insert(point, ()).is_none()
+    }
+
+    /// Whether a point is in the set.
+    pub fn contains(&self, point: Point<usize>) -> bool {
+        self.0.get(point).is_some()
+    }
+
+    /// Number of points.
+    pub fn len(&self) -> usize {
+        self.0.len()
+    }
+
+    /// Whether there is no point.
+    pub fn is_empty(&self) -> bool {
+        self.0.is_empty()
+    }
+
+    /// All the points, in no particular order.
+    pub fn iter(&self) -> impl Iterator<Item = Point<usize>> + '_ {
+        self.0.iter().map(|(point, _)| point)
+    }
+}
+
+impl Extend<Point<usize>> for PointSet {
+    fn extend<I>(&mut self, iter: I)
+    where
+        I: IntoIterator<Item = Point<usize>>,
+    {
+        let iter = iter.into_iter();
+        self.0.reserve(iter.size_hint().0);
+        for point in iter {
+            self.insert(point);
+        }
+    }
+}
+
+impl FromIterator<Point<usize>> for PointSet {
+    fn from_iter<I>(iter: I) -> Self
+    where
+        I: IntoIterator<Item = Point<usize>>,
+    {
+        let iter = iter.into_iter();
+        let mut set = Self::with_capacity(iter.size_hint().0);
+        set.extend(iter);
+        set
+    }
+}
@@ -0,0 +1,298 @@
+use crate::{
+    chip::Chip,
+    components::{Pair, Point},
+};
+use std::cmp;
+
+/// What the demand of a grid comes from.
+#[derive(Clone, Copy, Debug, Eq, Hash, PartialEq)]
+pub enum Demand {
+    /// blockages of the cells on the grid
+    Blockage,
+    /// extra demand rules between the cells on and next to the grid
+    Extra,
+    /// wires and vias going through the grid
+    Wire,
+}
+
+/// The supply and demand of a grid on a layer, keeping what they come from apart,
+/// so that moves and reroutes can update them incrementally.
+#[derive(Clone, Copy, Debug, Default, Eq, PartialEq)]
+pub struct GCell {
+    /// default supply of its layer
+    pub default_supply: usize,
+    /// non default supply change
+    pub adjustment: isize,
+    /// demand from blockages
+    pub blockage: usize,
+    /// demand from extra demand rules
+    pub extra: usize,
+    /// demand from wires
+    pub wire: usize,
+}
+
+impl GCell {
+    /// Supply of the grid, never negative.
+    pub fn supply(&self) -> usize {
+        cmp::max(self.default_supply as isize + self.adjustment, 0) as usize
+    }
+
+    /// Demand of the grid, from everything.
+    pub fn demand(&self) -> usize {
+        self.blockage + self.extra + self.wire
+    }
+
+    /// Supply left on the grid, negative if overflowed.
+    pub fn remaining(&self) -> isize {
+        self.supply() as isize - self.demand() as isize
+    }
+
+    /// By how much the demand is over the supply.
+    pub fn overflow(&self) -> usize {
+        self.demand().saturating_sub(self.supply())
+    }
+
+    /// The demand of a kind.
+    fn part_mut(&mut self, kind: Demand) -> &mut usize {
+        match kind {
+            Demand::Blockage => &mut self.blockage,
+            Demand::Extra => &mut self.extra,
+            Demand::Wire => &mut self.wire,
+        }
+    }
+
+    /// Adds demand of a kind.
+    pub fn add_demand(&mut self, kind: Demand, amount: usize) {
+        *self.part_mut(kind) += amount;
+    }
+
+    /// Removes demand of a kind, which must have been added.
+    pub fn remove_demand(&mut self, kind: Demand, amount: usize) {
+        let part = self.part_mut(kind);
+        *part = part
+            .checked_sub(amount)
+            .expect("Demand removed was never added");
+    }
+}
+
+/// Supply and demand of every grid of a chip, rows × columns × layers.
+/// Grids are indexed like `Chip::grid_index`, one layer after another.
+#[derive(Clone, Debug, Default, Eq, PartialEq)]
+pub struct RoutingGrid {
+    /// rows and columns
+    pub dim: Pair<usize>,
+    /// number of layers
+    pub layers: usize,
+    /// every grid
+    gcells: Vec<GCell>,
+    /// cells on every grid, indexed like `Layer::capacity`
+    cells_at: Vec<Vec<usize>>,
+    /// where every cell is, if placed
+    positions: Vec<Option<Pair<usize>>>,
+}
+
+impl RoutingGrid {
+    /// The grids of a chip, as they currently are.
+    pub fn from_chip(chip: &Chip) -> Self {
+        let demand = if chip.demand.len() == chip.layers.len() * chip.dim.size() {
+            chip.demand.clone()
+        } else {
+            chip.compute_demand()
+        };
+
+        let mut gcells: Vec<_> = chip
+            .layers
+            .iter()
+            .flat_map(|layer| {
+                layer.capacity.iter().map(move |&capacity| GCell {
+                    default_supply: layer.supply,
+                    adjustment: capacity as isize - layer.supply as isize,
+                    ..GCell::default()
+                })
+            })
+            .collect();
+
+        for cell in chip.cells.iter() {
+            for blkg in chip.mastercells[cell.mastercell].blkgs.iter() {
+                gcells[chip.grid_index(cell.position.with(blkg.layer))].blockage += blkg.demand;
+            }
+        }
+        let Pair(rows, cols) = chip.dim;
+        for row in 0..rows {
+            for col in 0..cols {
+                let pos = Pair(row, col);
+                for (layer, extra) in chip.extra_demand_at(pos) {
+                    gcells[chip.grid_index(pos.with(layer))].extra += extra;
+                }
+            }
+        }
+        for (gcell, &demand) in gcells.iter_mut().zip(demand.iter()) {
+            gcell.wire = demand.saturating_sub(gcell.blockage + gcell.extra);
+        }
+
+        Self {
+            dim: chip.dim,
+            layers: chip.layers.len(),
+            gcells,
+            cells_at: chip.cells_at.clone(),
+            positions: chip.cells.iter().map(|cell| Some(cell.position)).collect(),
+        }
+    }
+
+    /// Whether a grid is within the chip.
+    pub fn contains(&self, point: Point<usize>) -> bool {
+        point.row() < self.dim.x() && point.col() < self.dim.y() && point.lay() < self.layers
+    }
+
+    /// Index of a grid.
+    pub fn index(&self, point: Point<usize>) -> usize {
+        let Pair(_, cols) = self.dim;
+        point.lay() * self.dim.size() + point.row() * cols + point.col()
+    }
+
+    /// A grid.
+    pub fn gcell(&self, point: Point<usize>) -> &GCell {
+        &self.gcells[self.index(point)]
+    }
+
+    /// A grid, to be updated.
+    pub fn gcell_mut(&mut self, point: Point<usize>) -> &mut GCell {
+        let idx = self.index(point);
+        &mut self.gcells[idx]
+    }
+
+    /// Every grid.
+    pub fn gcells(&self) -> &[GCell] {
+        &self.gcells
+    }
+
+    /// Supply of a grid.
+    pub fn supply(&self, point: Point<usize>) -> usize {
+        self.gcell(point).supply()
+    }
+
+    /// Demand of a grid.
+    pub fn demand(&self, point: Point<usize>) -> usize {
+        self.gcell(point).demand()
+    }
+
+    /// Demand of a grid from blockages.
+    pub fn blockage(&self, point: Point<usize>) -> usize {
+        self.gcell(point).blockage
+    }
+
+    /// Supply left on a grid, negative if overflowed.
+    pub fn remaining(&self, point: Point<usize>) -> isize {
+        self.gcell(point).remaining()
+    }
+
+    /// Whether the demand of a grid is over its supply.
+    pub fn overflowed(&self, point: Point<usize>) -> bool {
+        self.remaining(point) < 0
+    }
+
+    /// The grids whose demand is over their supply, with by how much, in index order.
+    pub fn overflows(&self) -> Vec<(Point<usize>, usize)> {
+        let Pair(_, cols) = self.dim;
+        let size = self.dim.size();
+        self.gcells
+            .iter()
+            .enumerate()
+            .filter(|(_, gcell)| gcell.overflow() > 0)
+            .map(|(idx, gcell)| {
+                let rest = idx % size;
+                (
+                    Point(rest / cols, rest % cols, idx / size),
+                    gcell.overflow(),
+                )
+            })
+            .collect()
+    }
+
+    /// Total overflow of all the grids.
+    pub fn total_overflow(&self) -> usize {
+        self.gcells.iter().map(GCell::overflow).sum()
+    }
+
+    /// Adds demand of a kind to a grid.
+    pub fn add_demand(&mut self, point: Point<usize>, kind: Demand, amount: usize) {
+        self.gcell_mut(point).add_demand(kind, amount);
+    }
+
+    /// Removes demand of a kind from a grid, which must have been added.
+    pub fn remove_demand(&mut self, point: Point<usize>, kind: Demand, amount: usize) {
+        self.gcell_mut(point).remove_demand(kind, amount);
+    }
+
+    /// Where a cell of `chip` is, if placed.
+    pub fn position(&self, cell: usize) -> Option<Pair<usize>> {
+        self.positions.get(cell).copied().flatten()
+    }
+
+    /// Cells on a grid.
+    pub fn cells_at(&self, pos: Pair<usize>) -> &[usize] {
+        &self.cells_at[pos.x() * self.dim.y() + pos.y()]
+    }
+
+    /// Removes a cell of `chip` from where it is, with all the demand it brings:
+    /// the demand of its blockages and the extra demand between it and its neighbors.
+    /// Pins bring no demand of their own. Returns where the cell was.
+    pub fn remove_cell(&mut self, chip: &Chip, cell: usize) -> Pair<usize> {
+        let pos = self.position(cell).expect("Cell is not placed");
+        let affected = chip.neighborhood(pos);
+
+        self.update_extra(chip, &affected, false);
+        self.update_blockages(chip, cell, pos, false);
+        self.cells_at[pos.x() * self.dim.y() + pos.y()].retain(|&other| other != cell);
+        self.positions[cell] = None;
+        self.update_extra(chip, &affected, true);
+        pos
+    }
+
+    /// Places a cell of `chip` on a grid, with all the demand it brings, see `remove_cell`.
+    pub fn place_cell(&mut self, chip: &Chip, cell: usize, pos: Pair<usize>) {
+        assert!(self.position(cell).is_none(), "Cell is already placed");
+        let affected = chip.neighborhood(pos);
+
+        self.update_extra(chip, &affected, false);
+        self.positions[cell] = Some(pos);
+        self.cells_at[pos.x() * self.dim.y() + pos.y()].push(cell);
+        self.update_blockages(chip, cell, pos, true);
+        self.update_extra(chip, &affected, true);
+    }
+
+    /// Moves a cell of `chip` to a grid, see `remove_cell` and `place_cell`.
+    /// Returns where the cell was.
+    pub fn move_cell(&mut self, chip: &Chip, cell: usize, to: Pair<usize>) -> Pair<usize> {
+        let from = self.remove_cell(chip, cell);
+        self.place_cell(chip, cell, to);
+        from
+    }
+
+    /// Adds or removes the demand of the blockages of a cell on a grid.
+    fn update_blockages(&mut self, chip: &Chip, cell: usize, pos: Pair<usize>, add: bool) {
+        let mastercell = chip.cells[cell].mastercell;
+        for blkg in chip.mastercells[mastercell].blkgs.iter() {
+            let point = pos.with(blkg.layer);
+            if add {
+                self.add_demand(point, Demand::Blockage, blkg.demand);
+            } else {
+                self.remove_demand(point, Demand::Blockage, blkg.demand);
+            }
+        }
+    }
+
+    /// Adds or removes the extra demand on some grids, given the cells on them.
+    fn update_extra(&mut self, chip: &Chip, positions: &[Pair<usize>], add: bool) {
+        for &pos in positions.iter() {
+            for (layer, extra) in chip.extra_demand_with(&self.cells_at, pos) {
+                let point = pos.with(layer);
+                if add {
+                    self.add_demand(point, Demand::Extra, extra);
+                } else {
+                    self.remove_demand(point, Demand::Extra, extra);
+                }
+            }
+        }
+    }
+}
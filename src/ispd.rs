@@ -0,0 +1,234 @@
+use crate::{
+    components::{Cell, FactoryID, Layer, MasterCell, Net},
+    utilities::{self, Tokenizer, Tokens},
+};
+use anyhow::{anyhow, Result};
+use std::{cmp, collections::HashMap, fmt::Write, ops::Deref};
+
+/// Checks that the next words are `words`.
+fn keywords<T, S>(content: &mut T, words: &[&str]) -> Result<()>
+where
+    T: Iterator<Item = S>,
+    S: Deref<Target = str>,
+{
+    use utilities::{check_eq, parse_string};
+
+    for &word in words {
+        let found: &str = &parse_string(content)?;
+        check_eq(found, word)?;
+    }
+    Ok(())
+}
+
+/// Reads one number per layer.
+fn per_layer<T, S>(content: &mut T, layers: usize) -> Result<Vec<usize>>
+where
+    T: Iterator<Item = S>,
+    S: Deref<Target = str>,
+{
+    (0..layers)
+        .map(|_| utilities::parse_numeric(content))
+        .collect()
+}
+
+/// Translates an ISPD 2007 or 2008 global routing benchmark into the content of an input file.
+/// The benchmark has no cells, so every pin becomes a fixed cell of its own,
+/// of a mastercell with a single pin on the layer of the pin. Nets come unrouted.
+/// The supply of a layer is the number of its tracks, its capacity over its pitch,
+/// and a reduced edge reduces the supply of both its grids.
+/// Returns the content and the names of the nets.
+pub fn translate_ispd(content: &str) -> Result<(String, Vec<String>)> {
+    let tokens = &mut Tokens::new(content);
+    parse_ispd(tokens).map_err(|err| anyhow!("Near line {}: {}", tokens.line(), err))
+}
+
+/// Parses a benchmark, see `translate_ispd`.
+fn parse_ispd<T, S>(content: &mut T) -> Result<(String, Vec<String>)>
+where
+    T: Iterator<Item = S>,
+    S: Deref<Target = str>,
+{
+    use utilities::{parse_numeric, parse_string};
+
+    // grid <xGrids> <yGrids> <layers>
+    keywords(content, &["grid"])?;
+    let cols: usize = parse_numeric(content)?;
+    let rows: usize = parse_numeric(content)?;
+    let layers: usize = parse_numeric(content)?;
+
+    // vertical capacity <capacity>... and so on, one number per layer
+    keywords(content, &["vertical", "capacity"])?;
+    let vertical = per_layer(content, layers)?;
+    keywords(content, &["horizontal", "capacity"])?;
+    let horizontal = per_layer(content, layers)?;
+    keywords(content, &["minimum", "width"])?;
+    let width = per_layer(content, layers)?;
+    keywords(content, &["minimum", "spacing"])?;
+    let spacing = per_layer(content, layers)?;
+    keywords(content, &["via", "spacing"])?;
+    per_layer(content, layers)?;
+
+    // <lowerLeftX> <lowerLeftY> <tileWidth> <tileHeight>
+    let left: i64 = parse_numeric(content)?;
+    let bottom: i64 = parse_numeric(content)?;
+    let tile_width: i64 = parse_numeric(content)?;
+    let tile_height: i64 = parse_numeric(content)?;
+    if tile_width <= 0 || tile_height <= 0 {
+        return Err(anyhow!("Tiles must not be empty"));
+    }
+
+    // whether every layer is vertical, layers without capacity alternating with their neighbors
+    let mut directions: Vec<bool> = Vec::with_capacity(layers);
+    for lay in 0..layers {
+        let vertical = match (vertical[lay] > 0, horizontal[lay] > 0) {
+            (true, _) => true,
+            (false, true) => false,
+            (false, false) => lay > 0 && !directions[lay - 1],
+        };
+        directions.push(vertical);
+    }
+    let tracks = |lay: usize, capacity: usize| capacity / cmp::max(width[lay] + spacing[lay], 1);
+    let supply: Vec<_> = (0..layers)
+        .map(|lay| {
+            let capacity = if directions[lay] {
+                vertical[lay]
+            } else {
+                horizontal[lay]
+            };
+            tracks(lay, capacity)
+        })
+        .collect();
+
+    // num net <netCount>
+    keywords(content, &["num", "net"])?;
+    let net_count: usize = parse_numeric(content)?;
+
+    // pins of every net, as (row, col, lay) in grids
+    let mut names = Vec::with_capacity(net_count);
+    let mut nets = Vec::with_capacity(net_count);
+    for _ in 0..net_count {
+        // <netName> <netId> <pinCount> <minWidth>
+        let name = parse_string(content)?.to_string();
+        let _id: usize = parse_numeric(content)?;
+        let pin_count: usize = parse_numeric(content)?;
+        let _min_width: usize = parse_numeric(content)?;
+
+        // <x> <y> <layer>
+        let mut pins = Vec::with_capacity(pin_count);
+        for _ in 0..pin_count {
+            let x: i64 = parse_numeric(content)?;
+            let y: i64 = parse_numeric(content)?;
+            let lay: usize = parse_numeric(content)?;
+
+            let (col, row) = ((x - left) / tile_width, (y - bottom) / tile_height);
+            if x < left || y < bottom || col as usize >= cols || row as usize >= rows {
+                return Err(anyhow!(
+                    "Pin ({}, {}) of {} is outside of the grid",
+                    x,
+                    y,
+                    name
+                ));
+            }
+            if lay == 0 || lay > layers {
+                return Err(anyhow!("Layer {} of {} not found", lay, name));
+            }
+            pins.push((row as usize, col as usize, lay - 1));
+        }
+
+        names.push(name);
+        nets.push(pins);
+    }
+
+    // <adjustmentCount>
+    // <col> <row> <layer> <col> <row> <layer> <reducedCapacity>
+    let mut reduced: HashMap<(usize, usize, usize), usize> = HashMap::new();
+    let adjustments: usize = content
+        .next()
+        .map(|count| count.parse())
+        .transpose()?
+        .unwrap_or(0);
+    for _ in 0..adjustments {
+        let mut ends = [(0, 0, 0); 2];
+        for end in ends.iter_mut() {
+            let col: usize = parse_numeric(content)?;
+            let row: usize = parse_numeric(content)?;
+            let lay: usize = parse_numeric(content)?;
+            if col >= cols || row >= rows || lay == 0 || lay > layers {
+                return Err(anyhow!("Edge at ({}, {}, {}) not found", col, row, lay));
+            }
+            *end = (row, col, lay - 1);
+        }
+        let capacity: usize = parse_numeric(content)?;
+
+        for &end in ends.iter() {
+            let lay = end.2;
+            let limit = cmp::min(tracks(lay, capacity), supply[lay]);
+            let entry = reduced.entry(end).or_insert(limit);
+            *entry = cmp::min(*entry, limit);
+        }
+    }
+
+    utilities::check_eq(content.next().as_deref(), None)?;
+
+    let mut text = String::new();
+    writeln!(text, "MaxCellMove 0")?;
+    writeln!(text, "GGridBoundaryIdx 1 1 {} {}", rows, cols)?;
+
+    writeln!(text, "NumLayer {}", layers)?;
+    for lay in 0..layers {
+        let dir = if directions[lay] { "V" } else { "H" };
+        writeln!(
+            text,
+            "Lay {} {} {} {}",
+            Layer::from_num(lay)?,
+            lay + 1,
+            dir,
+            supply[lay]
+        )?;
+    }
+
+    let mut reduced: Vec<_> = reduced.into_iter().collect();
+    reduced.sort_unstable();
+    writeln!(text, "NumNonDefaultSupplyGGrid {}", reduced.len())?;
+    for ((row, col, lay), limit) in reduced {
+        let change = limit as i64 - supply[lay] as i64;
+        writeln!(text, "{} {} {} {}", row + 1, col + 1, lay + 1, change)?;
+    }
+
+    writeln!(text, "NumMasterCell {}", layers)?;
+    for lay in 0..layers {
+        writeln!(text, "MasterCell {} 1 0", MasterCell::from_num(lay)?)?;
+        writeln!(text, "Pin P1 {}", Layer::from_num(lay)?)?;
+    }
+    writeln!(text, "NumNeighborCellExtraDemand 0")?;
+
+    let cell_count: usize = nets.iter().map(Vec::len).sum();
+    writeln!(text, "NumCellInst {}", cell_count)?;
+    let mut cell = 0;
+    for pins in nets.iter() {
+        for &(row, col, lay) in pins.iter() {
+            writeln!(
+                text,
+                "CellInst {} {} {} {} Fixed",
+                Cell::from_num(cell)?,
+                MasterCell::from_num(lay)?,
+                row + 1,
+                col + 1
+            )?;
+            cell += 1;
+        }
+    }
+
+    writeln!(text, "NumNets {}", nets.len())?;
+    let mut cell = 0;
+    for (id, pins) in nets.iter().enumerate() {
+        writeln!(text, "Net {} {} NoCstr", Net::from_num(id)?, pins.len())?;
+        for _ in pins.iter() {
+            writeln!(text, "Pin {}/P1", Cell::from_num(cell)?)?;
+            cell += 1;
+        }
+    }
+    writeln!(text, "NumRoutes 0")?;
+
+    Ok((text, names))
+}
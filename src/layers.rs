@@ -0,0 +1,60 @@
+use crate::components::{Direction, FactoryID, Layer, Pair};
+use anyhow::{anyhow, Result};
+
+/// The layers of a design, looked up by name, as in `M1`, or by index, starting from 0.
+#[derive(Clone, Copy, Debug)]
+pub struct LayerTable<'a> {
+    /// layers by index
+    layers: &'a [Layer],
+}
+
+impl<'a> LayerTable<'a> {
+    /// A table of layers, indexed from 0.
+    pub fn new(layers: &'a [Layer]) -> Self {
+        Self { layers }
+    }
+
+    /// Number of layers.
+    pub fn len(&self) -> usize {
+        self.layers.len()
+    }
+
+    /// Whether there is no layer.
+    pub fn is_empty(&self) -> bool {
+        self.layers.is_empty()
+    }
+
+    /// Finds a layer by name.
+    pub fn by_name(&self, name: &str) -> Result<&'a Layer> {
+        self.layers
+            .get(Layer::from_str(name)?)
+            .ok_or_else(|| anyhow!("Layer {} not found", name))
+    }
+
+    /// Finds a layer by index.
+    pub fn by_index(&self, layer: usize) -> Result<&'a Layer> {
+        self.layers
+            .get(layer)
+            .ok_or_else(|| anyhow!("Layer #{} not found", layer + 1))
+    }
+
+    /// Name of a layer.
+    pub fn name(&self, layer: usize) -> Result<String> {
+        Layer::from_num(self.by_index(layer)?.id)
+    }
+
+    /// Routing direction of a layer.
+    pub fn direction(&self, layer: usize) -> Result<Direction> {
+        Ok(self.by_index(layer)?.direction)
+    }
+
+    /// Supply of the grids of a layer, before the non default supplies.
+    pub fn default_supply(&self, layer: usize) -> Result<usize> {
+        Ok(self.by_index(layer)?.supply)
+    }
+
+    /// Non default supplies of a layer as (grid, change), applied to its capacity.
+    pub fn adjustments(&self, layer: usize) -> Result<&'a [(Pair<usize>, isize)]> {
+        Ok(&self.by_index(layer)?.adjustments)
+    }
+}
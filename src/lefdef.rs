@@ -0,0 +1,482 @@
+use crate::components::{Cell, FactoryID, Layer, MasterCell, MasterPin, Net};
+use anyhow::{anyhow, Result};
+use std::{collections::HashMap, fmt::Write, str::FromStr};
+
+/// Sections of a DEF file which are skipped as a whole, up to `END <section>`.
+const SKIPPED_SECTIONS: [&str; 11] = [
+    "PROPERTYDEFINITIONS",
+    "PINS",
+    "PINPROPERTIES",
+    "VIAS",
+    "SPECIALNETS",
+    "BLOCKAGES",
+    "REGIONS",
+    "GROUPS",
+    "NONDEFAULTRULES",
+    "STYLES",
+    "SCANCHAINS",
+];
+
+/// Names of a design read from LEF and DEF, indexed by id.
+/// Entities are renamed after their ids in the router, like `M1` or `C12`,
+/// and these are their original names.
+#[derive(Clone, Debug, Default, Eq, PartialEq)]
+pub struct LefDefNames {
+    /// routing layers
+    pub layers: Vec<String>,
+    /// macros
+    pub mastercells: Vec<String>,
+    /// pins of every macro, only those on a routing layer
+    pub pins: Vec<Vec<String>>,
+    /// components
+    pub cells: Vec<String>,
+    /// nets
+    pub nets: Vec<String>,
+}
+
+/// A routing layer of a LEF file.
+#[derive(Clone, Debug)]
+struct LefLayer {
+    /// name of the layer
+    name: String,
+    /// whether the layer is horizontal
+    horizontal: bool,
+    /// distance between tracks, in microns
+    pitch: f64,
+}
+
+/// A macro of a LEF file, with its pins and the routing layer of each.
+#[derive(Clone, Debug)]
+struct LefMacro {
+    /// name of the macro
+    name: String,
+    /// pins and their layers
+    pins: Vec<(String, usize)>,
+}
+
+/// Words of LEF or DEF content, without comments, looking ahead to find the ends of blocks.
+/// Semicolons and parentheses are words even if not separated by whitespace.
+#[derive(Clone, Debug)]
+struct Words {
+    /// all the words
+    words: Vec<String>,
+    /// index of the next word
+    pos: usize,
+}
+
+impl Words {
+    /// Splits `content`.
+    fn new(content: &str) -> Self {
+        let words = content
+            .lines()
+            .map(|line| line.split('#').next().unwrap_or(""))
+            .flat_map(|line| {
+                line.replace(';', " ; ")
+                    .replace('(', " ( ")
+                    .replace(')', " ) ")
+                    .split_whitespace()
+                    .map(str::to_string)
+                    .collect::<Vec<_>>()
+            })
+            .collect();
+        Self { words, pos: 0 }
+    }
+
+    /// The word `ahead` words after the next one, without reading it.
+    fn peek(&self, ahead: usize) -> Option<&str> {
+        self.words.get(self.pos + ahead).map(String::as_str)
+    }
+
+    /// Whether the next words are `END <name>`, which are read if so.
+    fn end(&mut self, name: &str) -> bool {
+        let found = self.peek(0) == Some("END") && self.peek(1) == Some(name);
+        if found {
+            self.pos += 2;
+        }
+        found
+    }
+
+    /// Reads the next word.
+    fn word(&mut self) -> Result<String> {
+        let word = self
+            .words
+            .get(self.pos)
+            .cloned()
+            .ok_or_else(|| anyhow!("Unexpected end of input"))?;
+        self.pos += 1;
+        Ok(word)
+    }
+
+    /// Reads the rest of a statement, up to its semicolon.
+    fn statement(&mut self) -> Result<Vec<String>> {
+        let mut words = Vec::new();
+        loop {
+            match self.word()? {
+                word if word == ";" => return Ok(words),
+                word => words.push(word),
+            }
+        }
+    }
+
+    /// Skips words up to `END <name>`, or a lone `END` if `name` is empty.
+    fn skip_block(&mut self, name: &str) -> Result<()> {
+        loop {
+            if self.word()? == "END" && (name.is_empty() || self.end_name(name)) {
+                return Ok(());
+            }
+        }
+    }
+
+    /// Whether the next word is `name`, which is read if so.
+    fn end_name(&mut self, name: &str) -> bool {
+        let found = self.peek(0) == Some(name);
+        if found {
+            self.pos += 1;
+        }
+        found
+    }
+}
+
+/// Parses a word of a statement as a number.
+fn number<T>(word: Option<&String>) -> Result<T>
+where
+    T: FromStr,
+{
+    word.and_then(|word| word.parse().ok())
+        .ok_or_else(|| anyhow!("Expected a number, found {:?}", word))
+}
+
+/// Reads the routing layers and the macros of a LEF file.
+fn read_lef(content: &str) -> Result<(Vec<LefLayer>, Vec<LefMacro>)> {
+    let words = &mut Words::new(content);
+    let (mut layers, mut macros) = (Vec::new(), Vec::new());
+
+    while words.peek(0).is_some() {
+        if words.end("LIBRARY") {
+            break;
+        }
+
+        match words.word()?.as_str() {
+            "LAYER" => {
+                let name = words.word()?;
+                let layer = read_layer(words, &name)
+                    .map_err(|err| anyhow!("In LAYER {}: {}", name, err))?;
+                layers.extend(layer);
+            }
+            "MACRO" => {
+                let name = words.word()?;
+                let pins = read_macro(words, &name, &layers)
+                    .map_err(|err| anyhow!("In MACRO {}: {}", name, err))?;
+                macros.push(LefMacro { name, pins });
+            }
+            "VIA" | "VIARULE" | "SITE" | "NONDEFAULTRULE" => {
+                let name = words.word()?;
+                words.skip_block(&name)?;
+            }
+            section @ "UNITS" | section @ "SPACING" | section @ "PROPERTYDEFINITIONS" => {
+                words.skip_block(section)?
+            }
+            _ => {
+                words.statement()?;
+            }
+        }
+    }
+
+    Ok((layers, macros))
+}
+
+/// Reads a layer up to its `END <name>`, returning it if it is a routing layer.
+fn read_layer(words: &mut Words, name: &str) -> Result<Option<LefLayer>> {
+    let (mut routing, mut horizontal, mut pitch) = (false, None, None);
+
+    while !words.end(name) {
+        let statement = words.statement()?;
+        let value = statement.get(1);
+        match statement.first().map(String::as_str) {
+            Some("TYPE") => routing = value.map(String::as_str) == Some("ROUTING"),
+            Some("DIRECTION") => horizontal = Some(value.map(String::as_str) == Some("HORIZONTAL")),
+            Some("PITCH") => pitch = Some(number::<f64>(value)?),
+            _ => {}
+        }
+    }
+
+    if !routing {
+        return Ok(None);
+    }
+    Ok(Some(LefLayer {
+        name: name.to_string(),
+        horizontal: horizontal.ok_or_else(|| anyhow!("Missing DIRECTION"))?,
+        pitch: pitch.ok_or_else(|| anyhow!("Missing PITCH"))?,
+    }))
+}
+
+/// Reads the pins of a macro up to its `END <name>`.
+/// Pins are kept only if a port is on a routing layer, and obstructions are skipped.
+fn read_macro(words: &mut Words, name: &str, layers: &[LefLayer]) -> Result<Vec<(String, usize)>> {
+    let mut pins = Vec::new();
+
+    while !words.end(name) {
+        match words.peek(0) {
+            Some("OBS") => {
+                words.word()?;
+                words.skip_block("")?;
+            }
+            Some("PIN") => {
+                words.word()?;
+                let pin = words.word()?;
+                let mut layer = None;
+
+                while !words.end(&pin) {
+                    match words.word()?.as_str() {
+                        // ports have no name, and end with a lone `END`
+                        "PORT" | "END" => {}
+                        "LAYER" => {
+                            let statement = words.statement()?;
+                            let found = statement.first().and_then(|name| {
+                                layers.iter().position(|layer| &layer.name == name)
+                            });
+                            layer = layer.or(found);
+                        }
+                        _ => {
+                            words.statement()?;
+                        }
+                    }
+                }
+
+                if let Some(layer) = layer {
+                    pins.push((pin, layer));
+                }
+            }
+            _ => {
+                words.statement()?;
+            }
+        }
+    }
+
+    Ok(pins)
+}
+
+/// Translates a LEF file and a DEF file into the content of an input file.
+/// Components are put on the GCell holding their location, given by `GCELLGRID`,
+/// and the supply of a layer is the number of its tracks across a GCell.
+/// Every placed component is movable, and nets come unrouted.
+/// Obstructions, special nets and IO pins are not translated.
+pub fn translate_lef_def(lef: &str, def: &str) -> Result<(String, LefDefNames)> {
+    let (layers, macros) = read_lef(lef).map_err(|err| anyhow!("In LEF: {}", err))?;
+    read_def(def, &layers, &macros).map_err(|err| anyhow!("In DEF: {}", err))
+}
+
+/// Reads a DEF file against the content of its LEF file, see `translate_lef_def`.
+fn read_def(
+    content: &str,
+    layers: &[LefLayer],
+    macros: &[LefMacro],
+) -> Result<(String, LefDefNames)> {
+    let words = &mut Words::new(content);
+
+    let mut microns = None;
+    // start and step of GCells along x and y, and their numbers
+    let (mut xgrid, mut ygrid) = (None, None);
+    // name, macro, position, fixed
+    let mut components: Vec<(String, usize, (f64, f64), bool)> = Vec::new();
+    // name, component and pin ids
+    let mut nets: Vec<(String, Vec<(usize, usize)>)> = Vec::new();
+
+    let macro_ids: HashMap<_, _> = macros
+        .iter()
+        .enumerate()
+        .map(|(id, mc)| (mc.name.as_str(), id))
+        .collect();
+
+    while words.peek(0).is_some() {
+        if words.end("DESIGN") {
+            break;
+        }
+
+        match words.word()?.as_str() {
+            "UNITS" => {
+                // UNITS DISTANCE MICRONS <dbuPerMicron>
+                let statement = words.statement()?;
+                microns = Some(number::<f64>(statement.get(2))?);
+            }
+            "GCELLGRID" => {
+                // GCELLGRID X <start> DO <numLines> STEP <step>
+                let statement = words.statement()?;
+                let start: f64 = number(statement.get(1))?;
+                let lines: usize = number(statement.get(3))?;
+                let step: f64 = number(statement.get(5))?;
+                let grid = Some((start, step, lines.saturating_sub(1)));
+
+                match statement.first().map(String::as_str) {
+                    Some("X") if xgrid.is_none() => xgrid = grid,
+                    Some("Y") if ygrid.is_none() => ygrid = grid,
+                    _ => return Err(anyhow!("Only uniform GCELLGRIDs are supported")),
+                }
+            }
+            "COMPONENTS" => {
+                words.statement()?;
+                while !words.end("COMPONENTS") {
+                    // - <name> <macro> + PLACED ( <x> <y> ) <orientation>
+                    let statement = words.statement()?;
+                    let name = statement.get(1).cloned().unwrap_or_default();
+                    let mc = statement
+                        .get(2)
+                        .and_then(|mc| macro_ids.get(mc.as_str()))
+                        .ok_or_else(|| anyhow!("Macro of component {} not found", name))?;
+                    let status = statement
+                        .iter()
+                        .position(|word| word == "PLACED" || word == "FIXED" || word == "COVER")
+                        .ok_or_else(|| anyhow!("Component {} is not placed", name))?;
+                    let x: f64 = number(statement.get(status + 2))?;
+                    let y: f64 = number(statement.get(status + 3))?;
+
+                    components.push((name, *mc, (x, y), statement[status] != "PLACED"));
+                }
+            }
+            "NETS" => {
+                let component_ids: HashMap<_, _> = components
+                    .iter()
+                    .enumerate()
+                    .map(|(id, (name, ..))| (name.as_str(), id))
+                    .collect();
+
+                words.statement()?;
+                while !words.end("NETS") {
+                    // - <name> ( <component> <pin> ) ... + <option> ...
+                    let statement = words.statement()?;
+                    let name = statement.get(1).cloned().unwrap_or_default();
+                    let end = statement
+                        .iter()
+                        .position(|word| word == "+")
+                        .unwrap_or_else(|| statement.len());
+
+                    let mut pins = Vec::new();
+                    for group in statement.get(2..end).unwrap_or_default().chunks(4) {
+                        let (component, pin) = match group {
+                            [open, component, pin, close] if open == "(" && close == ")" => {
+                                (component, pin)
+                            }
+                            _ => return Err(anyhow!("Malformed pins of net {}", name)),
+                        };
+
+                        // pins of the design itself
+                        if component == "PIN" {
+                            continue;
+                        }
+
+                        let cell = *component_ids.get(component.as_str()).ok_or_else(|| {
+                            anyhow!("Component {} of net {} not found", component, name)
+                        })?;
+                        let pin = macros[components[cell].1]
+                            .pins
+                            .iter()
+                            .position(|(other, _)| other == pin)
+                            .ok_or_else(|| {
+                                anyhow!("Pin {} of {} has no routing layer", pin, component)
+                            })?;
+                        pins.push((cell, pin));
+                    }
+
+                    nets.push((name, pins));
+                }
+            }
+            section if SKIPPED_SECTIONS.contains(&section) => words.skip_block(section)?,
+            _ => {
+                words.statement()?;
+            }
+        }
+    }
+
+    let microns = microns.ok_or_else(|| anyhow!("Missing UNITS DISTANCE MICRONS"))?;
+    let (xstart, xstep, cols) = xgrid.ok_or_else(|| anyhow!("Missing GCELLGRID X"))?;
+    let (ystart, ystep, rows) = ygrid.ok_or_else(|| anyhow!("Missing GCELLGRID Y"))?;
+
+    let mut text = String::new();
+    let movable = components.iter().filter(|(.., fixed)| !fixed).count();
+    writeln!(text, "MaxCellMove {}", movable)?;
+    writeln!(text, "GGridBoundaryIdx 1 1 {} {}", rows, cols)?;
+
+    // tracks of a horizontal layer are stacked along y, the ones of a vertical layer along x
+    writeln!(text, "NumLayer {}", layers.len())?;
+    for (id, layer) in layers.iter().enumerate() {
+        let (step, dir) = if layer.horizontal {
+            (ystep, "H")
+        } else {
+            (xstep, "V")
+        };
+        let supply = (step / (layer.pitch * microns)).floor() as usize;
+        writeln!(
+            text,
+            "Lay {} {} {} {}",
+            Layer::from_num(id)?,
+            id + 1,
+            dir,
+            supply
+        )?;
+    }
+    writeln!(text, "NumNonDefaultSupplyGGrid 0")?;
+
+    writeln!(text, "NumMasterCell {}", macros.len())?;
+    for (id, mc) in macros.iter().enumerate() {
+        writeln!(
+            text,
+            "MasterCell {} {} 0",
+            MasterCell::from_num(id)?,
+            mc.pins.len()
+        )?;
+        for (pin, &(_, layer)) in mc.pins.iter().enumerate() {
+            writeln!(
+                text,
+                "Pin {} {}",
+                MasterPin::from_num(pin)?,
+                Layer::from_num(layer)?
+            )?;
+        }
+    }
+    writeln!(text, "NumNeighborCellExtraDemand 0")?;
+
+    writeln!(text, "NumCellInst {}", components.len())?;
+    for (id, (name, mc, (x, y), fixed)) in components.iter().enumerate() {
+        let col = ((x - xstart) / xstep).floor();
+        let row = ((y - ystart) / ystep).floor();
+        if col < 0. || row < 0. {
+            return Err(anyhow!("Component {} is outside of the GCells", name));
+        }
+        writeln!(
+            text,
+            "CellInst {} {} {} {} {}",
+            Cell::from_num(id)?,
+            MasterCell::from_num(*mc)?,
+            row as usize + 1,
+            col as usize + 1,
+            if *fixed { "Fixed" } else { "Movable" }
+        )?;
+    }
+
+    writeln!(text, "NumNets {}", nets.len())?;
+    for (id, (_, pins)) in nets.iter().enumerate() {
+        writeln!(text, "Net {} {} NoCstr", Net::from_num(id)?, pins.len())?;
+        for &(cell, pin) in pins.iter() {
+            writeln!(
+                text,
+                "Pin {}/{}",
+                Cell::from_num(cell)?,
+                MasterPin::from_num(pin)?
+            )?;
+        }
+    }
+    writeln!(text, "NumRoutes 0")?;
+
+    let names = LefDefNames {
+        layers: layers.iter().map(|layer| layer.name.clone()).collect(),
+        mastercells: macros.iter().map(|mc| mc.name.clone()).collect(),
+        pins: macros
+            .iter()
+            .map(|mc| mc.pins.iter().map(|(pin, _)| pin.clone()).collect())
+            .collect(),
+        cells: components.into_iter().map(|(name, ..)| name).collect(),
+        nets: nets.into_iter().map(|(name, _)| name).collect(),
+    };
+
+    Ok((text, names))
+}
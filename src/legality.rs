@@ -0,0 +1,110 @@
+use crate::{
+    chip::Chip,
+    components::{Direction, FactoryID, Layer, Pair, Point, Route, Towards},
+};
+use std::fmt::{Display, Error as FmtError, Formatter, Result as FmtResult};
+
+/// Why a route may not be used by a net, found by `route_violation`.
+/// Routes are kept as they are stored, with indices starting from 0.
+#[derive(Clone, Copy, Debug, Eq, Hash, PartialEq)]
+pub enum RouteViolation {
+    /// goes along more than one axis, like a via also changing its grid
+    Diagonal { route: Route<usize> },
+    /// has an end out of the grid boundary or the layers
+    OutOfBounds { route: Route<usize> },
+    /// goes along a layer below the min layer of the net
+    BelowMinLayer {
+        route: Route<usize>,
+        min_layer: usize,
+    },
+    /// goes along a layer against its direction
+    AgainstDirection { route: Route<usize>, layer: usize },
+}
+
+impl RouteViolation {
+    /// The route violating.
+    pub fn route(&self) -> Route<usize> {
+        match *self {
+            Self::Diagonal { route }
+            | Self::OutOfBounds { route }
+            | Self::BelowMinLayer { route, .. }
+            | Self::AgainstDirection { route, .. } => route,
+        }
+    }
+}
+
+impl Display for RouteViolation {
+    fn fmt(&self, f: &mut Formatter) -> FmtResult {
+        let route = self.route().external();
+        match *self {
+            Self::Diagonal { .. } => write!(f, "Route {} is diagonal", route),
+            Self::OutOfBounds { .. } => write!(f, "Route {} is out of bounds", route),
+            Self::BelowMinLayer { min_layer, .. } => write!(
+                f,
+                "Route {} is below the min layer {}",
+                route,
+                Layer::from_num(min_layer).map_err(|_| FmtError)?
+            ),
+            Self::AgainstDirection { layer, .. } => write!(
+                f,
+                "Route {} goes against the direction of {}",
+                route,
+                Layer::from_num(layer).map_err(|_| FmtError)?
+            ),
+        }
+    }
+}
+
+/// Checks why a route may not be used by a net, if it may not.
+/// Vias only change layer, and may go below the min layer to reach pins.
+pub fn route_violation(chip: &Chip, net: usize, route: &Route<usize>) -> Option<RouteViolation> {
+    let Pair(rows, cols) = chip.dim;
+    let inside = |point: Point<usize>| {
+        point.row() < rows && point.col() < cols && point.lay() < chip.layers.len()
+    };
+
+    let route = *route;
+    if route.validate().is_err() {
+        return Some(RouteViolation::Diagonal { route });
+    }
+    if !inside(route.source()) || !inside(route.target()) {
+        return Some(RouteViolation::OutOfBounds { route });
+    }
+
+    let direction = match route.towards() {
+        Some(Towards::Left) | Some(Towards::Right) => Direction::Vertical,
+        Some(Towards::Up) | Some(Towards::Down) => Direction::Horizontal,
+        _ => return None,
+    };
+    let layer = route.target().lay();
+    let min_layer = chip.nets[net].min_layer;
+    if layer < min_layer {
+        return Some(RouteViolation::BelowMinLayer { route, min_layer });
+    }
+    if chip.layers[layer].direction != direction {
+        return Some(RouteViolation::AgainstDirection { route, layer });
+    }
+    None
+}
+
+/// Checks the routes of every net, giving the violations of the nets having any,
+/// as (net, violations) sorted by net, and by route within a net.
+pub fn check_routes(chip: &Chip) -> Vec<(usize, Vec<RouteViolation>)> {
+    chip.nets
+        .iter()
+        .filter_map(|net| {
+            let mut violations: Vec<_> = net
+                .segments()
+                .iter()
+                .filter_map(|route| route_violation(chip, net.id, route))
+                .collect();
+            violations.sort_unstable_by_key(RouteViolation::route);
+
+            if violations.is_empty() {
+                None
+            } else {
+                Some((net.id, violations))
+            }
+        })
+        .collect()
+}
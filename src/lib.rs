@@ -1,10 +1,99 @@
 mod args;
+mod bench;
+mod best;
+mod bookshelf;
+mod cache;
 mod chip;
 mod components;
+mod congestion;
 mod consts;
+mod criticality;
+mod dashboard;
+mod decompose;
+mod deferred;
+mod design;
+mod ensemble;
+mod explain;
+mod flat;
+mod grid;
+mod ispd;
+mod layers;
+mod lefdef;
+mod legality;
+mod library;
+mod maze;
+mod optimizer;
+mod packed;
+mod pattern;
+mod plugin;
+mod pool;
+mod predictor;
+mod report;
+mod restart;
+mod rules;
+mod scheduler;
+mod schema;
+mod score;
+mod script;
+mod search;
+mod sections;
+mod solution;
+mod tiles;
+mod topology;
+mod tree;
 mod utilities;
+mod viz;
+mod watchdog;
+mod weights;
 
 pub use args::Args;
+pub use bench::{allocations, Counting, SectionBench};
+pub use best::Best;
+pub use bookshelf::{translate_bookshelf, BookshelfNames};
+pub use cache::{read_cache, write_cache};
 pub use chip::Chip;
 pub use components::*;
-pub use utilities::UnionFind;
+pub use congestion::CongestionMap;
+pub use criticality::Criticality;
+pub use dashboard::Dashboard;
+pub use decompose::{Decomposition, TwoPinTask};
+pub use deferred::{Deferred, Escalation};
+pub use design::{
+    Design, DesignArea, DesignCell, DesignLayer, DesignMasterCell, DesignNet, DesignRule, Violation,
+};
+pub use ensemble::ensemble;
+pub use explain::{explain, query};
+pub use flat::{PointMap, PointSet};
+pub use grid::{Demand, GCell, RoutingGrid};
+pub use ispd::translate_ispd;
+pub use layers::LayerTable;
+pub use lefdef::{translate_lef_def, LefDefNames};
+pub use legality::{check_routes, route_violation, RouteViolation};
+pub use library::MasterCellLib;
+pub use maze::{astar_route, maze_connect, maze_route, Heuristic, Manhattan};
+pub use optimizer::{reroute, reroute_bundle, route_net, try_move, Optimizer, Outcome, Routed};
+pub use packed::PackedRoutes;
+pub use pattern::{pattern_route, route_two_pins};
+pub use plugin::Plugin;
+pub use pool::Pool;
+pub use predictor::{LinearModel, Predictor, NUM_FEATURES};
+pub use report::Report;
+pub use restart::Restart;
+pub use rules::ExtraDemandRules;
+pub use scheduler::{Flush, Poll, Scheduler, Task};
+pub use schema::{current_version, read_versioned, write_versioned, Migration};
+pub use score::{score_file, Score};
+pub use script::{run_script, run_script_file, Command};
+pub use search::{path_routes, Moves, Search};
+pub use sections::{Sections, Selection};
+pub use solution::Solution;
+pub use tiles::{merge, partition, BoundaryNet, Tile, TileSolution};
+pub use topology::{kruskal_tree, prim_tree, steiner_tree, Topology};
+pub use tree::{RouteTree, TreeNode};
+pub use utilities::{
+    read_patterns, to_external, to_internal, Fnv, Lookahead, Rng, Tokenizer, Tokens, Traced,
+    UnionFind,
+};
+pub use viz::animate;
+pub use watchdog::{Progress, Watchdog};
+pub use weights::Weights;
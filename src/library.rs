@@ -0,0 +1,77 @@
+use crate::components::{Blockage, FactoryID, MasterCell, MasterPin};
+use anyhow::{anyhow, Result};
+
+/// The mastercells of a design, looked up by name, as in `MC1`.
+/// Pins and blockages are given sorted by id, with their layers starting from 0.
+#[derive(Clone, Copy, Debug)]
+pub struct MasterCellLib<'a> {
+    /// mastercells by id
+    mastercells: &'a [MasterCell],
+}
+
+impl<'a> MasterCellLib<'a> {
+    /// A library of mastercells, indexed by id.
+    pub fn new(mastercells: &'a [MasterCell]) -> Self {
+        Self { mastercells }
+    }
+
+    /// Number of mastercells.
+    pub fn len(&self) -> usize {
+        self.mastercells.len()
+    }
+
+    /// Whether there is no mastercell.
+    pub fn is_empty(&self) -> bool {
+        self.mastercells.is_empty()
+    }
+
+    /// Finds a mastercell by name.
+    pub fn get(&self, name: &str) -> Result<&'a MasterCell> {
+        self.mastercells
+            .get(MasterCell::from_str(name)?)
+            .ok_or_else(|| anyhow!("MasterCell {} not found", name))
+    }
+
+    /// Pins of a mastercell as (pin, layer).
+    pub fn pin_layers(&self, name: &str) -> Result<Vec<(usize, usize)>> {
+        let mut pins: Vec<_> = self
+            .get(name)?
+            .pins
+            .iter()
+            .map(|pin| (pin.id, pin.layer))
+            .collect();
+        pins.sort_unstable();
+        Ok(pins)
+    }
+
+    /// Layer of a pin of a mastercell, both by name.
+    pub fn pin_layer(&self, name: &str, pin: &str) -> Result<usize> {
+        self.get(name)?
+            .get_pin(MasterPin::from_str(pin)?)
+            .map(|pin| pin.layer)
+            .ok_or_else(|| anyhow!("Pin {} not found in {}", pin, name))
+    }
+
+    /// Blockages of a mastercell as (blockage, layer, demand).
+    pub fn blockage_demands(&self, name: &str) -> Result<Vec<(usize, usize, usize)>> {
+        let mut blkgs: Vec<_> = self
+            .get(name)?
+            .blkgs
+            .iter()
+            .map(|&Blockage { id, layer, demand }| (id, layer, demand))
+            .collect();
+        blkgs.sort_unstable();
+        Ok(blkgs)
+    }
+
+    /// Demand of the blockages of a mastercell on a layer.
+    pub fn demand_on(&self, name: &str, layer: usize) -> Result<usize> {
+        Ok(self
+            .get(name)?
+            .blkgs
+            .iter()
+            .filter(|blkg| blkg.layer == layer)
+            .map(|blkg| blkg.demand)
+            .sum())
+    }
+}
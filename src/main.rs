@@ -1,15 +1,232 @@
 use anyhow::Result;
-use cell_move_router::{Args, Chip};
+use cell_move_router::{
+    animate, ensemble, read_patterns, run_script, run_script_file, score_file, Args, Chip,
+    Counting, Criticality, LinearModel, Plugin, Pool, Solution, ViaModel, Weights, WrongWay,
+};
 use clap::Clap;
+use std::fs;
+
+#[global_allocator]
+static ALLOCATOR: Counting = Counting;
 
 fn main() -> Result<()> {
     let args = Args::parse();
 
+    if args.single {
+        rayon::ThreadPoolBuilder::new()
+            .num_threads(1)
+            .build_global()?;
+    }
+
     let mut chip = Chip::default();
+    chip.lenient = args.lenient;
+    if args.via_upper_only {
+        chip.via_model = ViaModel::Upper;
+    }
+    if let Some(cost) = args.wrong_way {
+        chip.wrong_way = WrongWay::Penalized(cost);
+    }
+
+    // outputs are scored against the design alone, the routes of the input are not read
+    if !args.score.is_empty() {
+        chip.read_unrouted(&args.infile)?;
+        if let Some(weights) = &args.weights {
+            chip.set_weights(Weights::read_file(weights)?);
+        }
+        if let Some(timing) = &args.timing {
+            chip.set_criticality(Criticality::read_file(timing)?)?;
+        }
+
+        let pool = Pool::new(rayon::current_num_threads());
+        let scores = pool.run(args.score.iter().map(|file| {
+            let chip = &chip;
+            (file.clone(), move || score_file(chip, file))
+        }));
+
+        for (file, score) in args.score.iter().zip(scores) {
+            println!("{}: {}", file, score?);
+        }
+        return Ok(());
+    }
+
+    if args.bench {
+        for bench in chip.bench_sections(&args.infile)? {
+            println!("{}", bench);
+        }
+        return Ok(());
+    }
+
+    let report = if let Some(lef) = &args.lef {
+        chip.read_lef_def(lef, &args.infile)?.0
+    } else if args.bookshelf {
+        chip.read_bookshelf(&args.infile)?.0
+    } else if args.ispd {
+        chip.read_ispd(&args.infile)?.0
+    } else if args.json {
+        chip.read_json(&args.infile)?
+    } else if let Some(patches) = &args.patch {
+        let patches: Vec<_> = patches.split(',').collect();
+        chip.read_patched(&args.infile, &patches)?
+    } else if args.debug_parse {
+        chip.read_traced(&args.infile)?
+    } else if args.cache {
+        chip.read_cached(&args.infile)?
+    } else if args.sections {
+        chip.read_sections(&args.infile)?
+    } else if args.mmap {
+        chip.read_mmap(&args.infile)?
+    } else {
+        chip.read_file(&args.infile)?
+    };
+    if args.verbose {
+        eprint!("{}", report);
+        eprintln!("Fingerprint {:016x}.", chip.fingerprint());
+    }
+    if args.fingerprint {
+        println!("{:016x}  {}", chip.fingerprint(), args.infile);
+        return Ok(());
+    }
+    if args.round_trip {
+        chip.check_round_trip()?;
+        eprintln!("{} is read back the same.", args.infile);
+        return Ok(());
+    }
+    if args.provenance {
+        chip.track_provenance();
+    }
+
+    if let Some(json) = &args.dump_json {
+        return chip.write_json(json);
+    }
+
+    if let (Some(svg), Some(dir)) = (&args.animate, &args.snapshots) {
+        let mut files = fs::read_dir(dir)?
+            .map(|entry| Ok(entry?.path()))
+            .collect::<Result<Vec<_>>>()?;
+        files.sort();
+
+        let snapshots = files
+            .iter()
+            .map(|file| Solution::read_for(&chip, &file.to_string_lossy()))
+            .collect::<Result<Vec<_>>>()?;
+
+        fs::write(svg, animate(&chip, &snapshots, 0.5))?;
+        return Ok(());
+    }
+
+    if let Some(weights) = &args.weights {
+        chip.set_weights(Weights::read_file(weights)?);
+    }
+
+    if let Some(timing) = &args.timing {
+        chip.set_criticality(Criticality::read_file(timing)?)?;
+    }
+
+    if let (Some(prev_infile), Some(prev_outfile)) = (&args.prev_infile, &args.prev_outfile) {
+        let mut old = Chip::default();
+        old.read_file(prev_infile)?;
+        let solution = Solution::read_for(&old, prev_outfile)?;
+
+        let reused = chip.warm_start(&old, &solution);
+        if args.verbose {
+            eprintln!("Warm start: reused {} of {} nets.", reused, chip.nets.len());
+        }
+    }
+
+    if args.prune {
+        let pruned = chip.prune_dangling();
+        if args.verbose {
+            eprintln!("Pruned the dangling routes of {} nets.", pruned);
+        }
+    }
+
+    if let Some(command) = &args.plugin {
+        chip.plugin = Some(Plugin::spawn(command)?);
+    }
+
+    if let Some(model) = &args.predictor {
+        chip.inflate(Box::new(LinearModel::read_file(model)?));
+    }
+
+    if let Some(patterns) = &args.reroute_nets {
+        let forced = chip.force_reroute(&read_patterns(patterns)?)?;
+        if args.verbose {
+            eprintln!("Rerouting {} of {} nets.", forced, chip.nets.len());
+        }
+    }
+
+    // once the forced nets are known, as they are left unpacked
+    if args.compact {
+        chip.pack_routes();
+    }
+
+    if !args.ensemble.is_empty() {
+        // one unreadable file is enough to give up on the others
+        let pool = Pool::new(rayon::current_num_threads());
+        let solutions = pool
+            .run(args.ensemble.iter().map(|file| {
+                let (chip, pool) = (&chip, &pool);
+                (file.clone(), move || {
+                    let solution = Solution::read_for(chip, file);
+                    if solution.is_err() {
+                        pool.cancel();
+                    }
+                    solution
+                })
+            }))
+            .into_iter()
+            .collect::<Result<Vec<_>>>()?;
+
+        let changed = ensemble(&mut chip, &solutions);
+        if args.verbose {
+            eprintln!(
+                "Ensemble: moved {} cells, rerouted {} of {} nets, {:.2}% better than the initial routing.",
+                chip.already_moved,
+                changed,
+                chip.nets.len(),
+                chip.improvement()
+            );
+        }
+
+        return chip.write_file(&args.outfile);
+    }
+
+    if let Some(checkpoint) = &args.checkpoint {
+        chip.apply(&Solution::read_for(&chip, checkpoint)?)?;
+    }
+
+    if let Some(net) = &args.explain {
+        return run_script(&format!("explain {}", net), &mut chip);
+    }
+
+    if let Some(grid) = &args.query {
+        return run_script(&format!("query {}", grid), &mut chip);
+    }
+
+    if let Some(script) = &args.script {
+        return run_script_file(script, &mut chip);
+    }
 
-    chip.read_file(&args.infile)?;
     chip.run(&args)?;
     chip.write_file(&args.outfile)?;
 
+    if args.verbose {
+        eprintln!(
+            "Wirelength {}, {:.2}% better than the initial {}.",
+            chip.wirelength(),
+            chip.improvement(),
+            chip.baseline
+        );
+        if let Some(counts) = chip.provenance_counts() {
+            for (pass, count) in counts {
+                eprintln!("{} segments from {}.", count, pass);
+            }
+        }
+    }
+
+    if let Some(placement) = &args.placement {
+        chip.write_placement(placement)?;
+    }
+
     Ok(())
 }
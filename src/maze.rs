@@ -0,0 +1,159 @@
+use crate::{
+    chip::Chip,
+    components::{Point, Route},
+    flat::PointSet,
+    search::{path_routes, Moves, Search},
+};
+use std::{cmp::Reverse, collections::BinaryHeap};
+
+/// Estimates the cost of the rest of a path in A*, see `astar_route`.
+/// Estimates must never exceed the actual cost for paths found to be the least costly.
+pub trait Heuristic {
+    /// The estimated cost of a path from `from` to `to` made of `moves`.
+    fn estimate(&self, moves: &Moves, from: Point<usize>, to: Point<usize>) -> usize;
+}
+
+/// The number of grids along rows and columns to go through plus the number of vias,
+/// each at the least a move costs, which no path of moves can beat.
+#[derive(Clone, Copy, Debug, Default)]
+pub struct Manhattan;
+
+impl Heuristic for Manhattan {
+    fn estimate(&self, moves: &Moves, from: Point<usize>, to: Point<usize>) -> usize {
+        let diff = |a: usize, b: usize| if a > b { a - b } else { b - a };
+        let grids =
+            diff(from.row(), to.row()) + diff(from.col(), to.col()) + diff(from.lay(), to.lay());
+        grids * moves.min_step()
+    }
+}
+
+/// Estimates nothing, so that A* spreads in order of cost like Dijkstra.
+#[derive(Clone, Copy, Debug, Default)]
+struct Blind;
+
+impl Heuristic for Blind {
+    fn estimate(&self, _: &Moves, _: Point<usize>, _: Point<usize>) -> usize {
+        0
+    }
+}
+
+/// Maze router on the 3D grid, after Lee: grids are reached in order of cost from `source`
+/// until one is `target`, whose path is then traced back.
+/// Moves are those of the search, so they follow layer directions
+/// and stay at or above the min layer of its net except for vias, and cost the weights of their layers.
+/// Grids without room are avoided, see `Search::room`, except both ends.
+/// Returns the routes of a least costly path, or `None` if there is none
+/// or the watchdog aborted the search.
+pub fn maze_route(
+    search: &Search,
+    source: Point<usize>,
+    target: Point<usize>,
+) -> Option<Vec<Route<usize>>> {
+    let path = spread(search, &[source], target, |point| point == target, &Blind)?;
+    Some(path_routes(&path))
+}
+
+/// Connects a tree of a net to the nearest of `targets`, like `maze_route`
+/// but spreading at once from every grid of `tree`, as the grids its routes go through.
+/// Returns the target reached with the routes of the path to it, none if it is already in the tree,
+/// or `None` if no target can be reached.
+pub fn maze_connect(
+    search: &Search,
+    tree: &[Point<usize>],
+    targets: &[Point<usize>],
+) -> Option<(Point<usize>, Vec<Route<usize>>)> {
+    let first = *targets.first()?;
+    let targets: PointSet = targets.iter().copied().collect();
+    let path = spread(search, tree, first, |point| targets.contains(point), &Blind)?;
+    let reached = *path.last().expect("Paths are not empty");
+    Some((reached, path_routes(&path)))
+}
+
+/// A* search from `source` to `target`, like `maze_route` but spreading first
+/// where `heuristic` estimates paths to be cheaper, so that fewer grids are reached on big grids.
+/// Paths are the least costly as long as `heuristic` never overestimates, like `Manhattan`.
+pub fn astar_route(
+    search: &Search,
+    source: Point<usize>,
+    target: Point<usize>,
+    heuristic: &dyn Heuristic,
+) -> Option<Vec<Route<usize>>> {
+    let path = spread(
+        search,
+        &[source],
+        target,
+        |point| point == target,
+        heuristic,
+    )?;
+    Some(path_routes(&path))
+}
+
+/// Spreads from `sources` until a grid is a target, and gives the path from a source to it.
+/// Grids are taken by estimated cost of the whole path, `heuristic` estimating the rest to `goal`,
+/// then by cost so far.
+/// Every grid taken is reported to the watchdog, which may abort the search.
+fn spread<F>(
+    search: &Search,
+    sources: &[Point<usize>],
+    goal: Point<usize>,
+    is_target: F,
+    heuristic: &dyn Heuristic,
+) -> Option<Vec<Point<usize>>>
+where
+    F: Fn(Point<usize>) -> bool,
+{
+    let chip = search.chip();
+    let moves = search.moves();
+    let mut cost = vec![usize::MAX; chip.layers.len() * chip.dim.size()];
+    let mut prev: Vec<Option<Point<usize>>> = vec![None; cost.len()];
+
+    // stale entries, reached cheaper since, are skipped
+    let mut open = BinaryHeap::new();
+    for &source in sources {
+        cost[chip.grid_index(source)] = 0;
+        open.push(Reverse((
+            heuristic.estimate(moves, source, goal),
+            0,
+            source,
+        )));
+    }
+
+    while let Some(Reverse((estimate, d, point))) = open.pop() {
+        if !search.pop(open.len(), estimate) {
+            return None;
+        }
+        if cost[chip.grid_index(point)] != d {
+            continue;
+        }
+        if is_target(point) {
+            return Some(trace(chip, &prev, point));
+        }
+
+        for (next, step) in moves.from(point) {
+            let idx = chip.grid_index(next);
+            if d + step >= cost[idx] || !(search.room(next) || is_target(next)) {
+                continue;
+            }
+
+            cost[idx] = d + step;
+            prev[idx] = Some(point);
+            open.push(Reverse((
+                d + step + heuristic.estimate(moves, next, goal),
+                d + step,
+                next,
+            )));
+        }
+    }
+
+    None
+}
+
+/// The path from a source to `end`, following where every grid was reached from.
+fn trace(chip: &Chip, prev: &[Option<Point<usize>>], end: Point<usize>) -> Vec<Point<usize>> {
+    let mut path = vec![end];
+    while let Some(point) = prev[chip.grid_index(*path.last().expect("Paths are not empty"))] {
+        path.push(point);
+    }
+    path.reverse();
+    path
+}
@@ -0,0 +1,488 @@
+use crate::{
+    chip::Chip,
+    components::{CellType, Pair, Provenance, Route},
+    consts::CANDIDATE_MOVES,
+    deferred::{Deferred, Escalation},
+    maze::{maze_connect, maze_route},
+    pattern::pattern_route,
+    scheduler::{Poll, Task},
+    search::Search,
+    topology::distance,
+    watchdog::Progress,
+};
+use anyhow::Result;
+use std::{
+    cmp::Ordering,
+    collections::{HashSet, VecDeque},
+    mem,
+    sync::Arc,
+    time::Instant,
+};
+
+/// What rerouting a net did.
+#[derive(Clone, Copy, Debug, Eq, Hash, PartialEq)]
+pub enum Outcome {
+    /// no route connects the net
+    Failed,
+    /// the routes found are no better, the net keeps its routes
+    Kept,
+    /// the net has new routes
+    Rerouted,
+}
+
+/// Routes found for a net by `route_net`.
+#[derive(Clone, Debug, Default, Eq, PartialEq)]
+pub struct Routed {
+    /// route segments of the net
+    pub routes: HashSet<Route<usize>>,
+    /// segments found by patterns, see `pattern_route`
+    pub patterns: HashSet<Route<usize>>,
+}
+
+/// A piece of work of an optimization pass.
+#[derive(Clone, Debug, Eq, Hash, PartialEq)]
+enum Work {
+    /// reroute the nets of a congested corridor together
+    Bundle(Vec<usize>),
+    /// reroute a net
+    Net(usize),
+    /// try moving a cell
+    Cell(usize),
+}
+
+/// Routes a net from scratch along the Steiner tree of its pins, see `Chip::decompose`,
+/// every 2-pin task by patterns or else `maze_route`, as `route_two_pins` does,
+/// reusing the grids of the tasks before, or else by `maze_connect` from anywhere on the tree routed so far,
+/// as hard as `escalation` says, see `Search::escalated`.
+/// The current routes of the net may be gone through, as they are replaced.
+/// Returns `None` if a task cannot be routed or the watchdog aborted the search.
+pub fn route_net(
+    chip: &Chip,
+    net: usize,
+    escalation: Escalation,
+    progress: Option<&Progress>,
+) -> Option<Routed> {
+    let search = Search::new(chip, net).escalated(escalation);
+    route_search(match progress {
+        Some(progress) => search.watched(progress),
+        None => search,
+    })
+}
+
+/// Routes the net of a search from scratch, see `route_net`.
+fn route_search(mut search: Search) -> Option<Routed> {
+    let topology = search.chip().steiner_topology(search.net());
+    let decomposition = search.chip().decompose(search.net(), &topology);
+
+    let mut routed = Routed::default();
+    let mut tree = Vec::new();
+    for task in decomposition.tasks.iter() {
+        tree.push(task.source);
+        let path = if let Some(path) = pattern_route(&search, task.source, task.target) {
+            routed.patterns.extend(path.iter().map(Route::normalized));
+            path
+        } else if let Some(path) = maze_route(&search, task.source, task.target) {
+            path
+        } else {
+            maze_connect(&search, &tree, &[task.target])?.1
+        };
+        tree.extend(path.iter().flat_map(Route::points));
+        search.extend(&path);
+        routed.routes.extend(path.iter().map(Route::normalized));
+    }
+    Some(routed)
+}
+
+/// Rips up a net and routes it again, see `route_net`.
+/// Nets which must be repaired, broken or longer than allowed, and forced nets not rerouted yet
+/// take any routes connecting them, overflowing grids as far as `escalation` tolerates;
+/// the others only shorter routes, overflowing nothing.
+/// The net is no longer dirty afterwards, whatever happened.
+pub fn reroute(
+    chip: &mut Chip,
+    net: usize,
+    escalation: Escalation,
+    progress: Option<&Progress>,
+) -> Outcome {
+    let urgent = chip.broken.contains(&net)
+        || chip.criticality.over_length(net, chip.nets[net].length())
+        || (chip.forced.contains(&net) && chip.nets[net].dirty);
+    chip.nets[net].dirty = false;
+
+    let escalation = if urgent {
+        escalation
+    } else {
+        Escalation {
+            tolerance: 0,
+            ..escalation
+        }
+    };
+    let routed = match route_net(chip, net, escalation, progress) {
+        Some(routed) if chip.connects(net, &routed.routes) => routed,
+        _ => return Outcome::Failed,
+    };
+
+    let shorter = chip.weighted_length(net, &routed.routes)
+        < chip.weighted_length(net, &chip.nets[net].segments());
+    if !(urgent || shorter) || *chip.nets[net].segments() == routed.routes {
+        return Outcome::Kept;
+    }
+
+    let pass = chip.pass;
+    if chip.broken.contains(&net) {
+        chip.pass = Provenance::Repair;
+    }
+    chip.set_routed(net, routed);
+    chip.pass = pass;
+    Outcome::Rerouted
+}
+
+/// Rips up the nets of a bundle together and routes them one after another, see `route_net`,
+/// away from congested corridors where they can, see `Search::around`,
+/// so that they do not push the congestion back and forth as when rerouted one by one.
+/// The new routes are kept if every net is routed, fewer grids overflow,
+/// or as many but the weighted length of the bundle is shorter; the old ones are put back otherwise.
+/// Returns whether the new routes are kept.
+pub fn reroute_bundle(chip: &mut Chip, nets: &[usize], progress: Option<&Progress>) -> bool {
+    let corridors = chip.congested_grids(&chip.demand);
+    let before: Vec<_> = nets
+        .iter()
+        .map(|&net| chip.nets[net].segments().into_owned())
+        .collect();
+    let length: f64 = nets
+        .iter()
+        .zip(before.iter())
+        .map(|(&net, routes)| chip.weighted_length(net, routes))
+        .sum();
+    let overflow = chip.overflowed_grids();
+
+    for &net in nets.iter() {
+        chip.set_routes(net, HashSet::new());
+    }
+    let mut routed = true;
+    for &net in nets.iter() {
+        let search = Search::new(chip, net)
+            .escalated(Escalation::after(0))
+            .around(&corridors);
+        let search = match progress {
+            Some(progress) => search.watched(progress),
+            None => search,
+        };
+        match route_search(search) {
+            Some(routed) if chip.connects(net, &routed.routes) => chip.set_routed(net, routed),
+            _ => {
+                routed = false;
+                break;
+            }
+        }
+    }
+
+    if routed {
+        let after: f64 = nets
+            .iter()
+            .map(|&net| chip.weighted_length(net, &chip.nets[net].segments()))
+            .sum();
+        let overflowed = chip.overflowed_grids();
+        if overflowed < overflow || (overflowed == overflow && after < length) {
+            return true;
+        }
+    }
+
+    for (&net, routes) in nets.iter().zip(before) {
+        chip.set_routes(net, routes);
+    }
+    false
+}
+
+/// Candidate grids to move a cell to, see `Chip::candidate_grids`, judged in turn
+/// closest first to the median of the other pins of its nets, see `Chip::judge_move`.
+/// The first `CANDIDATE_MOVES` not vetoed are kept, best scored first.
+fn candidates(chip: &mut Chip, cell: usize) -> Result<Vec<Pair<usize>>> {
+    let free = chip.free_grids(&chip.demand);
+    let mut candidates = chip.candidate_grids(cell, &free);
+
+    let (mut rows, mut cols): (Vec<_>, Vec<_>) = chip.cell_nets[cell]
+        .iter()
+        .flat_map(|&net| chip.pins_of_net(net).iter())
+        .filter(|pin| pin.cell != cell)
+        .map(|pin| (pin.position.row(), pin.position.col()))
+        .unzip();
+    if rows.is_empty() {
+        return Ok(Vec::new());
+    }
+    rows.sort_unstable();
+    cols.sort_unstable();
+    let median = Pair(rows[rows.len() / 2], cols[cols.len() / 2]);
+
+    candidates.sort_by_key(|&pos| (distance(pos, median), pos));
+
+    let mut judged = Vec::new();
+    for to in candidates {
+        if let Some(score) = chip.judge_move(cell, to)? {
+            judged.push((score, to));
+            if judged.len() == CANDIDATE_MOVES {
+                break;
+            }
+        }
+    }
+    judged.sort_by(|a, b| b.0.partial_cmp(&a.0).unwrap_or(Ordering::Equal));
+    Ok(judged.into_iter().map(|(_, to)| to).collect())
+}
+
+/// Tries moving a cell to its candidate grids in turn, see `candidates`,
+/// rerouting its nets every time, see `route_net`, without escalation.
+/// A move is kept if every net of the cell is connected, their weighted length is shorter
+/// (or some were broken before) and no more grids overflow; otherwise it is undone.
+/// Returns whether the cell moved.
+pub fn try_move(chip: &mut Chip, cell: usize, progress: Option<&Progress>) -> Result<bool> {
+    if chip.cells[cell].movable == CellType::Fixed
+        || (!chip.cells[cell].moved && chip.already_moved >= chip.max_move)
+    {
+        return Ok(false);
+    }
+
+    let nets = chip.cell_nets[cell].clone();
+    for to in candidates(chip, cell)? {
+        let from = chip.cells[cell].position;
+        let moved = chip.cells[cell].moved;
+        let before: Vec<_> = nets
+            .iter()
+            .map(|&net| chip.nets[net].segments().into_owned())
+            .collect();
+        let dirty: Vec<_> = nets.iter().map(|&net| chip.nets[net].dirty).collect();
+        let length: f64 = nets
+            .iter()
+            .zip(before.iter())
+            .map(|(&net, routes)| chip.weighted_length(net, routes))
+            .sum();
+        let broken = nets.iter().any(|net| chip.broken.contains(net));
+        let overflow = chip.overflowed_grids();
+
+        chip.move_cell(cell, to);
+        for &net in nets.iter() {
+            if let Some(routed) = route_net(chip, net, Escalation::after(0), progress) {
+                if chip.connects(net, &routed.routes) {
+                    chip.set_routed(net, routed);
+                }
+            }
+        }
+
+        let connected = nets.iter().all(|net| !chip.broken.contains(net));
+        let after: f64 = nets
+            .iter()
+            .map(|&net| chip.weighted_length(net, &chip.nets[net].segments()))
+            .sum();
+        if connected && (broken || after < length) && chip.overflowed_grids() <= overflow {
+            for &net in nets.iter() {
+                chip.nets[net].dirty = false;
+            }
+            return Ok(true);
+        }
+
+        // undone, routes first so that the nets are connected again once the cell is back
+        for (&net, routes) in nets.iter().zip(before) {
+            chip.set_routes(net, routes);
+        }
+        chip.move_cell(cell, from);
+        if !moved {
+            chip.cells[cell].moved = false;
+            chip.already_moved -= 1;
+        }
+        for (&net, dirty) in nets.iter().zip(dirty) {
+            chip.nets[net].dirty = dirty;
+        }
+    }
+
+    Ok(false)
+}
+
+/// Optimizes a chip pass after pass, as a task:
+/// every pass reroutes the nets of congested corridors together if told so, see `bundles`,
+/// then the nets that can be improved, see `Chip::improvable_nets`,
+/// then tries moving the cells of the nets longest above their lower bound, see `try_move`.
+/// Broken nets are repaired in any case. Cells are left where they are while nets are forced.
+/// Nets failing to route are deferred to the next passes, tried harder every time,
+/// up to moving their cells, see `Deferred`.
+/// Done once a pass improves nothing and no net is deferred, unless endless, see `endless`.
+#[derive(Debug)]
+pub struct Optimizer {
+    /// whether cells are moved
+    cells: bool,
+    /// whether nets are rerouted
+    nets: bool,
+    /// whether the nets of congested corridors are rerouted together
+    bundles: bool,
+    /// work left in the current pass
+    queue: VecDeque<Work>,
+    /// nets which failed to route, tried again in the next passes
+    deferred: Deferred,
+    /// progress of searches, reported to the watchdog
+    progress: Arc<Progress>,
+    /// improvements made in the current pass
+    improved: usize,
+    /// number of passes started
+    passes: usize,
+    /// whether passes go on after one improves nothing
+    endless: bool,
+}
+
+impl Optimizer {
+    /// Creates an optimizer moving cells if `cells` and rerouting nets if `nets`,
+    /// reporting the progress of its searches to `progress`.
+    pub fn new(cells: bool, nets: bool, progress: Arc<Progress>) -> Self {
+        Self {
+            cells,
+            nets,
+            bundles: false,
+            queue: VecDeque::new(),
+            deferred: Deferred::new(),
+            progress,
+            improved: 0,
+            passes: 0,
+            endless: false,
+        }
+    }
+
+    /// Reroutes the nets of every congested corridor together first, if nets are rerouted,
+    /// see `reroute_bundle`.
+    pub fn bundles(mut self) -> Self {
+        self.bundles = true;
+        self
+    }
+
+    /// Keeps passing after a pass improves nothing, until stopped,
+    /// as restarts may give it more to do, see `Restart`.
+    pub fn endless(mut self) -> Self {
+        self.endless = true;
+        self
+    }
+
+    /// Number of passes started.
+    pub fn passes(&self) -> usize {
+        self.passes
+    }
+
+    /// Whether the last pass is over and the next one not started.
+    pub fn between_passes(&self) -> bool {
+        self.queue.is_empty()
+    }
+
+    /// Queues the work of a new pass, bundles first, then deferred nets.
+    fn plan(&mut self, chip: &Chip) {
+        if self.nets && self.bundles && chip.forced.is_empty() {
+            let bundles = chip.congested_bundles(&chip.demand);
+            self.queue.extend(bundles.into_iter().map(Work::Bundle));
+        }
+
+        let mut nets = Vec::new();
+        while let Some((net, _)) = self.deferred.pop() {
+            nets.push(net);
+        }
+        let others = if self.nets {
+            chip.improvable_nets()
+        } else {
+            chip.broken_nets()
+        };
+        for net in others {
+            if !nets.contains(&net) {
+                nets.push(net);
+            }
+        }
+        self.queue.extend(nets.into_iter().map(Work::Net));
+
+        if self.cells && chip.forced.is_empty() {
+            // how much longer the nets of a cell are than their lower bounds
+            let slack = |cell: usize| -> usize {
+                chip.cell_nets[cell]
+                    .iter()
+                    .map(|&net| chip.nets[net].length().saturating_sub(chip.bound(net)))
+                    .sum()
+            };
+            let mut cells: Vec<_> = chip
+                .cells
+                .iter()
+                .filter(|cell| cell.movable == CellType::Movable)
+                .map(|cell| (slack(cell.id), cell.id))
+                .filter(|&(slack, _)| slack > 0)
+                .collect();
+            cells.sort_by(|a, b| b.0.cmp(&a.0).then(a.1.cmp(&b.1)));
+            self.queue
+                .extend(cells.into_iter().map(|(_, cell)| Work::Cell(cell)));
+        }
+
+        self.improved = 0;
+        self.passes += 1;
+    }
+
+    /// Does a piece of work. Returns whether it improved anything.
+    fn work(&mut self, chip: &mut Chip, work: Work) -> Result<bool> {
+        let progress = Some(&*self.progress);
+        let net = match work {
+            Work::Bundle(nets) => return Ok(reroute_bundle(chip, &nets, progress)),
+            Work::Net(net) => net,
+            Work::Cell(cell) => return try_move(chip, cell, progress),
+        };
+
+        let escalation = self.deferred.escalation(net);
+        match reroute(chip, net, escalation, progress) {
+            Outcome::Rerouted => {
+                self.deferred.succeed(net);
+                Ok(true)
+            }
+            Outcome::Kept => {
+                self.deferred.succeed(net);
+                Ok(false)
+            }
+            Outcome::Failed => {
+                // cells in the way of a path may open one by moving
+                let mut moved = false;
+                if escalation.move_cells {
+                    let mut cells: Vec<_> =
+                        chip.nets[net].pins.iter().map(|&(cell, _)| cell).collect();
+                    cells.sort_unstable();
+                    cells.dedup();
+                    for cell in cells {
+                        moved |= try_move(chip, cell, progress)?;
+                    }
+                }
+                self.deferred.defer(net);
+                Ok(moved)
+            }
+        }
+    }
+}
+
+impl Task for Optimizer {
+    fn name(&self) -> &str {
+        "optimizer"
+    }
+
+    fn step(&mut self, chip: &mut Chip, until: Instant) -> Result<Poll> {
+        if self.queue.is_empty() {
+            let idle = self.improved == 0 && self.deferred.is_empty();
+            if self.passes > 0 && idle && !self.endless {
+                return Ok(Poll::Done);
+            }
+            self.plan(chip);
+        }
+
+        let pass = mem::replace(&mut chip.pass, Provenance::Maze(self.passes));
+        let mut result = Ok(());
+        while let Some(work) = self.queue.pop_front() {
+            match self.work(chip, work) {
+                Ok(improved) => self.improved += improved as usize,
+                Err(err) => {
+                    result = Err(err);
+                    break;
+                }
+            }
+            if Instant::now() >= until {
+                break;
+            }
+        }
+        chip.pass = pass;
+        result?;
+
+        Ok(Poll::Pending)
+    }
+}
@@ -0,0 +1,103 @@
+use crate::components::{Point, Route};
+use std::collections::HashSet;
+
+/// Routes packed in little memory, for nets that are not being processed.
+/// Routes are sorted, and the coordinates of every route are stored
+/// as differences from the previous route, in variable length integers.
+#[derive(Clone, Debug, Default, Eq, Hash, PartialEq)]
+pub struct PackedRoutes {
+    /// encoded differences
+    bytes: Vec<u8>,
+    /// number of routes
+    len: usize,
+}
+
+/// Coordinates of a route.
+fn coordinates(route: &Route<usize>) -> [usize; 6] {
+    let Route(Point(srow, scol, slay), Point(erow, ecol, elay)) = *route;
+    [srow, scol, slay, erow, ecol, elay]
+}
+
+/// Appends a signed integer, zigzag encoded so that small differences take one byte.
+fn write_varint(bytes: &mut Vec<u8>, value: i64) {
+    let mut zigzag = ((value << 1) ^ (value >> 63)) as u64;
+    while zigzag >= 0x80 {
+        bytes.push((zigzag as u8) | 0x80);
+        zigzag >>= 7;
+    }
+    bytes.push(zigzag as u8);
+}
+
+/// Reads a signed integer written by `write_varint`, advancing `pos`.
+fn read_varint(bytes: &[u8], pos: &mut usize) -> i64 {
+    let (mut zigzag, mut shift) = (0_u64, 0);
+    loop {
+        let byte = bytes[*pos];
+        *pos += 1;
+        zigzag |= u64::from(byte & 0x7f) << shift;
+        if byte < 0x80 {
+            break;
+        }
+        shift += 7;
+    }
+    (zigzag >> 1) as i64 ^ -((zigzag & 1) as i64)
+}
+
+impl PackedRoutes {
+    /// Packs routes.
+    pub fn pack(routes: &HashSet<Route<usize>>) -> Self {
+        let mut sorted: Vec<_> = routes.iter().map(coordinates).collect();
+        sorted.sort_unstable();
+
+        let mut bytes = Vec::with_capacity(6 * sorted.len());
+        let mut prev = [0; 6];
+        for coords in sorted.iter() {
+            for (&now, &before) in coords.iter().zip(prev.iter()) {
+                write_varint(&mut bytes, now as i64 - before as i64);
+            }
+            prev = *coords;
+        }
+        bytes.shrink_to_fit();
+
+        Self {
+            bytes,
+            len: sorted.len(),
+        }
+    }
+
+    /// Decodes the routes one by one.
+    pub fn iter(&self) -> impl Iterator<Item = Route<usize>> + '_ {
+        let mut prev = [0_i64; 6];
+        let mut pos = 0;
+
+        (0..self.len).map(move |_| {
+            for coord in prev.iter_mut() {
+                *coord += read_varint(&self.bytes, &mut pos);
+            }
+            let [srow, scol, slay, erow, ecol, elay] = prev;
+            Route::raw(
+                srow as usize,
+                scol as usize,
+                slay as usize,
+                erow as usize,
+                ecol as usize,
+                elay as usize,
+            )
+        })
+    }
+
+    /// Decodes all the routes.
+    pub fn unpack(&self) -> HashSet<Route<usize>> {
+        self.iter().collect()
+    }
+
+    /// Number of routes.
+    pub fn len(&self) -> usize {
+        self.len
+    }
+
+    /// Whether there is no route.
+    pub fn is_empty(&self) -> bool {
+        self.len == 0
+    }
+}
@@ -0,0 +1,125 @@
+use crate::{
+    components::{Direction, Pair, Point, Route},
+    maze::maze_route,
+    search::Search,
+};
+use std::cmp;
+
+/// Planar shapes a connection is tried with, as their corners from `from` to `to`:
+/// a straight line or the two L shapes, then the Z shapes bending at every row or column between.
+fn shapes(from: Pair<usize>, to: Pair<usize>) -> Vec<Vec<Pair<usize>>> {
+    let (Pair(srow, scol), Pair(trow, tcol)) = (from, to);
+    if srow == trow || scol == tcol {
+        return vec![vec![from, to]];
+    }
+
+    let mut shapes = vec![
+        vec![from, Pair(trow, scol), to],
+        vec![from, Pair(srow, tcol), to],
+    ];
+    let between = |a: usize, b: usize| cmp::min(a, b) + 1..cmp::max(a, b);
+    for col in between(scol, tcol) {
+        shapes.push(vec![from, Pair(srow, col), Pair(trow, col), to]);
+    }
+    for row in between(srow, trow) {
+        shapes.push(vec![from, Pair(row, scol), Pair(row, tcol), to]);
+    }
+    shapes
+}
+
+/// Routes of a shape from `source` to `target`, if it fits.
+/// Every leg goes along the layer of its direction nearest to the one before,
+/// or else nearest to the one of `target`,
+/// among those at or above the min layer with room all along, joined by vias at the corners.
+fn fit(
+    search: &Search,
+    shape: &[Pair<usize>],
+    source: Point<usize>,
+    target: Point<usize>,
+) -> Option<Vec<Route<usize>>> {
+    let chip = search.chip();
+    let fits = |route: Route<usize>| {
+        route
+            .points()
+            .all(|point| point == source || point == target || search.room(point))
+    };
+    let distance = |a: usize, b: usize| cmp::max(a, b) - cmp::min(a, b);
+
+    let mut routes = Vec::with_capacity(2 * shape.len());
+    let mut lay = source.lay();
+    for leg in shape.windows(2) {
+        let (from, to) = (leg[0], leg[1]);
+        if from == to {
+            continue;
+        }
+
+        let direction = if from.x() == to.x() {
+            Direction::Horizontal
+        } else {
+            Direction::Vertical
+        };
+        let mut layers: Vec<_> = (chip.nets[search.net()].min_layer..chip.layers.len())
+            .filter(|&layer| chip.layers[layer].direction == direction)
+            .collect();
+        layers.sort_by_key(|&layer| (distance(layer, lay), distance(layer, target.lay())));
+
+        let next = layers.into_iter().find(|&layer| {
+            fits(Route(from.with(lay), from.with(layer)))
+                && fits(Route(from.with(layer), to.with(layer)))
+        })?;
+        routes.push(Route(from.with(lay), from.with(next)));
+        routes.push(Route(from.with(next), to.with(next)));
+        lay = next;
+    }
+
+    let last = Route(target.flatten().with(lay), target);
+    if !fits(last) {
+        return None;
+    }
+    routes.push(last);
+
+    routes.retain(|route| !route.is_point());
+    Some(routes)
+}
+
+/// Routes two grids of a net without search, with a straight line, an L or a Z shape,
+/// the shortest in weighted length among the ones fitting with the fewest bends.
+/// Legs follow the directions of their layers, at or above the min layer of the net,
+/// through grids with room, see `Search::room`.
+/// Returns `None` if no shape fits.
+pub fn pattern_route(
+    search: &Search,
+    source: Point<usize>,
+    target: Point<usize>,
+) -> Option<Vec<Route<usize>>> {
+    let weights = &search.chip().weights;
+
+    // (bends, length, routes) of the best shape fitting so far
+    let mut best: Option<(usize, f64, Vec<Route<usize>>)> = None;
+    for shape in shapes(source.flatten(), target.flatten()) {
+        let bends = shape.len() - 2;
+        if matches!(best, Some((fewest, _, _)) if bends > fewest) {
+            break;
+        }
+
+        if let Some(routes) = fit(search, &shape, source, target) {
+            let length = weights.length_of(&routes.iter().copied().collect());
+            if best
+                .as_ref()
+                .map_or(true, |&(_, shortest, _)| length < shortest)
+            {
+                best = Some((bends, length, routes));
+            }
+        }
+    }
+    best.map(|(_, _, routes)| routes)
+}
+
+/// Routes two grids of a net by patterns, falling back to `maze_route` if no pattern fits.
+pub fn route_two_pins(
+    search: &Search,
+    source: Point<usize>,
+    target: Point<usize>,
+) -> Option<Vec<Route<usize>>> {
+    pattern_route(search, source, target).or_else(|| maze_route(search, source, target))
+}
@@ -0,0 +1,113 @@
+use crate::components::{Cell, FactoryID, Pair};
+use anyhow::{anyhow, Result};
+use serde::{Deserialize, Serialize};
+use std::{
+    io::{BufRead, BufReader, Write},
+    process::{Child, ChildStdin, ChildStdout, Command, Stdio},
+};
+
+/// An external process judging candidate moves.
+/// It is started once, and then receives one JSON query per line on its stdin
+/// and answers each with one JSON line on its stdout.
+#[derive(Debug)]
+pub struct Plugin {
+    /// the external process
+    child: Child,
+    /// where queries are written
+    stdin: ChildStdin,
+    /// where answers are read
+    stdout: BufReader<ChildStdout>,
+}
+
+/// A candidate move sent to the plugin.
+#[derive(Debug, Serialize)]
+struct Query {
+    /// name of the cell
+    cell: String,
+    /// current position
+    from: [usize; 2],
+    /// candidate position
+    to: [usize; 2],
+}
+
+/// The plugin's opinion on a candidate move.
+#[derive(Debug, Default, Deserialize)]
+struct Answer {
+    /// the move must not be made
+    #[serde(default)]
+    veto: bool,
+    /// the higher the better
+    #[serde(default)]
+    score: f64,
+}
+
+impl Plugin {
+    /// Starts the external process.
+    /// `command` is split on whitespace into the program and its arguments.
+    pub fn spawn(command: &str) -> Result<Self> {
+        let mut words = command.split_whitespace();
+        let program = words
+            .next()
+            .ok_or_else(|| anyhow!("Empty plugin command"))?;
+
+        let mut child = Command::new(program)
+            .args(words)
+            .stdin(Stdio::piped())
+            .stdout(Stdio::piped())
+            .spawn()?;
+
+        let stdin = child
+            .stdin
+            .take()
+            .ok_or_else(|| anyhow!("No plugin stdin"))?;
+        let stdout = child
+            .stdout
+            .take()
+            .ok_or_else(|| anyhow!("No plugin stdout"))?;
+
+        Ok(Self {
+            child,
+            stdin,
+            stdout: BufReader::new(stdout),
+        })
+    }
+
+    /// Asks the plugin about moving `cell` from `from` to `to`.
+    /// Returns `None` if the move is vetoed, its score otherwise.
+    pub fn judge(
+        &mut self,
+        cell: usize,
+        from: Pair<usize>,
+        to: Pair<usize>,
+    ) -> Result<Option<f64>> {
+        let (from, to) = (from.external(), to.external());
+        let query = Query {
+            cell: Cell::from_num(cell)?,
+            from: [from.x(), from.y()],
+            to: [to.x(), to.y()],
+        };
+
+        serde_json::to_writer(&mut self.stdin, &query)?;
+        writeln!(self.stdin)?;
+        self.stdin.flush()?;
+
+        let mut line = String::new();
+        if self.stdout.read_line(&mut line)? == 0 {
+            return Err(anyhow!("Plugin exited"));
+        }
+
+        let answer: Answer = serde_json::from_str(&line)?;
+        Ok(if answer.veto {
+            None
+        } else {
+            Some(answer.score)
+        })
+    }
+}
+
+impl Drop for Plugin {
+    fn drop(&mut self) {
+        let _ = self.child.kill();
+        let _ = self.child.wait();
+    }
+}
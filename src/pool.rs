@@ -0,0 +1,98 @@
+use anyhow::{anyhow, Result};
+use std::{
+    any::Any,
+    cmp,
+    panic::{self, AssertUnwindSafe},
+    sync::{
+        atomic::{AtomicBool, Ordering},
+        Arc, Mutex,
+    },
+};
+
+/// Runs batches of independent tasks on a fixed number of workers.
+/// Tasks are taken from their iterator only when a worker is free,
+/// so that at most one task per worker is ever out of the iterator.
+/// A panicking task fails alone, and every failure is tagged with the context of its task.
+/// Once cancelled, running tasks finish, and tasks not started yet are drained as cancelled.
+#[derive(Clone, Debug)]
+pub struct Pool {
+    /// number of workers
+    workers: usize,
+    /// set to stop starting tasks, shared by clones
+    cancelled: Arc<AtomicBool>,
+}
+
+/// Message of a panic payload.
+fn panic_message(payload: &(dyn Any + Send)) -> &str {
+    if let Some(message) = payload.downcast_ref::<&str>() {
+        message
+    } else if let Some(message) = payload.downcast_ref::<String>() {
+        message
+    } else {
+        "unknown panic"
+    }
+}
+
+impl Pool {
+    /// Creates a pool of `workers` workers, at least one.
+    pub fn new(workers: usize) -> Self {
+        Self {
+            workers: cmp::max(workers, 1),
+            cancelled: Arc::new(AtomicBool::new(false)),
+        }
+    }
+
+    /// Stops starting tasks, for this pool and its clones.
+    pub fn cancel(&self) {
+        self.cancelled.store(true, Ordering::Relaxed);
+    }
+
+    /// Whether the pool has been cancelled.
+    pub fn cancelled(&self) -> bool {
+        self.cancelled.load(Ordering::Relaxed)
+    }
+
+    /// Runs tasks, each paired with a context naming it in errors,
+    /// and returns their results in the order of the tasks.
+    pub fn run<I, F, T>(&self, tasks: I) -> Vec<Result<T>>
+    where
+        I: IntoIterator<Item = (String, F)>,
+        I::IntoIter: Send,
+        F: FnOnce() -> Result<T>,
+        T: Send,
+    {
+        let tasks = Mutex::new(tasks.into_iter().enumerate());
+        let results = Mutex::new(Vec::new());
+
+        rayon::scope(|scope| {
+            for _ in 0..self.workers {
+                scope.spawn(|_| loop {
+                    // the lock is released before running the task
+                    let next = tasks.lock().expect("Task queue poisoned").next();
+                    let (idx, (context, task)) = match next {
+                        Some(next) => next,
+                        None => break,
+                    };
+
+                    let result = if self.cancelled() {
+                        Err(anyhow!("Cancelled"))
+                    } else {
+                        match panic::catch_unwind(AssertUnwindSafe(task)) {
+                            Ok(result) => result,
+                            Err(payload) => Err(anyhow!("Panicked: {}", panic_message(&*payload))),
+                        }
+                    };
+
+                    results
+                        .lock()
+                        .expect("Results poisoned")
+                        .push((idx, result.map_err(|err| anyhow!("{}: {}", context, err))));
+                });
+            }
+        });
+
+        let mut results = results.into_inner().expect("Results poisoned");
+        results.sort_unstable_by_key(|&(idx, _)| idx);
+        results.into_iter().map(|(_, result)| result).collect()
+    }
+}
@@ -0,0 +1,64 @@
+use anyhow::{anyhow, Result};
+use std::{fmt::Debug, fs};
+
+/// Number of features describing a grid to a predictor.
+pub const NUM_FEATURES: usize = 3;
+
+/// Predicts how congested a grid is going to be.
+/// Features of a grid are, in order:
+/// its supply, the number of pins on it, and the number of nets whose bounding box covers it.
+pub trait Predictor: Debug + Send + Sync {
+    /// The predicted overflow ratio of a grid, 0 or less meaning no congestion.
+    fn predict(&self, features: &[f64; NUM_FEATURES]) -> f64;
+}
+
+/// A linear model `bias + weights * features`.
+#[derive(Clone, Debug, Default, PartialEq)]
+pub struct LinearModel {
+    /// the constant term
+    pub bias: f64,
+    /// one weight per feature
+    pub weights: [f64; NUM_FEATURES],
+}
+
+impl LinearModel {
+    /// Reads a model from a file.
+    pub fn read_file(filename: &str) -> Result<Self> {
+        let content: String = fs::read_to_string(filename)?;
+        Self::read_str(&content)
+    }
+
+    /// Reads a model from a string.
+    /// The bias comes first, followed by the weights, all separated by whitespace.
+    pub fn read_str(content: &str) -> Result<Self> {
+        let numbers = content
+            .split_whitespace()
+            .map(str::parse)
+            .collect::<Result<Vec<f64>, _>>()?;
+
+        match numbers.split_first() {
+            Some((&bias, weights)) if weights.len() == NUM_FEATURES => {
+                let mut model = Self {
+                    bias,
+                    ..Self::default()
+                };
+                model.weights.copy_from_slice(weights);
+                Ok(model)
+            }
+            _ => Err(anyhow!(
+                "Expected {} numbers in model, got {}",
+                NUM_FEATURES + 1,
+                numbers.len()
+            )),
+        }
+    }
+}
+
+impl Predictor for LinearModel {
+    fn predict(&self, features: &[f64; NUM_FEATURES]) -> f64 {
+        self.weights
+            .iter()
+            .zip(features.iter())
+            .fold(self.bias, |acc, (w, x)| acc + w * x)
+    }
+}
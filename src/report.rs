@@ -0,0 +1,54 @@
+use std::{
+    fmt::{Display, Formatter, Result as FmtResult},
+    time::Duration,
+};
+
+/// What happened while reading an input.
+#[derive(Clone, Debug, Default, PartialEq)]
+pub struct Report {
+    /// recoverable problems found in the input
+    pub warnings: Vec<String>,
+    /// number of layers
+    pub num_layers: usize,
+    /// number of mastercells
+    pub num_mastercells: usize,
+    /// number of cells
+    pub num_cells: usize,
+    /// number of nets
+    pub num_nets: usize,
+    /// number of route segments
+    pub num_routes: usize,
+    /// weighted wirelength of the initial routes, which scores are relative to
+    pub baseline: f64,
+    /// time spent parsing
+    pub elapsed: Duration,
+}
+
+impl Report {
+    /// Records a recoverable problem.
+    pub fn warn(&mut self, warning: String) {
+        self.warnings.push(warning);
+    }
+}
+
+impl Display for Report {
+    fn fmt(&self, f: &mut Formatter) -> FmtResult {
+        writeln!(
+            f,
+            "Read {} layers, {} mastercells, {} cells, {} nets, {} routes in {:?}.",
+            self.num_layers,
+            self.num_mastercells,
+            self.num_cells,
+            self.num_nets,
+            self.num_routes,
+            self.elapsed
+        )?;
+        writeln!(f, "Initial wirelength {}.", self.baseline)?;
+
+        for warning in self.warnings.iter() {
+            writeln!(f, "Warning: {}", warning)?;
+        }
+
+        Ok(())
+    }
+}
@@ -0,0 +1,120 @@
+use crate::{
+    best::Best,
+    chip::Chip,
+    components::CellType,
+    scheduler::{Poll, Task},
+    utilities::Rng,
+};
+use anyhow::Result;
+use std::time::{Duration, Instant};
+
+/// Restarts the search when it plateaus: once the best legal state has not improved for `patience`,
+/// reverts the chip to it, see `Best`,
+/// then perturbs it with a few random legal moves to get out of the local minimum.
+/// Nets broken by these moves are repaired first by the router.
+#[derive(Debug)]
+pub struct Restart {
+    /// time without improvement before restarting
+    patience: Duration,
+    /// time between two looks at the chip
+    period: Duration,
+    /// number of random moves after reverting
+    moves: usize,
+    /// source of the random moves
+    rng: Rng,
+    /// best legal state seen so far
+    best: Best,
+    /// time of the last improvement or restart
+    improved: Instant,
+    /// time of the last look at the chip
+    last: Instant,
+    /// number of restarts so far
+    restarts: usize,
+}
+
+impl Restart {
+    /// Creates a task restarting after `patience` without improvement,
+    /// looking at the chip every `period` and making `moves` random moves on restarts.
+    pub fn new(chip: &Chip, patience: Duration, period: Duration, moves: usize, seed: u64) -> Self {
+        Self {
+            patience,
+            period,
+            moves,
+            rng: Rng::new(seed),
+            best: Best::new(chip),
+            improved: Instant::now(),
+            last: Instant::now(),
+            restarts: 0,
+        }
+    }
+
+    /// Number of restarts so far.
+    pub fn restarts(&self) -> usize {
+        self.restarts
+    }
+
+    /// Moves a few random movable cells to random candidate grids,
+    /// never going over the maximum number of moved cells.
+    /// Moves vetoed by the plugin are not made, see `Chip::judge_move`.
+    fn perturb(&mut self, chip: &mut Chip) -> Result<()> {
+        let movable: Vec<_> = chip
+            .cells
+            .iter()
+            .filter(|cell| cell.movable == CellType::Movable)
+            .map(|cell| cell.id)
+            .collect();
+        if movable.is_empty() {
+            return Ok(());
+        }
+
+        for _ in 0..self.moves {
+            let cell = movable[self.rng.below(movable.len())];
+            if !chip.cells[cell].moved && chip.already_moved >= chip.max_move {
+                continue;
+            }
+
+            let free = chip.free_grids(&chip.demand);
+            let candidates = chip.candidate_grids(cell, &free);
+            if candidates.is_empty() {
+                continue;
+            }
+            let to = candidates[self.rng.below(candidates.len())];
+            if chip.judge_move(cell, to)?.is_some() {
+                chip.move_cell(cell, to);
+            }
+        }
+        Ok(())
+    }
+}
+
+impl Task for Restart {
+    fn name(&self) -> &str {
+        "restart"
+    }
+
+    fn step(&mut self, chip: &mut Chip, _until: Instant) -> Result<Poll> {
+        if self.last.elapsed() < self.period {
+            return Ok(Poll::Pending);
+        }
+        self.last = Instant::now();
+
+        if self.best.offer(chip) {
+            self.improved = Instant::now();
+        } else if self.improved.elapsed() >= self.patience {
+            self.best.revert(chip);
+            self.perturb(chip)?;
+            self.restarts += 1;
+            self.improved = Instant::now();
+        }
+
+        Ok(Poll::Pending)
+    }
+
+    fn finish(&mut self, chip: &mut Chip) -> Result<()> {
+        // never stop on a perturbed state
+        if !self.best.offer(chip) {
+            self.best.revert(chip);
+        }
+        Ok(())
+    }
+}
@@ -0,0 +1,84 @@
+use crate::components::{Conflict, ConflictType};
+use std::collections::{HashMap, HashSet};
+
+/// The extra demand rules between mastercells, keyed by (masterA, masterB, layer),
+/// the order of the mastercells not mattering.
+/// Rules listed more than once with different demands add up, as they do in the demand.
+#[derive(Clone, Debug, Default)]
+pub struct ExtraDemandRules {
+    /// demand of sameGGrid rules
+    same: HashMap<(usize, usize, usize), usize>,
+    /// demand of adjHGGrid rules
+    adjacent: HashMap<(usize, usize, usize), usize>,
+}
+
+impl ExtraDemandRules {
+    /// The rules in the conflicts of every mastercell, which list every rule from both sides.
+    pub fn new(conflicts: &HashMap<usize, HashSet<Conflict>>) -> Self {
+        let mut rules = Self::default();
+        for (&mc, conflicts) in conflicts.iter() {
+            // every rule between two mastercells is counted once, from the side of the smaller id
+            for conflict in conflicts.iter().filter(|conflict| mc <= conflict.id) {
+                let map = match conflict.kind {
+                    ConflictType::SameGGrid => &mut rules.same,
+                    ConflictType::AdjHGGrid => &mut rules.adjacent,
+                };
+                *map.entry((mc, conflict.id, conflict.layer)).or_insert(0) += conflict.demand;
+            }
+        }
+        rules
+    }
+
+    /// Number of (masterA, masterB, layer) with rules.
+    pub fn len(&self) -> usize {
+        self.same.len() + self.adjacent.len()
+    }
+
+    /// Whether there is no rule.
+    pub fn is_empty(&self) -> bool {
+        self.len() == 0
+    }
+
+    /// Demand of a pair of cells of two mastercells on the same grid, on a layer.
+    pub fn same_grid(&self, a: usize, b: usize, layer: usize) -> usize {
+        lookup(&self.same, a, b, layer)
+    }
+
+    /// Demand of a pair of cells of two mastercells on horizontally adjacent grids,
+    /// on a layer of both grids.
+    pub fn adjacent_grid(&self, a: usize, b: usize, layer: usize) -> usize {
+        lookup(&self.adjacent, a, b, layer)
+    }
+
+    /// Demand of a rule of either kind, see `same_grid` and `adjacent_grid`.
+    pub fn demand(&self, kind: ConflictType, a: usize, b: usize, layer: usize) -> usize {
+        match kind {
+            ConflictType::SameGGrid => self.same_grid(a, b, layer),
+            ConflictType::AdjHGGrid => self.adjacent_grid(a, b, layer),
+        }
+    }
+
+    /// Rules of a kind involving a mastercell, as (other mastercell, layer, demand), sorted.
+    pub fn of(&self, kind: ConflictType, mc: usize) -> Vec<(usize, usize, usize)> {
+        let map = match kind {
+            ConflictType::SameGGrid => &self.same,
+            ConflictType::AdjHGGrid => &self.adjacent,
+        };
+        let mut rules: Vec<_> = map
+            .iter()
+            .filter_map(|(&(a, b, layer), &demand)| match mc {
+                _ if mc == a => Some((b, layer, demand)),
+                _ if mc == b => Some((a, layer, demand)),
+                _ => None,
+            })
+            .collect();
+        rules.sort_unstable();
+        rules
+    }
+}
+
+/// Demand of a rule between two mastercells in either order, 0 if there is none.
+fn lookup(map: &HashMap<(usize, usize, usize), usize>, a: usize, b: usize, layer: usize) -> usize {
+    let key = if a <= b { (a, b, layer) } else { (b, a, layer) };
+    map.get(&key).copied().unwrap_or(0)
+}
@@ -0,0 +1,162 @@
+use crate::{best::Best, chip::Chip};
+use anyhow::{anyhow, Result};
+use std::time::{Duration, Instant};
+
+/// Whether a task has more work to do.
+#[derive(Clone, Copy, Debug, Eq, Hash, PartialEq)]
+pub enum Poll {
+    Pending,
+    Done,
+}
+
+/// A unit of work sharing a single thread with others.
+/// A task works until `until`, then yields back to the scheduler.
+pub trait Task {
+    /// Name of the task, used in logs.
+    fn name(&self) -> &str;
+
+    /// Works on the chip until `until` at most.
+    fn step(&mut self, chip: &mut Chip, until: Instant) -> Result<Poll>;
+
+    /// Wraps up once the scheduler stops, done or not.
+    fn finish(&mut self, _chip: &mut Chip) -> Result<()> {
+        Ok(())
+    }
+}
+
+/// Runs tasks cooperatively on a single thread, one time slice each in turn.
+/// The scheduler stops once every foreground task is done or the deadline is reached.
+/// Background tasks only run while there are foreground tasks left.
+pub struct Scheduler {
+    /// length of a time slice
+    slice: Duration,
+    /// tasks whose completion is waited for
+    foreground: Vec<Box<dyn Task>>,
+    /// tasks running alongside, never waited for
+    background: Vec<Box<dyn Task>>,
+}
+
+/// Periodically writes the best solution so far to the output file,
+/// so that a solution is on disk whenever the process gets killed.
+/// The chip is reverted to the best solution once the scheduler stops.
+#[derive(Debug)]
+pub struct Flush {
+    /// output file name
+    filename: String,
+    /// time between two looks at the chip
+    period: Duration,
+    /// time of the last look at the chip
+    last: Instant,
+    /// best solution so far, the one on disk once written
+    best: Best,
+}
+
+impl Scheduler {
+    /// Creates a scheduler giving each task `slice` at a time.
+    pub fn new(slice: Duration) -> Self {
+        Self {
+            slice,
+            foreground: Vec::new(),
+            background: Vec::new(),
+        }
+    }
+
+    /// Adds a task whose completion is waited for.
+    pub fn spawn(&mut self, task: Box<dyn Task>) {
+        self.foreground.push(task);
+    }
+
+    /// Adds a task running alongside the others.
+    pub fn spawn_background(&mut self, task: Box<dyn Task>) {
+        self.background.push(task);
+    }
+
+    /// Runs the tasks in turn until they are done or `deadline` is reached,
+    /// then lets every task left finish, see `Task::finish`.
+    pub fn run(&mut self, chip: &mut Chip, deadline: Instant) -> Result<()> {
+        self.turns(chip, deadline)?;
+
+        for task in self.foreground.iter_mut().chain(self.background.iter_mut()) {
+            task.finish(chip)
+                .map_err(|err| anyhow!("{}: {}", task.name(), err))?;
+        }
+        Ok(())
+    }
+
+    /// Gives the tasks their time slices in turn until they are done or `deadline` is reached.
+    fn turns(&mut self, chip: &mut Chip, deadline: Instant) -> Result<()> {
+        while !self.foreground.is_empty() {
+            let mut idx = 0;
+            while idx < self.foreground.len() {
+                let now = Instant::now();
+                if now >= deadline {
+                    return Ok(());
+                }
+
+                let until = deadline.min(now + self.slice);
+                let task = &mut self.foreground[idx];
+                let poll = task
+                    .step(chip, until)
+                    .map_err(|err| anyhow!("{}: {}", task.name(), err))?;
+
+                match poll {
+                    Poll::Done => {
+                        task.finish(chip)
+                            .map_err(|err| anyhow!("{}: {}", task.name(), err))?;
+                        self.foreground.remove(idx);
+                    }
+                    Poll::Pending => idx += 1,
+                }
+            }
+
+            for task in self.background.iter_mut() {
+                let now = Instant::now();
+                if now >= deadline {
+                    return Ok(());
+                }
+
+                task.step(chip, deadline.min(now + self.slice))
+                    .map_err(|err| anyhow!("{}: {}", task.name(), err))?;
+            }
+        }
+
+        Ok(())
+    }
+}
+
+impl Flush {
+    /// Creates a task writing `filename` every `period` if the chip is better than ever,
+    /// starting from its current state.
+    pub fn new(chip: &Chip, filename: &str, period: Duration) -> Self {
+        Self {
+            filename: filename.to_string(),
+            period,
+            last: Instant::now(),
+            best: Best::new(chip),
+        }
+    }
+}
+
+impl Task for Flush {
+    fn name(&self) -> &str {
+        "flush"
+    }
+
+    fn step(&mut self, chip: &mut Chip, _until: Instant) -> Result<Poll> {
+        if self.last.elapsed() >= self.period {
+            if self.best.offer(chip) {
+                chip.write_file(&self.filename)?;
+            }
+            self.last = Instant::now();
+        }
+
+        Ok(Poll::Pending)
+    }
+
+    fn finish(&mut self, chip: &mut Chip) -> Result<()> {
+        if !self.best.offer(chip) {
+            self.best.revert(chip);
+        }
+        Ok(())
+    }
+}
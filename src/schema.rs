@@ -0,0 +1,64 @@
+use anyhow::{anyhow, Result};
+use serde::{de::DeserializeOwned, Serialize};
+use serde_json::Value;
+
+/// Turns a document of some version into a document of the next version.
+pub type Migration = fn(Value) -> Result<Value>;
+
+/// Name of the field holding the version of a document.
+const VERSION: &str = "version";
+
+/// Current version of documents migrated by `migrations`.
+/// Documents start at version 1, and every migration adds a version.
+pub fn current_version(migrations: &[Migration]) -> u64 {
+    migrations.len() as u64 + 1
+}
+
+/// Reads a versioned JSON document, migrating it from older versions first.
+/// `migrations[v - 1]` turns version `v` into version `v + 1`,
+/// and documents without a version, written before versioning, are version 1.
+pub fn read_versioned<T>(content: &str, migrations: &[Migration]) -> Result<T>
+where
+    T: DeserializeOwned,
+{
+    let mut value: Value = serde_json::from_str(content)?;
+    let current = current_version(migrations);
+
+    let mut version = match value.get(VERSION) {
+        Some(version) => version
+            .as_u64()
+            .ok_or_else(|| anyhow!("Version {} is not a number", version))?,
+        None => 1,
+    };
+    if version == 0 || version > current {
+        return Err(anyhow!(
+            "Version {} is not supported, the latest is {}",
+            version,
+            current
+        ));
+    }
+
+    while version < current {
+        value = migrations[version as usize - 1](value)
+            .map_err(|err| anyhow!("Migrating from version {}: {}", version, err))?;
+        version += 1;
+    }
+
+    if let Some(object) = value.as_object_mut() {
+        object.remove(VERSION);
+    }
+    Ok(serde_json::from_value(value)?)
+}
+
+/// Writes a JSON document, tagged with the current version.
+pub fn write_versioned<T>(document: &T, migrations: &[Migration]) -> Result<String>
+where
+    T: Serialize,
+{
+    let mut value = serde_json::to_value(document)?;
+    let object = value
+        .as_object_mut()
+        .ok_or_else(|| anyhow!("Only objects can be versioned"))?;
+    object.insert(VERSION.to_string(), current_version(migrations).into());
+    Ok(serde_json::to_string(&value)?)
+}
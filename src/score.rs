@@ -0,0 +1,221 @@
+use crate::{
+    chip::Chip,
+    components::{Cell, CellType, FactoryID, Net, Pair, Route},
+    flat::PointSet,
+    legality::route_violation,
+    utilities::{self, Stream},
+};
+use anyhow::{anyhow, Result};
+use std::{
+    collections::{HashMap, HashSet},
+    fmt::{Display, Formatter, Result as FmtResult},
+    fs::File,
+    io::BufReader,
+};
+
+/// Quality and legality of an output file.
+#[derive(Clone, Debug, Default, PartialEq)]
+pub struct Score {
+    /// weighted wirelength of all the nets
+    pub wirelength: f64,
+    /// number of cells away from their initial positions
+    pub moved: usize,
+    /// number of grids with more demand than supply
+    pub overflow: usize,
+    /// everything making the output illegal
+    pub violations: Vec<String>,
+}
+
+impl Score {
+    /// Whether the output is legal.
+    pub fn is_legal(&self) -> bool {
+        self.violations.is_empty()
+    }
+}
+
+impl Display for Score {
+    fn fmt(&self, f: &mut Formatter) -> FmtResult {
+        write!(
+            f,
+            "wirelength {:.2}, {} moved cells, {} overflowed grids, {}",
+            self.wirelength,
+            self.moved,
+            self.overflow,
+            if self.is_legal() { "legal" } else { "illegal" }
+        )?;
+        for violation in self.violations.iter() {
+            write!(f, "\n  {}", violation)?;
+        }
+        Ok(())
+    }
+}
+
+/// Scores an output file against the design in `chip`, checking its legality on the way.
+/// Nothing of `chip` is modified, and no routing structure is built:
+/// cells are moved in a copy of their positions and routes are only accumulated per net,
+/// so that many output files of a design can be scored quickly.
+/// Errors are only for files that cannot be parsed.
+pub fn score_file(chip: &Chip, filename: &str) -> Result<Score> {
+    use utilities::{check_eq, parse_numeric, parse_string};
+
+    let content = &mut Stream::new(BufReader::new(File::open(filename)?));
+    let mut score = Score::default();
+
+    let mut positions: Vec<_> = chip.cells.iter().map(|cell| cell.position).collect();
+    let mut seen = HashSet::new();
+
+    // NumMovedCellInst <movedCellInstCount>
+    let keyword: &str = &parse_string(content)?;
+    check_eq(keyword, "NumMovedCellInst")?;
+    let num_moved: usize = parse_numeric(content)?;
+
+    // CellInst <instName> <newRowIdx> <newColIdx>
+    for _ in 0..num_moved {
+        let keyword: &str = &parse_string(content)?;
+        check_eq(keyword, "CellInst")?;
+
+        let cell_name: &str = &parse_string(content)?;
+        let row: usize = parse_numeric(content)?;
+        let col: usize = parse_numeric(content)?;
+
+        let cell = Cell::from_str(cell_name)?;
+        if cell >= chip.cells.len() {
+            return Err(anyhow!("{} does not exist", cell_name));
+        }
+        let pos = Pair(row, col).internal()?;
+
+        if !seen.insert(cell) {
+            score
+                .violations
+                .push(format!("{} is moved twice", cell_name));
+        }
+        if pos.x() >= chip.dim.x() || pos.y() >= chip.dim.y() {
+            score
+                .violations
+                .push(format!("{} is moved out of bounds", cell_name));
+            continue;
+        }
+        if pos == chip.cells[cell].position {
+            continue;
+        }
+        if chip.cells[cell].movable == CellType::Fixed {
+            score.violations.push(format!("{} is fixed", cell_name));
+        }
+        if !chip.allowed(cell, pos) {
+            score
+                .violations
+                .push(format!("{} is moved out of its voltage area", cell_name));
+        }
+        positions[cell] = pos;
+    }
+
+    // NumRoutes <routeSegmentCount>
+    let keyword: &str = &parse_string(content)?;
+    check_eq(keyword, "NumRoutes")?;
+    let num_segments: usize = parse_numeric(content)?;
+
+    // <sRowIdx> <sColIdx> <sLayIdx> <eRowIdx> <eColIdx> <eLayIdx> <netName>
+    let mut routes: HashMap<usize, HashSet<Route<usize>>> = HashMap::new();
+    for _ in 0..num_segments {
+        let srow: usize = parse_numeric(content)?;
+        let scol: usize = parse_numeric(content)?;
+        let slay: usize = parse_numeric(content)?;
+        let erow: usize = parse_numeric(content)?;
+        let ecol: usize = parse_numeric(content)?;
+        let elay: usize = parse_numeric(content)?;
+        let net_name: &str = &parse_string(content)?;
+
+        let net = Net::from_str(net_name)?;
+        if net >= chip.nets.len() {
+            return Err(anyhow!("{} does not exist", net_name));
+        }
+        let route = Route::raw(srow, scol, slay, erow, ecol, elay).internal()?;
+
+        match route_violation(chip, net, &route) {
+            Some(violation) => score.violations.push(violation.to_string()),
+            None => {
+                routes.entry(net).or_insert_with(HashSet::new).insert(route);
+            }
+        }
+    }
+
+    check_eq(content.next().as_deref(), None)?;
+    if let Some(err) = content.take_error() {
+        return Err(err.into());
+    }
+
+    score.moved = chip
+        .cells
+        .iter()
+        .zip(positions.iter())
+        .filter(|(cell, &pos)| cell.position != pos)
+        .count();
+    if score.moved > chip.max_move {
+        score.violations.push(format!(
+            "{} cells are moved, at most {} may be",
+            score.moved, chip.max_move
+        ));
+    }
+
+    let mut demand = chip.cell_demand(&positions);
+    let empty = HashSet::new();
+    for (id, net) in chip.nets.iter().enumerate() {
+        let segments = routes.get(&id).unwrap_or(&empty);
+
+        let pins: Vec<_> = net
+            .pins
+            .iter()
+            .map(|&(cell, pin)| {
+                let layer = chip.mastercells[chip.cells[cell].mastercell]
+                    .get_pin(pin)
+                    .expect("Pin not found")
+                    .layer;
+                positions[cell].with(layer)
+            })
+            .collect();
+        if !utilities::connected(&pins, segments) {
+            score
+                .violations
+                .push(format!("{} is not connected", Net::from_num(id)?));
+        }
+
+        let consumed: PointSet = segments
+            .iter()
+            .flat_map(|&route| chip.via_model.points(route))
+            .collect();
+        for point in consumed.iter() {
+            demand[chip.grid_index(point)] += 1;
+        }
+
+        let length = segments
+            .iter()
+            .flat_map(Route::points)
+            .collect::<HashSet<_>>()
+            .len();
+        if chip.criticality.over_length(id, length) {
+            score.violations.push(format!(
+                "{} is {} long, at most {} may be",
+                Net::from_num(id)?,
+                length,
+                chip.criticality
+                    .max_length(id)
+                    .expect("Max length not found")
+            ));
+        }
+        score.wirelength += chip.weighted_length(id, segments);
+    }
+
+    let supply = chip.layers.iter().flat_map(|layer| layer.capacity.iter());
+    score.overflow = demand
+        .iter()
+        .zip(supply)
+        .filter(|(&demand, &supply)| demand > supply)
+        .count();
+    if score.overflow > 0 {
+        score
+            .violations
+            .push(format!("{} grids are overflowed", score.overflow));
+    }
+
+    Ok(score)
+}
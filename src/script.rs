@@ -0,0 +1,165 @@
+use crate::{
+    chip::Chip,
+    components::{Cell, FactoryID, Net, Pair, Point},
+    consts::SLICE_MILLIS,
+    deferred::Escalation,
+    explain::{explain, query},
+    optimizer::{reroute, Optimizer, Outcome},
+    scheduler::{Poll, Task},
+    solution::Solution,
+    utilities,
+    watchdog::Progress,
+};
+use anyhow::{anyhow, Result};
+use std::{
+    fs,
+    sync::Arc,
+    time::{Duration, Instant},
+};
+
+/// A command of a script.
+#[derive(Clone, Debug, Eq, Hash, PartialEq)]
+pub enum Command {
+    /// `load <file>` reads an input file, replacing the current chip
+    Load(String),
+    /// `move <cell> <row> <col>` moves a cell
+    Move(usize, Pair<usize>),
+    /// `score` prints the wirelength and the moved cells
+    Score,
+    /// `audit` checks the demand
+    Audit,
+    /// `write <file>` writes an output file
+    Write(String),
+    /// `explain <net>` describes a net
+    Explain(usize),
+    /// `apply <file>` applies an output file or a snapshot
+    Apply(String),
+    /// `query <row> <col> <lay>` describes a grid
+    Query(Point<usize>),
+    /// `route` reroutes nets until no pass improves any, see `Optimizer`
+    Route,
+    /// `reroute <net>` rips up a net and routes it again, see `reroute`
+    Reroute(usize),
+}
+
+impl Command {
+    /// Parses a command, which is a line or a part of a line between `;`.
+    pub fn parse(line: &str) -> Result<Option<Self>> {
+        use utilities::{check_eq, parse_numeric, parse_string};
+
+        let words = &mut line.split_whitespace();
+        let keyword = match words.next() {
+            Some(keyword) => keyword,
+            None => return Ok(None),
+        };
+
+        let command = match keyword {
+            "load" => Self::Load(parse_string(words)?.to_string()),
+            "move" => {
+                let cell = Cell::from_str(parse_string(words)?)?;
+                let row: usize = parse_numeric(words)?;
+                let col: usize = parse_numeric(words)?;
+                Self::Move(cell, Pair(row, col).internal()?)
+            }
+            "score" => Self::Score,
+            "audit" => Self::Audit,
+            "write" => Self::Write(parse_string(words)?.to_string()),
+            "explain" => Self::Explain(Net::from_str(parse_string(words)?)?),
+            "apply" => Self::Apply(parse_string(words)?.to_string()),
+            "query" => {
+                let row: usize = parse_numeric(words)?;
+                let col: usize = parse_numeric(words)?;
+                let lay: usize = parse_numeric(words)?;
+                Self::Query(Point(row, col, lay).internal()?)
+            }
+            "route" => Self::Route,
+            "reroute" => Self::Reroute(Net::from_str(parse_string(words)?)?),
+            _ => return Err(anyhow!("Unknown command {}", keyword)),
+        };
+
+        check_eq(words.next(), None)?;
+        Ok(Some(command))
+    }
+
+    /// Executes the command on a chip.
+    pub fn execute(&self, chip: &mut Chip) -> Result<()> {
+        match self {
+            Self::Load(filename) => {
+                chip.release();
+                eprint!("{}", chip.read_file(filename)?);
+            }
+            Self::Move(cell, to) => {
+                chip.check_move(*cell, *to)?;
+                chip.move_cell(*cell, *to);
+            }
+            Self::Score => println!(
+                "Wirelength {} ({:.2}% better than {}) with {} of {} cells moved",
+                chip.wirelength(),
+                chip.improvement(),
+                chip.baseline,
+                chip.already_moved,
+                chip.max_move
+            ),
+            Self::Audit => chip.audit_demand()?,
+            Self::Write(filename) => chip.write_file(filename)?,
+            Self::Explain(net) => {
+                if *net >= chip.nets.len() {
+                    return Err(anyhow!("Net {} not found", Net::from_num(*net)?));
+                }
+                print!("{}", explain(chip, *net)?);
+            }
+            Self::Apply(filename) => chip.apply(&Solution::read_for(chip, filename)?)?,
+            Self::Query(point) => {
+                chip.check_bounds(*point)?;
+                print!("{}", query(chip, *point)?);
+            }
+            Self::Route => {
+                let mut optimizer = Optimizer::new(false, true, Arc::new(Progress::new()));
+                let slice = Duration::from_millis(SLICE_MILLIS);
+                while optimizer.step(chip, Instant::now() + slice)? == Poll::Pending {}
+                optimizer.finish(chip)?;
+            }
+            Self::Reroute(net) => {
+                let name = Net::from_num(*net)?;
+                if *net >= chip.nets.len() {
+                    return Err(anyhow!("Net {} not found", name));
+                }
+                match reroute(chip, *net, Escalation::after(0), None) {
+                    Outcome::Failed => println!("{} cannot be routed, its routes are kept", name),
+                    Outcome::Kept => println!("{} keeps its routes, no shorter ones found", name),
+                    Outcome::Rerouted => println!("{} is rerouted", name),
+                }
+            }
+        }
+
+        Ok(())
+    }
+}
+
+/// Runs a script, one command per line or between `;`, lines starting with `#` being comments.
+pub fn run_script(content: &str, chip: &mut Chip) -> Result<()> {
+    let lines = content
+        .lines()
+        .enumerate()
+        .filter(|(_, line)| !line.trim_start().starts_with('#'));
+
+    for (idx, line) in lines {
+        for part in line.split(';') {
+            let command =
+                Command::parse(part).map_err(|err| anyhow!("Line {}: {}", idx + 1, err))?;
+            if let Some(command) = command {
+                command
+                    .execute(chip)
+                    .map_err(|err| anyhow!("Line {}: {}", idx + 1, err))?;
+            }
+        }
+    }
+
+    Ok(())
+}
+
+/// Runs a script file.
+pub fn run_script_file(filename: &str, chip: &mut Chip) -> Result<()> {
+    let content: String = fs::read_to_string(filename)?;
+    run_script(&content, chip)
+}
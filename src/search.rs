@@ -0,0 +1,286 @@
+use crate::{
+    chip::Chip,
+    components::{Direction, Pair, Point, Route, WrongWay},
+    consts::{CORRIDOR_COST, GRID_COST},
+    deferred::Escalation,
+    flat::PointSet,
+    layers::LayerTable,
+    watchdog::Progress,
+    weights::Weights,
+};
+use std::cmp;
+
+/// The moves path search makes from grid to grid for a net, with their costs:
+/// along the direction of a layer at or above the min layer of the net, and up or down a via.
+/// Moves against the direction of a layer are made only if `WrongWay` lets them, at its cost.
+/// A move costs the weight of the layer of the grid it goes to, inflated if the grid is predicted
+/// congested, plus the weight of a via for vias, in units of `GRID_COST` per grid weighing 1,
+/// so that paths found are short in weighted length and avoid congestion.
+/// Grids of congested corridors cost `CORRIDOR_COST` more if given, see `around`.
+#[derive(Clone, Copy, Debug)]
+pub struct Moves<'a> {
+    /// layers with their directions
+    layers: LayerTable<'a>,
+    /// dimensions
+    dim: Pair<usize>,
+    /// min layer of the net
+    min_layer: usize,
+    /// how moves against the direction of a layer are treated
+    wrong_way: WrongWay,
+    /// weights of the layers and of vias
+    weights: &'a Weights,
+    /// cost multiplier of every grid, see `Chip::inflate`, empty if not predicted
+    inflation: &'a [f64],
+    /// whether every 2D grid is in a congested corridor, see `Chip::congested_grids`, empty if none
+    corridors: &'a [bool],
+}
+
+impl<'a> Moves<'a> {
+    /// Moves on the layers of a grid of `dim` for a net of `min_layer`.
+    pub fn new(
+        layers: LayerTable<'a>,
+        dim: Pair<usize>,
+        min_layer: usize,
+        wrong_way: WrongWay,
+        weights: &'a Weights,
+        inflation: &'a [f64],
+    ) -> Self {
+        Self {
+            layers,
+            dim,
+            min_layer,
+            wrong_way,
+            weights,
+            inflation,
+            corridors: &[],
+        }
+    }
+
+    /// The same moves, costing more through the grids of congested corridors.
+    pub fn around(self, corridors: &'a [bool]) -> Self {
+        Self { corridors, ..self }
+    }
+
+    /// Converts a weight to a cost, see `GRID_COST`.
+    fn cost(weight: f64) -> usize {
+        (weight.max(0.) * GRID_COST as f64).round() as usize
+    }
+
+    /// Cost of going to a grid, by a via if `via`.
+    fn enter(&self, point: Point<usize>, via: bool) -> usize {
+        let Point(row, col, lay) = point;
+        let grid = row * self.dim.y() + col;
+        let inflation = self.inflation.get(lay * self.dim.size() + grid);
+        let via = if via { self.weights.via } else { 0. };
+        let cost = Self::cost(self.weights.layer(lay) * inflation.copied().unwrap_or(1.) + via);
+
+        match self.corridors.get(grid) {
+            Some(true) => cost + CORRIDOR_COST * GRID_COST,
+            _ => cost,
+        }
+    }
+
+    /// The least a move can cost, which no move goes below as inflation is never below 1.
+    pub fn min_step(&self) -> usize {
+        (0..self.layers.len())
+            .map(|lay| Self::cost(self.weights.layer(lay)))
+            .min()
+            .unwrap_or(0)
+    }
+
+    /// Extra cost of a move along a layer, `None` if it is not made.
+    fn along(&self, lay: usize, direction: Direction) -> Option<usize> {
+        if lay < self.min_layer {
+            return None;
+        }
+        let preferred = self.layers.direction(lay).ok()?;
+        match self.wrong_way {
+            _ if preferred == direction => Some(0),
+            WrongWay::Refused => None,
+            WrongWay::Penalized(penalty) => Some(penalty * GRID_COST),
+        }
+    }
+
+    /// Grids a wire can go to from `point`, with the cost of going there.
+    pub fn from(&self, point: Point<usize>) -> Vec<(Point<usize>, usize)> {
+        let Point(row, col, lay) = point;
+        let mut next = Vec::with_capacity(6);
+
+        let wire = |grid: Pair<usize>, extra: usize| {
+            let point = grid.with(lay);
+            (point, self.enter(point, false) + extra)
+        };
+        if let Some(extra) = self.along(lay, Direction::Horizontal) {
+            let grids = Pair(row, col).horizontal_neighbors(self.dim);
+            next.extend(grids.into_iter().map(|grid| wire(grid, extra)));
+        }
+        if let Some(extra) = self.along(lay, Direction::Vertical) {
+            let grids = Pair(row, col).vertical_neighbors(self.dim);
+            next.extend(grids.into_iter().map(|grid| wire(grid, extra)));
+        }
+
+        let via = |lay: usize| {
+            let point = Point(row, col, lay);
+            (point, self.enter(point, true))
+        };
+        if lay > 0 {
+            next.push(via(lay - 1));
+        }
+        if lay + 1 < self.layers.len() {
+            next.push(via(lay + 1));
+        }
+
+        next
+    }
+}
+
+/// The routes of a path of grids, each going to a neighbor of the one before,
+/// with the grids in a row along the same axis as one route.
+/// A path of a single grid needs no route.
+pub fn path_routes(path: &[Point<usize>]) -> Vec<Route<usize>> {
+    let mut routes = Vec::new();
+    let mut start = match path.first() {
+        Some(&start) => start,
+        None => return routes,
+    };
+
+    for pair in path.windows(2) {
+        let (prev, next) = (pair[0], pair[1]);
+        if start != prev && Route(start, prev).towards() != Route(prev, next).towards() {
+            routes.push(Route(start, prev));
+            start = prev;
+        }
+    }
+    if let Some(&end) = path.last() {
+        if end != start {
+            routes.push(Route(start, end));
+        }
+    }
+    routes
+}
+
+/// A path search for a net: the moves it makes, the grids it may go through,
+/// which may be fewer or more if escalated, see `escalated`,
+/// and the progress it reports to the watchdog if watched, see `watched`.
+#[derive(Debug)]
+pub struct Search<'a> {
+    /// chip searched
+    chip: &'a Chip,
+    /// net searched for
+    net: usize,
+    /// moves made
+    moves: Moves<'a>,
+    /// grids the net goes through, which need no free capacity
+    used: PointSet,
+    /// 2D box paths stay in, as its lowest and highest corners, anywhere if `None`
+    area: Option<(Pair<usize>, Pair<usize>)>,
+    /// overflow allowed on every grid
+    tolerance: usize,
+    /// progress reported, if watched
+    progress: Option<&'a Progress>,
+}
+
+impl<'a> Search<'a> {
+    /// A search for a net, going through the grids of its routes and the grids with free capacity.
+    pub fn new(chip: &'a Chip, net: usize) -> Self {
+        let used = chip.nets[net]
+            .segments()
+            .iter()
+            .flat_map(Route::points)
+            .collect();
+
+        Self {
+            chip,
+            net,
+            moves: chip.moves(net),
+            used,
+            area: None,
+            tolerance: 0,
+            progress: None,
+        }
+    }
+
+    /// Tries as hard as `escalation` says: paths stay in the bounding box of the net
+    /// expanded by its margin, see `Chip::bounding_box`, and grids may overflow by its tolerance.
+    pub fn escalated(mut self, escalation: Escalation) -> Self {
+        let (lo, hi) = self.chip.bounding_box(self.net);
+        let Pair(rows, cols) = self.chip.dim;
+        let margin = escalation.margin;
+        self.area = Some((
+            Pair(lo.x().saturating_sub(margin), lo.y().saturating_sub(margin)),
+            Pair(
+                cmp::min(hi.x().saturating_add(margin), rows.saturating_sub(1)),
+                cmp::min(hi.y().saturating_add(margin), cols.saturating_sub(1)),
+            ),
+        ));
+        self.tolerance = escalation.tolerance;
+        self
+    }
+
+    /// Makes paths avoid congested corridors, see `Moves::around`,
+    /// so that the nets of a bundle rerouted one after another spread out, see `Chip::congested_bundles`.
+    pub fn around(mut self, corridors: &'a [bool]) -> Self {
+        self.moves = self.moves.around(corridors);
+        self
+    }
+
+    /// Reports the progress of the search, which starts on the net and finishes once dropped,
+    /// so that the watchdog can abort it.
+    pub fn watched(mut self, progress: &'a Progress) -> Self {
+        progress.start(self.net);
+        self.progress = Some(progress);
+        self
+    }
+
+    /// The chip searched.
+    pub fn chip(&self) -> &'a Chip {
+        self.chip
+    }
+
+    /// The net searched for.
+    pub fn net(&self) -> usize {
+        self.net
+    }
+
+    /// The moves made.
+    pub fn moves(&self) -> &Moves<'a> {
+        &self.moves
+    }
+
+    /// Lets paths go through the grids of routes found for the net.
+    pub fn extend(&mut self, routes: &[Route<usize>]) {
+        self.used.extend(routes.iter().flat_map(Route::points));
+    }
+
+    /// Whether a path may go through a grid, which must be in the area of the search
+    /// and needs free capacity, give or take the tolerance, unless the net already goes through it.
+    pub fn room(&self, point: Point<usize>) -> bool {
+        if let Some((lo, hi)) = self.area {
+            let (row, col) = (point.row(), point.col());
+            if row < lo.x() || row > hi.x() || col < lo.y() || col > hi.y() {
+                return false;
+            }
+        }
+
+        let chip = self.chip;
+        let idx = chip.grid_index(point);
+        let supply = chip.layers[point.lay()].capacity[idx % chip.dim.size()];
+        chip.demand[idx] < supply + self.tolerance || self.used.contains(point)
+    }
+
+    /// Records a frontier pop, leaving `frontier` grids in the frontier,
+    /// of a grid whose whole path is estimated to cost `best`.
+    /// Returns false if the search has been aborted by the watchdog.
+    pub fn pop(&self, frontier: usize, best: usize) -> bool {
+        self.progress
+            .map_or(true, |progress| progress.pop(frontier, best))
+    }
+}
+
+impl Drop for Search<'_> {
+    fn drop(&mut self) {
+        if let Some(progress) = self.progress {
+            progress.finish();
+        }
+    }
+}
@@ -0,0 +1,169 @@
+use crate::components::{Layer, Route};
+use anyhow::{anyhow, Result};
+use std::collections::HashSet;
+
+/// Keywords starting the sections of an input after its head, in order.
+const KEYWORDS: [&str; 4] = ["NumMasterCell", "NumCellInst", "NumNets", "NumRoutes"];
+
+/// Keyword starting the optional section of voltage areas.
+const AREAS: &str = "NumVoltageAreas";
+
+/// Where the sections of an input start, so that they can be parsed independently:
+/// the head (layers and supplies), the mastercells (and extra demand rules), the cells,
+/// the nets, the routes, and the rest (voltage areas, if any).
+/// Every section is given by its byte offset and its line (starting from 1).
+#[derive(Clone, Copy, Debug, Default, Eq, PartialEq)]
+pub struct Sections {
+    /// start of the mastercells
+    pub mastercells: (usize, usize),
+    /// start of the cells
+    pub cells: (usize, usize),
+    /// start of the nets
+    pub nets: (usize, usize),
+    /// start of the routes
+    pub routes: (usize, usize),
+    /// start of the rest
+    pub rest: (usize, usize),
+}
+
+impl Sections {
+    /// Finds the sections of an input, by the keyword starting a line.
+    /// Returns `None` if some section cannot be found that way.
+    pub fn index(content: &str) -> Option<Self> {
+        let mut starts = Vec::with_capacity(KEYWORDS.len());
+        let mut rest = None;
+        let (mut offset, mut line) = (0, 1);
+
+        for text in content.split('\n') {
+            let keyword = text.split_whitespace().next();
+            match keyword {
+                Some(keyword) if starts.len() < KEYWORDS.len() => {
+                    if keyword == KEYWORDS[starts.len()] {
+                        starts.push((offset, line));
+                    }
+                }
+                Some(AREAS) => {
+                    rest = Some((offset, line));
+                    break;
+                }
+                _ => {}
+            }
+            offset += text.len() + 1;
+            line += 1;
+        }
+
+        if starts.len() < KEYWORDS.len() {
+            return None;
+        }
+        Some(Self {
+            mastercells: starts[0],
+            cells: starts[1],
+            nets: starts[2],
+            routes: starts[3],
+            rest: rest.unwrap_or((content.len(), line)),
+        })
+    }
+
+    /// The head, mastercells, cells, nets, routes and rest of an input, each with its first line.
+    pub fn split<'a>(&self, content: &'a str) -> [(&'a str, usize); 6] {
+        [
+            (&content[..self.mastercells.0], 1),
+            (
+                &content[self.mastercells.0..self.cells.0],
+                self.mastercells.1,
+            ),
+            (&content[self.cells.0..self.nets.0], self.cells.1),
+            (&content[self.nets.0..self.routes.0], self.nets.1),
+            (&content[self.routes.0..self.rest.0], self.routes.1),
+            (&content[self.rest.0..], self.rest.1),
+        ]
+    }
+}
+
+/// Which sections of an input to read, the others being skipped.
+#[derive(Clone, Copy, Debug, Eq, PartialEq)]
+pub struct Selection {
+    /// mastercells and extra demand rules
+    pub mastercells: bool,
+    /// cells, which need the mastercells
+    pub cells: bool,
+    /// nets
+    pub nets: bool,
+    /// routes, which need the nets
+    pub routes: bool,
+    /// voltage areas, which need the cells
+    pub areas: bool,
+}
+
+impl Selection {
+    /// Checks that every section selected comes with the sections it needs.
+    pub fn check(&self) -> Result<()> {
+        if self.cells && !self.mastercells {
+            return Err(anyhow!("Cells cannot be read without mastercells"));
+        }
+        if self.routes && !self.nets {
+            return Err(anyhow!("Routes cannot be read without nets"));
+        }
+        if self.areas && !self.cells {
+            return Err(anyhow!("Voltage areas cannot be read without cells"));
+        }
+        Ok(())
+    }
+}
+
+impl Default for Selection {
+    /// Every section.
+    fn default() -> Self {
+        Self {
+            mastercells: true,
+            cells: true,
+            nets: true,
+            routes: true,
+            areas: true,
+        }
+    }
+}
+
+/// Nets of an input, without their routes.
+#[derive(Clone, Debug, Default)]
+pub struct NetsSection {
+    /// min routing layer of every net
+    pub layers: Vec<usize>,
+    /// pins of every net as (cell, pin)
+    pub pins: Vec<Vec<(usize, usize)>>,
+    /// number of pins ignored as listed twice
+    pub duplicates: usize,
+}
+
+/// Routes of an input, by net.
+#[derive(Clone, Debug, Default)]
+pub struct RoutesSection {
+    /// route segments of every net
+    pub routes: Vec<HashSet<Route<usize>>>,
+    /// number of segments ignored as listed twice
+    pub duplicates: usize,
+    /// number of diagonal segments split
+    pub diagonals: usize,
+}
+
+impl RoutesSection {
+    /// An empty section for `net_count` nets.
+    pub fn new(net_count: usize) -> Self {
+        Self {
+            routes: vec![HashSet::new(); net_count],
+            ..Self::default()
+        }
+    }
+
+    /// Adds a route of a net, which must exist, splitting it onto `layers` if diagonal.
+    /// `Route(a, b)` and `Route(b, a)` are the same route, counted as duplicates.
+    pub fn insert(&mut self, net: usize, route: Route<usize>, layers: &[Layer]) {
+        let net_routes = &mut self.routes[net];
+        if route.validate().is_err() {
+            self.diagonals += 1;
+            net_routes.extend(route.split(layers).iter().map(Route::normalized));
+        } else if !net_routes.insert(route.normalized()) {
+            self.duplicates += 1;
+        }
+    }
+}
@@ -0,0 +1,157 @@
+use crate::{
+    chip::Chip,
+    components::{Cell, FactoryID, Net, Pair, Route},
+    utilities::{self, Stream, Tokenizer, Tokens},
+};
+use anyhow::{anyhow, Result};
+use std::{
+    collections::{HashMap, HashSet},
+    fs::File,
+    io::BufReader,
+    ops::Deref,
+};
+
+/// The content of an output file.
+#[derive(Clone, Debug, Default, Eq, PartialEq)]
+pub struct Solution {
+    /// moved cells and their new positions
+    pub cells: HashMap<usize, Pair<usize>>,
+    /// route segments of every net
+    pub routes: HashMap<usize, HashSet<Route<usize>>>,
+}
+
+impl Solution {
+    /// Reads the content of an output file.
+    pub fn read_file(filename: &str) -> Result<Self> {
+        let stream = &mut Stream::new(BufReader::new(File::open(filename)?));
+        let solution = Self::read_tokens(stream);
+
+        match stream.take_error() {
+            Some(err) => Err(err.into()),
+            None => solution,
+        }
+    }
+
+    /// Reads the content of an output string.
+    pub fn read_str(content: &str) -> Result<Self> {
+        Self::read_tokens(&mut Tokens::new(content))
+    }
+
+    /// Reads the content of an output file of the input in `chip`,
+    /// checking that it only refers to what is in the input.
+    pub fn read_for(chip: &Chip, filename: &str) -> Result<Self> {
+        let solution = Self::read_file(filename)?;
+        solution
+            .check(chip)
+            .map_err(|err| anyhow!("In {}: {}", filename, err))?;
+        Ok(solution)
+    }
+
+    /// Checks that cells and nets exist in the input in `chip`,
+    /// that cells are moved and routes go inside its grids,
+    /// and that only movable cells are moved, inside their voltage areas, see `Chip::check_move`.
+    pub fn check(&self, chip: &Chip) -> Result<()> {
+        let Pair(rows, cols) = chip.dim;
+        let inside = |Pair(row, col): Pair<usize>| row < rows && col < cols;
+
+        for (&cell, &position) in self.cells.iter() {
+            if cell >= chip.cells.len() {
+                return Err(anyhow!("{} does not exist", Cell::from_num(cell)?));
+            }
+            if !inside(position) {
+                return Err(anyhow!(
+                    "{} is moved out of bounds to ({})",
+                    Cell::from_num(cell)?,
+                    position.external()
+                ));
+            }
+            if position != chip.cells[cell].position {
+                chip.check_move(cell, position)?;
+            }
+        }
+
+        for (&net, routes) in self.routes.iter() {
+            if net >= chip.nets.len() {
+                return Err(anyhow!("{} does not exist", Net::from_num(net)?));
+            }
+            for route in routes.iter() {
+                route.validate()?;
+
+                let Route(source, target) = *route;
+                if !inside(source.flatten())
+                    || !inside(target.flatten())
+                    || source.lay() >= chip.layers.len()
+                    || target.lay() >= chip.layers.len()
+                {
+                    return Err(anyhow!("Route {} is out of bounds", route.external()));
+                }
+            }
+        }
+
+        Ok(())
+    }
+
+    /// Reads output tokens, with the line of the first error.
+    fn read_tokens<T, S>(tokens: &mut T) -> Result<Self>
+    where
+        T: Tokenizer<Item = S>,
+        S: Deref<Target = str>,
+    {
+        Self::parse_tokens(tokens).map_err(|err| anyhow!("Near line {}: {}", tokens.line(), err))
+    }
+
+    /// Parses output tokens.
+    fn parse_tokens<T, S>(content: &mut T) -> Result<Self>
+    where
+        T: Iterator<Item = S>,
+        S: Deref<Target = str>,
+    {
+        use utilities::{check_eq, parse_numeric, parse_string};
+
+        let mut solution = Self::default();
+
+        // NumMovedCellInst <movedCellInstCount>
+        let keyword: &str = &parse_string(content)?;
+        check_eq(keyword, "NumMovedCellInst")?;
+        let num_moved: usize = parse_numeric(content)?;
+
+        // CellInst <instName> <newRowIdx> <newColIdx>
+        for _ in 0..num_moved {
+            let keyword: &str = &parse_string(content)?;
+            check_eq(keyword, "CellInst")?;
+
+            let cell_name: &str = &parse_string(content)?;
+            let row: usize = parse_numeric(content)?;
+            let col: usize = parse_numeric(content)?;
+
+            solution
+                .cells
+                .insert(Cell::from_str(cell_name)?, Pair(row, col).internal()?);
+        }
+
+        // NumRoutes <routeSegmentCount>
+        let keyword: &str = &parse_string(content)?;
+        check_eq(keyword, "NumRoutes")?;
+        let num_segments: usize = parse_numeric(content)?;
+
+        // <sRowIdx> <sColIdx> <sLayIdx> <eRowIdx> <eColIdx> <eLayIdx> <netName>
+        for _ in 0..num_segments {
+            let srow: usize = parse_numeric(content)?;
+            let scol: usize = parse_numeric(content)?;
+            let slay: usize = parse_numeric(content)?;
+            let erow: usize = parse_numeric(content)?;
+            let ecol: usize = parse_numeric(content)?;
+            let elay: usize = parse_numeric(content)?;
+            let net_name: &str = &parse_string(content)?;
+
+            solution
+                .routes
+                .entry(Net::from_str(net_name)?)
+                .or_insert_with(HashSet::new)
+                .insert(Route::raw(srow, scol, slay, erow, ecol, elay).internal()?);
+        }
+
+        check_eq(content.next().as_deref(), None)?;
+        Ok(solution)
+    }
+}
@@ -0,0 +1,386 @@
+use crate::{
+    chip::Chip,
+    components::{CellType, Pair, Point, Provenance, Route},
+    schema::{read_versioned, write_versioned, Migration},
+};
+use anyhow::{anyhow, Result};
+use serde::{Deserialize, Serialize};
+use serde_json::Value;
+use std::{
+    collections::{HashMap, HashSet},
+    fs, mem,
+};
+
+/// The sub-problem of a rectangle of the grid, solved on its own, possibly on another machine.
+/// Indices are the internal ones (starting from 0).
+/// The worker is expected to read the same input file, a tile only says what it may change.
+#[derive(Clone, Debug, Default, Deserialize, Eq, PartialEq, Serialize)]
+pub struct Tile {
+    /// index of the tile, row by row
+    pub id: usize,
+    /// lowest row and column in the tile
+    pub lo: (usize, usize),
+    /// highest row and column in the tile
+    pub hi: (usize, usize),
+    /// cells in the tile, with their positions and whether the tile may move them
+    pub cells: Vec<(usize, (usize, usize), bool)>,
+    /// nets fully inside the tile, with their routes
+    pub nets: Vec<(usize, Vec<[usize; 6]>)>,
+    /// nets crossing the tile boundary
+    pub boundary: Vec<BoundaryNet>,
+}
+
+/// The part of a net crossing tile boundaries that lies in a tile.
+/// Crossing points on tile edges are fixed, so every tile routes its part independently.
+#[derive(Clone, Debug, Default, Deserialize, Eq, PartialEq, Serialize)]
+pub struct BoundaryNet {
+    /// id of the net
+    pub id: usize,
+    /// grids the part must connect: pins in the tile and crossing points on its edges
+    pub terminals: Vec<(usize, usize, usize)>,
+    /// current routes of the part, clipped to the tile
+    pub routes: Vec<[usize; 6]>,
+    /// unit segments going out of the tile, kept as they are
+    pub crossings: Vec<[usize; 6]>,
+}
+
+/// The solution of a tile.
+#[derive(Clone, Debug, Default, Deserialize, Eq, PartialEq, Serialize)]
+pub struct TileSolution {
+    /// index of the tile
+    pub id: usize,
+    /// moved cells and their new positions
+    pub cells: Vec<(usize, (usize, usize))>,
+    /// new routes of the nets
+    pub routes: Vec<(usize, Vec<[usize; 6]>)>,
+}
+
+/// Migrations of tile files, see `schema`.
+const TILE_MIGRATIONS: [Migration; 1] = [boundary_parts];
+
+/// Migrations of tile solution files, see `schema`.
+const SOLUTION_MIGRATIONS: [Migration; 0] = [];
+
+/// Version 1 stored boundary nets as their grids in the tile, which had to stay used.
+/// Version 2 stores them as parts, whose terminals here are those grids, kept as zero-length routes.
+fn boundary_parts(mut value: Value) -> Result<Value> {
+    let boundary = value
+        .get_mut("boundary")
+        .and_then(Value::as_array_mut)
+        .ok_or_else(|| anyhow!("Boundary nets not found"))?;
+
+    for net in boundary.iter_mut() {
+        let (id, grids): (usize, Vec<(usize, usize, usize)>) = serde_json::from_value(net.take())?;
+        *net = serde_json::to_value(BoundaryNet {
+            id,
+            terminals: grids.clone(),
+            routes: grids
+                .iter()
+                .map(|&(row, col, lay)| [row, col, lay, row, col, lay])
+                .collect(),
+            crossings: Vec::new(),
+        })?;
+    }
+
+    Ok(value)
+}
+
+/// Converts a route to plain numbers.
+fn to_raw(route: &Route<usize>) -> [usize; 6] {
+    let Route(Point(srow, scol, slay), Point(erow, ecol, elay)) = *route;
+    [srow, scol, slay, erow, ecol, elay]
+}
+
+/// Converts plain numbers to a route.
+fn from_raw(raw: &[usize; 6]) -> Route<usize> {
+    let [srow, scol, slay, erow, ecol, elay] = *raw;
+    Route::raw(srow, scol, slay, erow, ecol, elay)
+}
+
+/// Whether a tile owns a net.
+fn tile_owns(tile: &Tile, net: usize) -> bool {
+    tile.nets.iter().any(|&(id, _)| id == net)
+}
+
+impl Tile {
+    /// Whether a position is in the tile.
+    pub fn contains(&self, Pair(row, col): Pair<usize>) -> bool {
+        let ((rlo, clo), (rhi, chi)) = (self.lo, self.hi);
+        (rlo..=rhi).contains(&row) && (clo..=chi).contains(&col)
+    }
+
+    /// Reads a tile from a JSON file, migrating it if written by an older version.
+    pub fn read_file(filename: &str) -> Result<Self> {
+        let content: String = fs::read_to_string(filename)?;
+        read_versioned(&content, &TILE_MIGRATIONS)
+    }
+
+    /// Writes a tile to a JSON file.
+    pub fn write_file(&self, filename: &str) -> Result<()> {
+        fs::write(filename, write_versioned(self, &TILE_MIGRATIONS)?)?;
+        Ok(())
+    }
+}
+
+impl TileSolution {
+    /// Reads a tile solution from a JSON file, migrating it if written by an older version.
+    pub fn read_file(filename: &str) -> Result<Self> {
+        let content: String = fs::read_to_string(filename)?;
+        read_versioned(&content, &SOLUTION_MIGRATIONS)
+    }
+
+    /// Writes a tile solution to a JSON file.
+    pub fn write_file(&self, filename: &str) -> Result<()> {
+        fs::write(filename, write_versioned(self, &SOLUTION_MIGRATIONS)?)?;
+        Ok(())
+    }
+}
+
+/// Clips a route to the grids in a tile.
+/// Returns `None` if nothing of the route but a crossing point is left.
+fn clip(route: &Route<usize>, tile: &Tile) -> Option<Route<usize>> {
+    // the grids of a straight route in a rectangle are contiguous
+    let mut inside = route
+        .points()
+        .filter(|point| tile.contains(point.flatten()));
+    let first = inside.next()?;
+    let last = inside.last().unwrap_or(first);
+
+    // a single grid of a longer route is already covered by its crossing
+    if first == last && !route.is_point() {
+        None
+    } else {
+        Some(Route(first, last))
+    }
+}
+
+/// The part of a net crossing tile boundaries that lies in a tile, if any.
+/// The routes the net currently has serve as the coarse global pass:
+/// wherever they cross an edge of the tile, the crossing is fixed.
+fn boundary_net(
+    chip: &Chip,
+    net: usize,
+    tile: &Tile,
+    tile_of: &dyn Fn(Pair<usize>) -> usize,
+) -> Option<BoundaryNet> {
+    let routes = chip.nets[net].segments();
+
+    let clipped: Vec<_> = routes
+        .iter()
+        .filter_map(|route| clip(route, tile))
+        .collect();
+    if clipped.is_empty() {
+        return None;
+    }
+
+    let mut crossings = HashSet::new();
+    for route in routes.iter() {
+        let points: Vec<_> = route.points().collect();
+        for pair in points.windows(2) {
+            let (from, to) = (pair[0].flatten(), pair[1].flatten());
+            if tile_of(from) == tile_of(to) {
+                continue;
+            }
+            if tile.contains(from) || tile.contains(to) {
+                crossings.insert(Route(pair[0], pair[1]));
+            }
+        }
+    }
+
+    let pins = chip
+        .pins_of_net(net)
+        .iter()
+        .map(|pin| pin.position)
+        .filter(|position| tile.contains(position.flatten()));
+    let ends = crossings
+        .iter()
+        .flat_map(|route| vec![route.source(), route.target()])
+        .filter(|point| tile.contains(point.flatten()));
+    let terminals: HashSet<_> = pins.chain(ends).collect();
+
+    let mut part = BoundaryNet {
+        id: net,
+        terminals: terminals
+            .into_iter()
+            .map(|Point(row, col, lay)| (row, col, lay))
+            .collect(),
+        routes: clipped.iter().map(to_raw).collect(),
+        crossings: crossings.iter().map(to_raw).collect(),
+    };
+    part.terminals.sort_unstable();
+    part.routes.sort_unstable();
+    part.crossings.sort_unstable();
+
+    Some(part)
+}
+
+/// Cuts the grid in square tiles of `size` grids.
+/// A net belongs to the tile holding its bounding box, other nets are boundary nets of every tile they cross.
+/// A movable cell may only be moved by its tile if all of its nets belong to the tile.
+pub fn partition(chip: &Chip, size: usize) -> Vec<Tile> {
+    let size = size.max(1);
+    let Pair(rows, cols) = chip.dim;
+    let (trows, tcols) = ((rows + size - 1) / size, (cols + size - 1) / size);
+
+    let mut tiles: Vec<_> = (0..trows * tcols)
+        .map(|id| {
+            let (row, col) = (id / tcols * size, id % tcols * size);
+            Tile {
+                id,
+                lo: (row, col),
+                hi: ((row + size).min(rows) - 1, (col + size).min(cols) - 1),
+                ..Tile::default()
+            }
+        })
+        .collect();
+    let tile_of = |Pair(row, col): Pair<usize>| row / size * tcols + col / size;
+
+    // the tile owning every net, if any
+    let owners: Vec<_> = (0..chip.nets.len())
+        .map(|net| {
+            let (lo, hi) = chip.bounding_box(net);
+            if tile_of(lo) == tile_of(hi) {
+                Some(tile_of(lo))
+            } else {
+                None
+            }
+        })
+        .collect();
+
+    for net in chip.nets.iter() {
+        let routes: Vec<_> = net.segments().iter().map(to_raw).collect();
+        match owners[net.id] {
+            Some(owner) => tiles[owner].nets.push((net.id, routes)),
+            None => {
+                for tile in tiles.iter_mut() {
+                    if let Some(part) = boundary_net(chip, net.id, tile, &tile_of) {
+                        tile.boundary.push(part);
+                    }
+                }
+            }
+        }
+    }
+
+    for cell in chip.cells.iter() {
+        let tile = tile_of(cell.position);
+        let movable = cell.movable == CellType::Movable
+            && chip.cell_nets[cell.id]
+                .iter()
+                .all(|&net| owners[net] == Some(tile));
+        let Pair(row, col) = cell.position;
+        tiles[tile].cells.push((cell.id, (row, col), movable));
+    }
+
+    tiles
+}
+
+/// Merges the solutions of the tiles back into the chip.
+/// Every solution may only move the cells and reroute the nets its tile owns,
+/// and the moved cells must stay in the tile and within the limit of moved cells.
+/// A solution may also reroute the parts of boundary nets in its tile,
+/// which are stitched with the other parts and the crossings into whole nets.
+pub fn merge(chip: &mut Chip, tiles: &[Tile], solutions: &[TileSolution]) -> Result<()> {
+    for solution in solutions.iter() {
+        let tile = tiles
+            .get(solution.id)
+            .ok_or_else(|| anyhow!("Tile {} not found", solution.id))?;
+
+        for &(cell, (row, col)) in solution.cells.iter() {
+            let movable = tile
+                .cells
+                .iter()
+                .any(|&(id, _, movable)| id == cell && movable);
+            if !movable {
+                return Err(anyhow!("Tile {} cannot move cell {}", tile.id, cell));
+            }
+            if !tile.contains(Pair(row, col)) {
+                return Err(anyhow!("Tile {} moves cell {} out of it", tile.id, cell));
+            }
+            if !chip.allowed(cell, Pair(row, col)) {
+                return Err(anyhow!(
+                    "Tile {} moves cell {} out of its voltage area",
+                    tile.id,
+                    cell
+                ));
+            }
+        }
+
+        for (net, routes) in solution.routes.iter() {
+            if tile_owns(tile, *net) {
+                continue;
+            }
+            if !tile.boundary.iter().any(|part| part.id == *net) {
+                return Err(anyhow!("Tile {} cannot reroute net {}", tile.id, net));
+            }
+
+            let inside = routes
+                .iter()
+                .flat_map(|raw| from_raw(raw).points())
+                .all(|point| tile.contains(point.flatten()));
+            if !inside {
+                return Err(anyhow!("Tile {} routes net {} out of it", tile.id, net));
+            }
+        }
+    }
+
+    let moved: HashSet<_> = solutions
+        .iter()
+        .flat_map(|solution| solution.cells.iter())
+        .map(|&(cell, _)| cell)
+        .filter(|&cell| !chip.cells[cell].moved)
+        .collect();
+    if chip.already_moved + moved.len() > chip.max_move {
+        return Err(anyhow!(
+            "Tiles move {} more cells, exceeding the limit of {}",
+            moved.len(),
+            chip.max_move
+        ));
+    }
+
+    let pass = mem::replace(&mut chip.pass, Provenance::Tiles);
+    for solution in solutions.iter() {
+        for &(cell, (row, col)) in solution.cells.iter() {
+            chip.move_cell(cell, Pair(row, col));
+        }
+        for (net, routes) in solution.routes.iter() {
+            if tile_owns(&tiles[solution.id], *net) {
+                chip.set_routes(*net, routes.iter().map(from_raw).collect());
+            }
+        }
+    }
+
+    // new routes of the parts of boundary nets, by tile and net
+    let rerouted: HashMap<_, _> = solutions
+        .iter()
+        .flat_map(|solution| {
+            solution
+                .routes
+                .iter()
+                .map(move |(net, routes)| ((solution.id, *net), routes))
+        })
+        .collect();
+
+    let mut stitched: HashMap<usize, HashSet<Route<usize>>> = HashMap::new();
+    for tile in tiles.iter() {
+        for part in tile.boundary.iter() {
+            let routes = rerouted
+                .get(&(tile.id, part.id))
+                .copied()
+                .unwrap_or(&part.routes);
+            stitched
+                .entry(part.id)
+                .or_insert_with(HashSet::new)
+                .extend(routes.iter().chain(part.crossings.iter()).map(from_raw));
+        }
+    }
+
+    let boundary: HashSet<_> = rerouted.keys().map(|&(_, net)| net).collect();
+    for (net, routes) in stitched.into_iter() {
+        if boundary.contains(&net) {
+            chip.set_routes(net, routes);
+        }
+    }
+    chip.pass = pass;
+
+    Ok(())
+}
@@ -0,0 +1,284 @@
+use crate::{components::Pair, consts::EXACT_STEINER_PINS, utilities::UnionFind};
+use std::{cmp, collections::HashSet};
+
+/// A tree over grids of a net in 2D, as the topology its routes are to follow.
+/// The first `pins` points are the grids of the pins, the others Steiner points.
+#[derive(Clone, Debug, Default, Eq, PartialEq)]
+pub struct Topology {
+    /// grids of the pins, then of the Steiner points
+    pub points: Vec<Pair<usize>>,
+    /// number of points which are pins
+    pub pins: usize,
+    /// edges as the indices of both ends in `points`
+    pub edges: Vec<(usize, usize)>,
+}
+
+impl Topology {
+    /// Rectilinear length of the edges.
+    pub fn length(&self) -> usize {
+        self.edges
+            .iter()
+            .map(|&(a, b)| distance(self.points[a], self.points[b]))
+            .sum()
+    }
+
+    /// The Steiner points, which are not pins.
+    pub fn steiner_points(&self) -> &[Pair<usize>] {
+        &self.points[self.pins..]
+    }
+
+    /// The edges as 2-pin connections between their ends, in the order of `edges`.
+    pub fn connections(&self) -> Vec<(Pair<usize>, Pair<usize>)> {
+        self.edges
+            .iter()
+            .map(|&(a, b)| (self.points[a], self.points[b]))
+            .collect()
+    }
+}
+
+/// The grids of pins, duplicates counted once, in the order they first appear.
+fn distinct(pins: &[Pair<usize>]) -> Vec<Pair<usize>> {
+    let mut seen = HashSet::new();
+    pins.iter()
+        .copied()
+        .filter(|&pin| seen.insert(pin))
+        .collect()
+}
+
+/// Rectilinear distance between two grids.
+pub fn distance(a: Pair<usize>, b: Pair<usize>) -> usize {
+    let diff = |a: usize, b: usize| cmp::max(a, b) - cmp::min(a, b);
+    diff(a.x(), b.x()) + diff(a.y(), b.y())
+}
+
+/// Minimum spanning tree of points by Prim's algorithm, as edges of their indices.
+fn prim(points: &[Pair<usize>]) -> Vec<(usize, usize)> {
+    let len = points.len();
+    let mut edges = Vec::with_capacity(len.saturating_sub(1));
+    let mut dist = vec![usize::MAX; len];
+    let mut from = vec![0; len];
+    let mut done = vec![false; len];
+
+    if len > 0 {
+        dist[0] = 0;
+    }
+    for _ in 0..len {
+        let next = (0..len)
+            .filter(|&idx| !done[idx])
+            .min_by_key(|&idx| dist[idx])
+            .expect("Points left to span");
+        done[next] = true;
+        if next != 0 {
+            edges.push((from[next], next));
+        }
+
+        for idx in (0..len).filter(|&idx| !done[idx]) {
+            let d = distance(points[next], points[idx]);
+            if d < dist[idx] {
+                dist[idx] = d;
+                from[idx] = next;
+            }
+        }
+    }
+    edges
+}
+
+/// Minimum spanning tree over the grids of pins by Prim's algorithm, duplicates counted once.
+/// Every edge joins two pins, and edges are in the order the tree grows from the first pin.
+pub fn prim_tree(pins: &[Pair<usize>]) -> Topology {
+    let points = distinct(pins);
+    Topology {
+        edges: prim(&points),
+        pins: points.len(),
+        points,
+    }
+}
+
+/// Minimum spanning tree over the grids of pins by Kruskal's algorithm, duplicates counted once.
+/// Every edge joins two pins, and edges are from the shortest, ties broken by the pins.
+pub fn kruskal_tree(pins: &[Pair<usize>]) -> Topology {
+    let points = distinct(pins);
+    let len = points.len();
+
+    let mut candidates: Vec<_> = (0..len)
+        .flat_map(|a| (a + 1..len).map(move |b| (a, b)))
+        .map(|(a, b)| (distance(points[a], points[b]), a, b))
+        .collect();
+    candidates.sort_unstable();
+
+    let mut groups = UnionFind::new(len);
+    let mut edges = Vec::with_capacity(len.saturating_sub(1));
+    for (_, a, b) in candidates {
+        if edges.len() + 1 >= len {
+            break;
+        }
+        if groups.union(a, b) {
+            edges.push((a, b));
+        }
+    }
+
+    Topology {
+        points,
+        pins: len,
+        edges,
+    }
+}
+
+/// Rectilinear Steiner minimal tree over the grids of pins, duplicates counted once.
+/// Up to `EXACT_STEINER_PINS` pins, the tree is minimal, found among the spanning trees
+/// with Steiner points on the Hanan grid, the rows and columns of the pins.
+/// Over that, Steiner points are added to a minimum spanning tree wherever two edges
+/// of a point can share a part, at the median of the three ends, as long as it gets shorter.
+pub fn steiner_tree(pins: &[Pair<usize>]) -> Topology {
+    let mut seen = HashSet::new();
+    let points: Vec<_> = pins
+        .iter()
+        .copied()
+        .filter(|&pin| seen.insert(pin))
+        .collect();
+
+    if points.len() <= EXACT_STEINER_PINS {
+        exact(points)
+    } else {
+        steinerize(points)
+    }
+}
+
+/// Steiner minimal tree of a few pins, with the fewest Steiner points among the minimal ones.
+fn exact(pins: Vec<Pair<usize>>) -> Topology {
+    let mut rows: Vec<_> = pins.iter().map(Pair::x).collect();
+    let mut cols: Vec<_> = pins.iter().map(Pair::y).collect();
+    rows.sort_unstable();
+    rows.dedup();
+    cols.sort_unstable();
+    cols.dedup();
+    let hanan: Vec<_> = rows
+        .iter()
+        .flat_map(|&row| cols.iter().map(move |&col| Pair(row, col)))
+        .filter(|grid| !pins.contains(grid))
+        .collect();
+
+    let mut best = Topology {
+        edges: prim(&pins),
+        points: pins.clone(),
+        pins: pins.len(),
+    };
+    let mut best_length = best.length();
+
+    // a tree over n pins needs no more than n - 2 Steiner points
+    let mut chosen = Vec::new();
+    for count in 1..=pins.len().saturating_sub(2) {
+        subsets(hanan.len(), count, 0, &mut chosen, &mut |chosen| {
+            let mut points = pins.clone();
+            points.extend(chosen.iter().map(|&idx| hanan[idx]));
+            let topology = Topology {
+                edges: prim(&points),
+                points,
+                pins: pins.len(),
+            };
+
+            let length = topology.length();
+            if length < best_length {
+                best = topology;
+                best_length = length;
+            }
+        });
+    }
+    best
+}
+
+/// Calls `visit` with every subset of `count` indices below `len`, in increasing order.
+fn subsets<F>(len: usize, count: usize, start: usize, chosen: &mut Vec<usize>, visit: &mut F)
+where
+    F: FnMut(&[usize]),
+{
+    if chosen.len() == count {
+        visit(chosen);
+        return;
+    }
+    for idx in start..len {
+        chosen.push(idx);
+        subsets(len, count, idx + 1, chosen, visit);
+        chosen.pop();
+    }
+}
+
+/// Steiner tree of many pins, from their minimum spanning tree.
+/// Two edges `(u, v)` and `(u, w)` are replaced by three edges to the median `s` of `u`, `v`, `w`,
+/// one pair at a time, the one saving the most first, until no pair saves any length.
+fn steinerize(pins: Vec<Pair<usize>>) -> Topology {
+    let mut points = pins.clone();
+    let mut neighbors = vec![Vec::new(); points.len()];
+    for (a, b) in prim(&points) {
+        neighbors[a].push(b);
+        neighbors[b].push(a);
+    }
+
+    let median = |a: usize, b: usize, c: usize| {
+        let mut values = [a, b, c];
+        values.sort_unstable();
+        values[1]
+    };
+
+    loop {
+        let mut best: Option<(usize, usize, usize, usize)> = None;
+        for u in 0..points.len() {
+            for (i, &v) in neighbors[u].iter().enumerate() {
+                for &w in neighbors[u].iter().skip(i + 1) {
+                    let (pu, pv, pw) = (points[u], points[v], points[w]);
+                    let s = Pair(
+                        median(pu.x(), pv.x(), pw.x()),
+                        median(pu.y(), pv.y(), pw.y()),
+                    );
+                    let before = distance(pu, pv) + distance(pu, pw);
+                    let after = distance(pu, s) + distance(pv, s) + distance(pw, s);
+
+                    if after < before && best.map_or(true, |best| before - after > best.0) {
+                        best = Some((before - after, u, v, w));
+                    }
+                }
+            }
+        }
+
+        let (_, u, v, w) = match best {
+            Some(best) => best,
+            None => break,
+        };
+        let (pu, pv, pw) = (points[u], points[v], points[w]);
+        let s = Pair(
+            median(pu.x(), pv.x(), pw.x()),
+            median(pu.y(), pv.y(), pw.y()),
+        );
+
+        // the median may be one of the ends, which then takes the edges to the others
+        let hub = match [u, v, w].iter().find(|&&idx| points[idx] == s) {
+            Some(&idx) => idx,
+            None => {
+                points.push(s);
+                neighbors.push(Vec::new());
+                points.len() - 1
+            }
+        };
+        neighbors[u].retain(|&idx| idx != v && idx != w);
+        neighbors[v].retain(|&idx| idx != u);
+        neighbors[w].retain(|&idx| idx != u);
+        for idx in [u, v, w].iter().copied().filter(|&idx| idx != hub) {
+            neighbors[hub].push(idx);
+            neighbors[idx].push(hub);
+        }
+    }
+
+    let edges = (0..points.len())
+        .flat_map(|a| {
+            neighbors[a]
+                .iter()
+                .filter(move |&&b| a < b)
+                .map(move |&b| (a, b))
+        })
+        .collect();
+    Topology {
+        points,
+        pins: pins.len(),
+        edges,
+    }
+}
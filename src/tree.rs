@@ -0,0 +1,224 @@
+use crate::components::{Point, Route, Towards};
+use std::collections::{HashMap, HashSet, VecDeque};
+
+/// A node of a route tree: a pin, an end of a segment, or where segments meet.
+#[derive(Clone, Debug, Default, Eq, PartialEq)]
+pub struct TreeNode {
+    /// grid of the node
+    pub point: Point<usize>,
+    /// whether a pin is on the node
+    pub pin: bool,
+    /// nodes joined to this one by a straight segment, sorted
+    pub neighbors: Vec<usize>,
+}
+
+/// The routes of a net as a graph of straight segments between nodes.
+/// Nodes are the pins, the ends of the segments, and the pseudo pins,
+/// where a segment ends in the middle of another, and the Steiner points,
+/// where segments along different axes cross. Segments are split at the nodes on them.
+/// Routes without cycles make a tree, which can be walked from any node.
+#[derive(Clone, Debug, Default, Eq, PartialEq)]
+pub struct RouteTree {
+    /// nodes, sorted by grid
+    pub nodes: Vec<TreeNode>,
+    /// node on every grid with one
+    index: HashMap<Point<usize>, usize>,
+}
+
+impl RouteTree {
+    /// The tree of some routes connecting pins at some grids.
+    /// Routes are expected to be validated, going along a single axis.
+    pub fn new(routes: &HashSet<Route<usize>>, pins: &[Point<usize>]) -> Self {
+        let pins: HashSet<_> = pins.iter().copied().collect();
+        let mut points: Vec<_> = routes
+            .iter()
+            .flat_map(|route| [route.source(), route.target()].to_vec())
+            .chain(pins.iter().copied())
+            .chain(crossings(routes))
+            .collect();
+        points.sort_unstable();
+        points.dedup();
+
+        let index: HashMap<_, _> = points
+            .iter()
+            .enumerate()
+            .map(|(idx, &point)| (point, idx))
+            .collect();
+        let mut nodes: Vec<_> = points
+            .iter()
+            .map(|&point| TreeNode {
+                point,
+                pin: pins.contains(&point),
+                neighbors: Vec::new(),
+            })
+            .collect();
+
+        // a segment goes from node to node, through the nodes in its middle
+        for route in routes.iter() {
+            let along: Vec<_> = route
+                .points()
+                .filter_map(|point| index.get(&point).copied())
+                .collect();
+            for pair in along.windows(2) {
+                nodes[pair[0]].neighbors.push(pair[1]);
+                nodes[pair[1]].neighbors.push(pair[0]);
+            }
+        }
+        for node in nodes.iter_mut() {
+            node.neighbors.sort_unstable();
+            node.neighbors.dedup();
+        }
+
+        Self { nodes, index }
+    }
+
+    /// The segments of the tree, split at every node so that they only meet at their ends.
+    pub fn split(routes: &HashSet<Route<usize>>) -> HashSet<Route<usize>> {
+        Self::new(routes, &[]).edges().into_iter().collect()
+    }
+
+    /// The node on a grid, if any.
+    pub fn node_at(&self, point: Point<usize>) -> Option<usize> {
+        self.index.get(&point).copied()
+    }
+
+    /// The segments between neighboring nodes, each once, sorted.
+    pub fn edges(&self) -> Vec<Route<usize>> {
+        self.nodes
+            .iter()
+            .enumerate()
+            .flat_map(|(idx, node)| {
+                node.neighbors
+                    .iter()
+                    .filter(move |&&other| idx < other)
+                    .map(move |&other| Route(node.point, self.nodes[other].point))
+            })
+            .collect()
+    }
+
+    /// The pseudo pins: nodes other than pins where segments meet, turning or branching.
+    pub fn pseudo_pins(&self) -> Vec<usize> {
+        (0..self.nodes.len())
+            .filter(|&idx| !self.nodes[idx].pin && self.nodes[idx].neighbors.len() > 1)
+            .collect()
+    }
+
+    /// The nodes with at most one neighbor.
+    pub fn leaves(&self) -> Vec<usize> {
+        (0..self.nodes.len())
+            .filter(|&idx| self.nodes[idx].neighbors.len() <= 1)
+            .collect()
+    }
+
+    /// Removes the dangling segments, ending at no pin, until every leaf is a pin.
+    /// Returns the number of nodes removed.
+    pub fn prune(&mut self) -> usize {
+        let mut removed = vec![false; self.nodes.len()];
+        let mut degrees: Vec<_> = self.nodes.iter().map(|node| node.neighbors.len()).collect();
+        let mut leaves: Vec<_> = (0..self.nodes.len())
+            .filter(|&idx| !self.nodes[idx].pin && degrees[idx] <= 1)
+            .collect();
+
+        while let Some(leaf) = leaves.pop() {
+            removed[leaf] = true;
+            for &next in self.nodes[leaf].neighbors.iter() {
+                if removed[next] {
+                    continue;
+                }
+                degrees[next] -= 1;
+                if !self.nodes[next].pin && degrees[next] == 1 {
+                    leaves.push(next);
+                }
+            }
+        }
+
+        let count = removed.iter().filter(|&&removed| removed).count();
+        if count == 0 {
+            return 0;
+        }
+
+        // nodes are renumbered, keeping their order
+        let mut ids = vec![None; self.nodes.len()];
+        let mut next = 0;
+        for (idx, id) in ids.iter_mut().enumerate() {
+            if !removed[idx] {
+                *id = Some(next);
+                next += 1;
+            }
+        }
+        let nodes = std::mem::take(&mut self.nodes);
+        self.nodes = nodes
+            .into_iter()
+            .enumerate()
+            .filter(|&(idx, _)| !removed[idx])
+            .map(|(_, mut node)| {
+                node.neighbors = node
+                    .neighbors
+                    .iter()
+                    .filter_map(|&other| ids[other])
+                    .collect();
+                node
+            })
+            .collect();
+        self.index = self
+            .nodes
+            .iter()
+            .enumerate()
+            .map(|(idx, node)| (node.point, idx))
+            .collect();
+        count
+    }
+
+    /// Walks the nodes reachable from `root` breadth first,
+    /// each with the node it was reached from, `None` for the root.
+    pub fn walk(&self, root: usize) -> Vec<(usize, Option<usize>)> {
+        let mut seen = vec![false; self.nodes.len()];
+        let mut order = Vec::new();
+        let mut queue = VecDeque::new();
+        seen[root] = true;
+        queue.push_back((root, None));
+
+        while let Some((node, parent)) = queue.pop_front() {
+            order.push((node, parent));
+            for &next in self.nodes[node].neighbors.iter() {
+                if !seen[next] {
+                    seen[next] = true;
+                    queue.push_back((next, Some(node)));
+                }
+            }
+        }
+        order
+    }
+
+    /// Whether every node is reachable from every other.
+    pub fn is_connected(&self) -> bool {
+        self.nodes.is_empty() || self.walk(0).len() == self.nodes.len()
+    }
+
+    /// Whether the nodes make a tree, connected and without cycles.
+    pub fn is_tree(&self) -> bool {
+        let edges: usize = self.nodes.iter().map(|node| node.neighbors.len()).sum();
+        self.is_connected() && edges / 2 + 1 == self.nodes.len().max(1)
+    }
+}
+
+/// The grids where segments along different axes cross, in the middle of one of them at least.
+fn crossings(routes: &HashSet<Route<usize>>) -> Vec<Point<usize>> {
+    // axes of the segments going through every grid, as bits
+    let mut axes: HashMap<Point<usize>, u8> = HashMap::new();
+    for route in routes.iter() {
+        let axis = match route.towards() {
+            Some(Towards::Left) | Some(Towards::Right) => 1,
+            Some(Towards::Up) | Some(Towards::Down) => 2,
+            Some(Towards::Top) | Some(Towards::Bottom) => 4,
+            None => continue,
+        };
+        for point in route.points() {
+            *axes.entry(point).or_insert(0) |= axis;
+        }
+    }
+    axes.into_iter()
+        .filter(|&(_, axes)| axes.count_ones() > 1)
+        .map(|(point, _)| point)
+        .collect()
+}
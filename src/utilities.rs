@@ -1,53 +1,435 @@
+use crate::{
+    components::{Point, Route},
+    flat::PointMap,
+};
 use anyhow::{anyhow, Error, Result};
+use flate2::bufread::MultiGzDecoder;
 use num::Num;
-use std::{cmp::PartialEq, fmt::Debug, str::FromStr};
+use regex::Regex;
+use std::{
+    cmp::PartialEq,
+    collections::{HashSet, VecDeque},
+    fmt::Debug,
+    fs::{self, File},
+    io::{self, BufRead, BufReader},
+    ops::Deref,
+    path::Path,
+    str::FromStr,
+};
 
 #[derive(Debug)]
 pub struct InputError;
 
+impl From<InputError> for Error {
+    fn from(_: InputError) -> Self {
+        anyhow!("Unexpected end of input")
+    }
+}
+
+/// Reads patterns from a file, one name or regular expression per line.
+/// Patterns match whole names only. Blank lines and lines starting with `#` are skipped.
+pub fn read_patterns(filename: &str) -> Result<Vec<Regex>> {
+    let content: String = fs::read_to_string(filename)?;
+    content
+        .lines()
+        .map(str::trim)
+        .filter(|line| !line.is_empty() && !line.starts_with('#'))
+        .map(|line| Regex::new(&format!("^(?:{})$", line)).map_err(Error::from))
+        .collect()
+}
+
+/// First bytes of gzip files.
+const GZIP_MAGIC: [u8; 2] = [0x1f, 0x8b];
+
+/// First bytes of zstd files.
+const ZSTD_MAGIC: [u8; 4] = [0x28, 0xb5, 0x2f, 0xfd];
+
+/// The 64-bit FNV-1a hash of everything written to it,
+/// which unlike the hash of `HashMap` stays the same across runs, platforms and versions.
+#[derive(Clone, Copy, Debug)]
+pub struct Fnv(u64);
+
+impl Fnv {
+    /// An empty hash.
+    pub fn new() -> Self {
+        Self(0xcbf2_9ce4_8422_2325)
+    }
+
+    /// The hash of everything written so far.
+    pub fn finish(&self) -> u64 {
+        self.0
+    }
+}
+
+impl Default for Fnv {
+    fn default() -> Self {
+        Self::new()
+    }
+}
+
+impl io::Write for Fnv {
+    fn write(&mut self, bytes: &[u8]) -> io::Result<usize> {
+        for &byte in bytes {
+            self.0 ^= byte as u64;
+            self.0 = self.0.wrapping_mul(0x0100_0000_01b3);
+        }
+        Ok(bytes.len())
+    }
+
+    fn flush(&mut self) -> io::Result<()> {
+        Ok(())
+    }
+}
+
+/// A hash of the size and the modification time of a file, see `Fnv`,
+/// which changes when the file does without reading it.
+pub fn stamp(filename: &str) -> Result<u64> {
+    use std::{io::Write, time::UNIX_EPOCH};
+
+    let metadata = fs::metadata(filename)?;
+    let modified = metadata.modified()?.duration_since(UNIX_EPOCH)?;
+
+    let mut hash = Fnv::new();
+    hash.write_all(&metadata.len().to_le_bytes())?;
+    hash.write_all(&modified.as_nanos().to_le_bytes())?;
+    Ok(hash.finish())
+}
+
+/// Name of the standard input or output, in place of a file name.
+pub const STDIO: &str = "-";
+
+/// Opens a file for reading, or the standard input if named `-`, see `decompress`.
+pub fn open(filename: &str) -> Result<Box<dyn BufRead>> {
+    if filename == STDIO {
+        return decompress(BufReader::new(io::stdin()), None);
+    }
+
+    let extension = Path::new(filename).extension().and_then(|ext| ext.to_str());
+    decompress(BufReader::new(File::open(filename)?), extension)
+}
+
+/// Decompresses a reader on the fly if compressed with gzip or zstd,
+/// judging by the extension of its file (`gz` or `zst`) if any, or else by its first bytes.
+pub fn decompress<R>(mut reader: R, extension: Option<&str>) -> Result<Box<dyn BufRead>>
+where
+    R: BufRead + 'static,
+{
+    let head = reader.fill_buf()?;
+    let gzip = extension == Some("gz") || head.starts_with(&GZIP_MAGIC);
+    let zstd = extension == Some("zst") || head.starts_with(&ZSTD_MAGIC);
+
+    if gzip {
+        Ok(Box::new(BufReader::new(MultiGzDecoder::new(reader))))
+    } else if zstd {
+        Ok(Box::new(BufReader::new(zstd::Decoder::with_buffer(
+            reader,
+        )?)))
+    } else {
+        Ok(Box::new(reader))
+    }
+}
+
+/// Starts a comment, which goes on to the end of the line.
+const COMMENT: char = '#';
+
+/// Splits a string by whitespace like `split_whitespace`, skipping comments,
+/// keeping track of the line of the last token for error messages.
+#[derive(Clone, Debug)]
+pub struct Tokens<'a> {
+    /// what is left to split
+    rest: &'a str,
+    /// line of the last token (starting from 1)
+    line: usize,
+}
+
+/// Splits a string like `Tokens`, keeping the text of every line
+/// so that errors can show the line they are on, for debugging inputs.
+#[derive(Clone, Debug)]
+pub struct Traced<'a> {
+    /// tokens of the string
+    tokens: Tokens<'a>,
+    /// text of every line
+    lines: Vec<&'a str>,
+}
+
+/// Tokens of an input, knowing the line of the last one for error messages.
+pub trait Tokenizer: Iterator {
+    /// Line of the last token (starting from 1).
+    fn line(&self) -> usize;
+}
+
+/// Splits a stream by whitespace one line at a time, skipping comments,
+/// so that big inputs are never held in memory.
+/// Reading stops at the first error, which can be taken afterwards.
 #[derive(Debug)]
-pub struct NameError;
+pub struct Stream<R> {
+    /// source of the lines
+    reader: R,
+    /// tokens left in the current line
+    tokens: VecDeque<String>,
+    /// line of the last token (starting from 1)
+    line: usize,
+    /// lines read so far
+    lines: usize,
+    /// error which stopped reading
+    error: Option<io::Error>,
+}
 
-impl From<InputError> for Error {
-    fn from(err: InputError) -> Self {
-        anyhow!(format!("Error: {:?}", err))
+/// Tokens which can be looked ahead and put back,
+/// so that optional sections can be probed without being consumed.
+#[derive(Debug)]
+pub struct Lookahead<T: Tokenizer> {
+    /// source of the tokens
+    tokens: T,
+    /// tokens looked ahead or put back, with their lines
+    buffer: VecDeque<(T::Item, usize)>,
+    /// line of the last token (starting from 1)
+    line: usize,
+}
+
+impl<T: Tokenizer> Lookahead<T> {
+    /// Wraps `tokens`.
+    pub fn new(tokens: T) -> Self {
+        let line = tokens.line();
+        Self {
+            tokens,
+            buffer: VecDeque::new(),
+            line,
+        }
+    }
+
+    /// The next token, without consuming it.
+    pub fn peek(&mut self) -> Option<&T::Item> {
+        self.peek_n(0)
+    }
+
+    /// The token `n` tokens after the next one, without consuming any.
+    pub fn peek_n(&mut self, n: usize) -> Option<&T::Item> {
+        while self.buffer.len() <= n {
+            let token = self.tokens.next()?;
+            self.buffer.push_back((token, self.tokens.line()));
+        }
+        self.buffer.get(n).map(|(token, _)| token)
+    }
+
+    /// The tokens wrapped, which may be ahead of the tokens looked ahead.
+    pub fn get_ref(&self) -> &T {
+        &self.tokens
+    }
+
+    /// Puts a token back, to be the next one again.
+    pub fn put_back(&mut self, token: T::Item) {
+        self.buffer.push_front((token, self.line));
+    }
+}
+
+impl<T: Tokenizer> Iterator for Lookahead<T> {
+    type Item = T::Item;
+
+    fn next(&mut self) -> Option<Self::Item> {
+        let (token, line) = match self.buffer.pop_front() {
+            Some(buffered) => buffered,
+            None => {
+                let token = self.tokens.next()?;
+                (token, self.tokens.line())
+            }
+        };
+        self.line = line;
+        Some(token)
+    }
+}
+
+impl<T: Tokenizer> Tokenizer for Lookahead<T> {
+    fn line(&self) -> usize {
+        self.line
     }
 }
 
-impl From<NameError> for Error {
-    fn from(err: NameError) -> Self {
-        anyhow!(format!("Error: {:?}", err))
+impl<T: Tokenizer + ?Sized> Tokenizer for &mut T {
+    fn line(&self) -> usize {
+        (**self).line()
     }
 }
 
-/// Parses a `&str` from an iterator
-pub fn parse_string<'a, T>(iter: &mut T) -> Result<&'a str>
+impl<'a> Tokens<'a> {
+    /// Splits `content`.
+    pub fn new(content: &'a str) -> Self {
+        Self::at_line(content, 1)
+    }
+
+    /// Splits `content`, which starts at `line` of a bigger input.
+    pub fn at_line(content: &'a str, line: usize) -> Self {
+        Self {
+            rest: content,
+            line,
+        }
+    }
+}
+
+impl<'a> Traced<'a> {
+    /// Splits `content`.
+    pub fn new(content: &'a str) -> Self {
+        Self {
+            tokens: Tokens::new(content),
+            lines: content.lines().collect(),
+        }
+    }
+
+    /// Text of a line (starting from 1), empty past the end.
+    pub fn text(&self, line: usize) -> &'a str {
+        line.checked_sub(1)
+            .and_then(|idx| self.lines.get(idx))
+            .copied()
+            .unwrap_or("")
+    }
+}
+
+impl<'a> Iterator for Traced<'a> {
+    type Item = &'a str;
+
+    fn next(&mut self) -> Option<Self::Item> {
+        self.tokens.next()
+    }
+}
+
+impl<'a> Tokenizer for Traced<'a> {
+    fn line(&self) -> usize {
+        self.tokens.line()
+    }
+}
+
+impl<'a> Tokenizer for Tokens<'a> {
+    fn line(&self) -> usize {
+        self.line
+    }
+}
+
+impl<R: BufRead> Stream<R> {
+    /// Splits the lines of `reader`.
+    pub fn new(reader: R) -> Self {
+        Self {
+            reader,
+            tokens: VecDeque::new(),
+            line: 1,
+            lines: 0,
+            error: None,
+        }
+    }
+
+    /// Takes the error which stopped reading, if any.
+    pub fn take_error(&mut self) -> Option<io::Error> {
+        self.error.take()
+    }
+}
+
+impl<R: BufRead> Iterator for Stream<R> {
+    type Item = String;
+
+    fn next(&mut self) -> Option<Self::Item> {
+        let mut buffer = String::new();
+
+        while self.tokens.is_empty() {
+            if self.error.is_some() {
+                return None;
+            }
+
+            buffer.clear();
+            match self.reader.read_line(&mut buffer) {
+                Ok(0) => return None,
+                Ok(_) => {
+                    self.lines += 1;
+                    let line = buffer.split(COMMENT).next().unwrap_or("");
+                    self.tokens
+                        .extend(line.split_whitespace().map(str::to_string));
+                }
+                Err(err) => self.error = Some(err),
+            }
+        }
+
+        self.line = self.lines;
+        self.tokens.pop_front()
+    }
+}
+
+impl<R: BufRead> Tokenizer for Stream<R> {
+    fn line(&self) -> usize {
+        self.line
+    }
+}
+
+impl<'a> Iterator for Tokens<'a> {
+    type Item = &'a str;
+
+    fn next(&mut self) -> Option<Self::Item> {
+        let mut rest = self.rest;
+        loop {
+            let start = rest
+                .find(|c: char| !c.is_whitespace())
+                .unwrap_or_else(|| rest.len());
+            self.line += rest[..start].matches('\n').count();
+            rest = &rest[start..];
+
+            if !rest.starts_with(COMMENT) {
+                break;
+            }
+            let end = rest.find('\n').unwrap_or_else(|| rest.len());
+            rest = &rest[end..];
+        }
+
+        if rest.is_empty() {
+            self.rest = rest;
+            return None;
+        }
+
+        let end = rest
+            .find(|c: char| c.is_whitespace() || c == COMMENT)
+            .unwrap_or_else(|| rest.len());
+        self.rest = &rest[end..];
+        Some(&rest[..end])
+    }
+}
+
+/// Parses a `&str` (or a `String`) from an iterator
+pub fn parse_string<T, S>(iter: &mut T) -> Result<S>
 where
-    T: Iterator<Item = &'a str>,
+    T: Iterator<Item = S>,
 {
     iter.next().ok_or(InputError).map_err(Error::from)
 }
 
 /// Parses a numeric value (usize, isize...) from an iterator
-pub fn parse_numeric<'a, T, U>(iter: &mut T) -> Result<U>
+pub fn parse_numeric<T, S, U>(iter: &mut T) -> Result<U>
 where
-    T: Iterator<Item = &'a str>,
+    T: Iterator<Item = S>,
+    S: Deref<Target = str>,
     U: FromStr + Num,
     Error: From<<U as FromStr>::Err>,
 {
     parse_string(iter)?.parse().map_err(Error::from)
 }
 
+/// Converts a 1-based index in files to a 0-based index in memory.
+pub fn to_internal(idx: usize) -> Result<usize> {
+    idx.checked_sub(1)
+        .ok_or_else(|| anyhow!("Index 0 found, indices start from 1"))
+}
+
+/// Converts a 0-based index in memory to a 1-based index in files.
+pub fn to_external(idx: usize) -> usize {
+    idx + 1
+}
+
 /// Returns `Ok(())` if `mine == input`.
-/// Returns `Err(NameError)` otherwise.
+/// Returns an error showing both otherwise.
 pub fn check_eq<T, U>(mine: T, input: U) -> Result<()>
 where
-    T: PartialEq<U>,
+    T: PartialEq<U> + Debug,
+    U: Debug,
 {
     if mine == input {
         Ok(())
     } else {
-        Err(NameError).map_err(Error::from)
+        Err(anyhow!("Expected {:?}, found {:?}", input, mine))
     }
 }
 
@@ -200,3 +582,71 @@ impl UnionFind {
         Some(true)
     }
 }
+
+/// Whether routes connect all the pins at `pins` together.
+pub fn connected(pins: &[Point<usize>], routes: &HashSet<Route<usize>>) -> bool {
+    let mut ids: PointMap<usize> = PointMap::new();
+    let mut chains = Vec::with_capacity(routes.len());
+    for route in routes.iter() {
+        let chain: Vec<_> = route
+            .points()
+            .map(|point| {
+                let next = ids.len();
+                *ids.get_or_insert_with(point, || next)
+            })
+            .collect();
+        chains.push(chain);
+    }
+
+    let mut union_find = UnionFind::new(ids.len());
+    for chain in chains.iter() {
+        for pair in chain.windows(2) {
+            union_find.union(pair[0], pair[1]);
+        }
+    }
+
+    let mut pins = pins.iter().copied();
+    let first = match pins.next() {
+        Some(first) => first,
+        None => return true,
+    };
+
+    match ids.get(first) {
+        Some(&head) => pins.all(|pin| match ids.get(pin) {
+            Some(&idx) => union_find.grouped(head, idx) == Some(true),
+            None => false,
+        }),
+        None => pins.all(|pin| pin == first),
+    }
+}
+
+/// A xorshift pseudo random number generator, reproducible given its seed.
+#[derive(Clone, Copy, Debug, Eq, Hash, PartialEq)]
+pub struct Rng {
+    /// state, never zero
+    state: u64,
+}
+
+impl Rng {
+    /// Creates a generator from a seed.
+    pub fn new(seed: u64) -> Self {
+        // the state must not be zero, and similar seeds must not give similar streams
+        let state = seed.wrapping_add(1).wrapping_mul(0x9e37_79b9_7f4a_7c15);
+        Self {
+            state: if state == 0 { 1 } else { state },
+        }
+    }
+
+    /// The next number.
+    pub fn next_u64(&mut self) -> u64 {
+        self.state ^= self.state << 13;
+        self.state ^= self.state >> 7;
+        self.state ^= self.state << 17;
+        self.state
+    }
+
+    /// A number in `0..bound`, which must not be empty.
+    pub fn below(&mut self, bound: usize) -> usize {
+        (self.next_u64() % bound as u64) as usize
+    }
+}
@@ -0,0 +1,139 @@
+use crate::{
+    chip::Chip,
+    components::{Pair, Point, Route},
+    solution::Solution,
+};
+use std::{
+    collections::{HashMap, HashSet},
+    fmt::Write,
+};
+
+/// Width and height of a grid in pixels.
+const GRID: usize = 20;
+
+/// Colors of the routes on every layer, reused when there are more layers.
+const PALETTE: [&str; 6] = [
+    "#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b",
+];
+
+/// Center of a grid in pixels.
+fn center(point: Point<usize>) -> (usize, usize) {
+    // rows grow upwards and columns grow rightwards
+    (point.col() * GRID + GRID / 2, point.row() * GRID + GRID / 2)
+}
+
+/// Draws one state of the chip.
+fn frame(
+    svg: &mut String,
+    dim: Pair<usize>,
+    positions: &[(Pair<usize>, bool)],
+    routes: &HashMap<usize, HashSet<Route<usize>>>,
+) {
+    let height = dim.x() * GRID;
+    let flip = |(x, y): (usize, usize)| (x, height - y);
+
+    for &(Pair(row, col), moved) in positions.iter() {
+        let (x, y) = flip(center(Point(row, col, 0)));
+        let fill = if moved { "#e377c2" } else { "#7f7f7f" };
+        let _ = writeln!(
+            svg,
+            r#"<rect x="{}" y="{}" width="{}" height="{}" fill="{}" opacity="0.5"/>"#,
+            x - GRID / 3,
+            y - GRID / 3,
+            2 * GRID / 3,
+            2 * GRID / 3,
+            fill
+        );
+    }
+
+    let mut nets: Vec<_> = routes.keys().collect();
+    nets.sort_unstable();
+    for route in nets.into_iter().flat_map(|net| routes[net].iter()) {
+        let color = PALETTE[route.source().lay() % PALETTE.len()];
+        let (x1, y1) = flip(center(route.source()));
+        let (x2, y2) = flip(center(route.target()));
+
+        if (x1, y1) == (x2, y2) {
+            let _ = writeln!(
+                svg,
+                r#"<circle cx="{}" cy="{}" r="{}" fill="{}"/>"#,
+                x1,
+                y1,
+                GRID / 6,
+                color
+            );
+        } else {
+            let _ = writeln!(
+                svg,
+                r#"<line x1="{}" y1="{}" x2="{}" y2="{}" stroke="{}" stroke-width="2"/>"#,
+                x1, y1, x2, y2, color
+            );
+        }
+    }
+}
+
+/// Stitches snapshots into an animated SVG of the solution evolving.
+/// The first frame is the chip as read, every snapshot then makes a frame.
+/// Snapshots only carry the nets that changed, the other nets keep their previous routes.
+pub fn animate(chip: &Chip, snapshots: &[Solution], seconds_per_frame: f64) -> String {
+    let Pair(rows, cols) = chip.dim;
+    let (width, height) = (cols * GRID, rows * GRID);
+
+    let initial: Vec<_> = chip.cells.iter().map(|cell| cell.position).collect();
+    let mut positions: Vec<_> = chip
+        .cells
+        .iter()
+        .map(|cell| (cell.position, cell.moved))
+        .collect();
+    let mut routes: HashMap<_, _> = chip
+        .nets
+        .iter()
+        .map(|net| (net.id, net.segments().into_owned()))
+        .collect();
+
+    let mut svg = String::new();
+    let _ = writeln!(
+        svg,
+        r#"<svg xmlns="http://www.w3.org/2000/svg" width="{0}" height="{1}" viewBox="0 0 {0} {1}">"#,
+        width, height
+    );
+    let _ = writeln!(
+        svg,
+        r##"<rect width="{}" height="{}" fill="#ffffff" stroke="#000000"/>"##,
+        width, height
+    );
+
+    for idx in 0..=snapshots.len() {
+        if idx > 0 {
+            let snapshot = &snapshots[idx - 1];
+            for (id, position) in positions.iter_mut().enumerate() {
+                *position = match snapshot.cells.get(&id) {
+                    Some(&moved) => (moved, true),
+                    None => (initial[id], false),
+                };
+            }
+            for (&net, net_routes) in snapshot.routes.iter() {
+                routes.insert(net, net_routes.clone());
+            }
+        }
+
+        let begin = idx as f64 * seconds_per_frame;
+        let fill = if idx == snapshots.len() {
+            r#" fill="freeze""#
+        } else {
+            ""
+        };
+
+        let _ = writeln!(svg, r#"<g visibility="hidden">"#);
+        let _ = writeln!(
+            svg,
+            r#"<set attributeName="visibility" to="visible" begin="{}s" dur="{}s"{}/>"#,
+            begin, seconds_per_frame, fill
+        );
+        frame(&mut svg, chip.dim, &positions, &routes);
+        let _ = writeln!(svg, "</g>");
+    }
+
+    let _ = writeln!(svg, "</svg>");
+    svg
+}
@@ -0,0 +1,177 @@
+use crate::components::{FactoryID, Net};
+use std::{
+    sync::{
+        atomic::{AtomicBool, AtomicUsize, Ordering},
+        Arc, Mutex,
+    },
+    thread::{self, JoinHandle},
+    time::{Duration, Instant},
+};
+
+/// Progress of a single search, shared between a router worker and the watchdog.
+#[derive(Debug, Default)]
+pub struct Progress {
+    /// the net being searched, `usize::MAX` if idle
+    net: AtomicUsize,
+    /// number of frontier pops of the current search
+    pops: AtomicUsize,
+    /// number of grids in the frontier at the last pop
+    frontier: AtomicUsize,
+    /// estimated cost of the whole path through the grid last popped,
+    /// the best cost the search can still reach, `usize::MAX` if none popped yet
+    best: AtomicUsize,
+    /// when the current search started
+    started: Mutex<Option<Instant>>,
+    /// set by the watchdog when the current search should give up
+    aborted: AtomicBool,
+}
+
+/// Watches the progress of all workers and aborts searches that are stuck.
+#[derive(Debug)]
+pub struct Watchdog {
+    /// tells the watching thread to stop
+    stop: Arc<AtomicBool>,
+    /// the watching thread
+    handle: Option<JoinHandle<()>>,
+}
+
+impl Progress {
+    /// Creates an idle progress.
+    pub fn new() -> Self {
+        Self {
+            net: AtomicUsize::new(usize::MAX),
+            best: AtomicUsize::new(usize::MAX),
+            ..Self::default()
+        }
+    }
+
+    /// Marks the beginning of a search on `net`.
+    pub fn start(&self, net: usize) {
+        self.pops.store(0, Ordering::Relaxed);
+        self.frontier.store(0, Ordering::Relaxed);
+        self.best.store(usize::MAX, Ordering::Relaxed);
+        *self.started.lock().expect("Progress poisoned") = Some(Instant::now());
+        self.aborted.store(false, Ordering::Relaxed);
+        self.net.store(net, Ordering::Relaxed);
+    }
+
+    /// Marks the end of the current search.
+    pub fn finish(&self) {
+        self.net.store(usize::MAX, Ordering::Relaxed);
+    }
+
+    /// Records a frontier pop, leaving `frontier` grids in the frontier,
+    /// of a grid whose whole path is estimated to cost `best`.
+    /// Returns false if the search has been aborted by the watchdog.
+    pub fn pop(&self, frontier: usize, best: usize) -> bool {
+        self.pops.fetch_add(1, Ordering::Relaxed);
+        self.frontier.store(frontier, Ordering::Relaxed);
+        self.best.store(best, Ordering::Relaxed);
+        !self.aborted()
+    }
+
+    /// Whether the current search has been aborted.
+    pub fn aborted(&self) -> bool {
+        self.aborted.load(Ordering::Relaxed)
+    }
+
+    /// The net being searched.
+    pub fn net(&self) -> Option<usize> {
+        match self.net.load(Ordering::Relaxed) {
+            usize::MAX => None,
+            net => Some(net),
+        }
+    }
+
+    /// Number of frontier pops of the current search.
+    pub fn pops(&self) -> usize {
+        self.pops.load(Ordering::Relaxed)
+    }
+
+    /// Number of grids in the frontier of the current search.
+    pub fn frontier(&self) -> usize {
+        self.frontier.load(Ordering::Relaxed)
+    }
+
+    /// Best cost the current search can still reach, `None` before its first pop.
+    pub fn best(&self) -> Option<usize> {
+        match self.best.load(Ordering::Relaxed) {
+            usize::MAX => None,
+            best => Some(best),
+        }
+    }
+
+    /// Time spent on the current search, `None` if idle.
+    pub fn elapsed(&self) -> Option<Duration> {
+        self.net()?;
+        self.started
+            .lock()
+            .expect("Progress poisoned")
+            .map(|started| started.elapsed())
+    }
+}
+
+impl Watchdog {
+    /// How often the watchdog looks at the workers.
+    const INTERVAL: Duration = Duration::from_millis(100);
+
+    /// Spawns a thread that aborts any search making no frontier pops for `timeout`.
+    pub fn spawn(workers: Vec<Arc<Progress>>, timeout: Duration) -> Self {
+        let stop = Arc::new(AtomicBool::new(false));
+        let stopped = Arc::clone(&stop);
+
+        let handle = thread::spawn(move || {
+            // (net, pops, since when) of every worker when last seen
+            let mut last: Vec<_> = workers
+                .iter()
+                .map(|w| (w.net(), w.pops(), Instant::now()))
+                .collect();
+
+            while !stopped.load(Ordering::Relaxed) {
+                thread::sleep(Self::INTERVAL);
+
+                for (worker, seen) in workers.iter().zip(last.iter_mut()) {
+                    let now = (worker.net(), worker.pops());
+
+                    if now != (seen.0, seen.1) {
+                        *seen = (now.0, now.1, Instant::now());
+                        continue;
+                    }
+
+                    let net = match now.0 {
+                        Some(net) if !worker.aborted() => net,
+                        _ => continue,
+                    };
+
+                    if seen.2.elapsed() >= timeout {
+                        eprintln!(
+                            "Watchdog: {} stuck after {} pops in {:.1}s, frontier of {} grids, best cost {}, aborting search.",
+                            Net::from_num(net).unwrap_or_default(),
+                            now.1,
+                            worker.elapsed().unwrap_or_default().as_secs_f64(),
+                            worker.frontier(),
+                            worker
+                                .best()
+                                .map_or_else(|| "unknown".to_string(), |best| best.to_string())
+                        );
+                        worker.aborted.store(true, Ordering::Relaxed);
+                    }
+                }
+            }
+        });
+
+        Self {
+            stop,
+            handle: Some(handle),
+        }
+    }
+}
+
+impl Drop for Watchdog {
+    fn drop(&mut self) {
+        self.stop.store(true, Ordering::Relaxed);
+        if let Some(handle) = self.handle.take() {
+            let _ = handle.join();
+        }
+    }
+}
@@ -0,0 +1,86 @@
+use crate::{
+    components::{FactoryID, Layer, Net, Point, Route},
+    flat::PointSet,
+    utilities,
+};
+use anyhow::Result;
+use std::{collections::HashSet, fs};
+
+/// Weights of the wirelength on every layer and of vias.
+/// By default every grid weighs 1 and vias weigh nothing,
+/// so that the weighted wirelength is the number of grids.
+#[derive(Clone, Debug, Default, PartialEq)]
+pub struct Weights {
+    /// weight of a grid on every layer, 1 if missing
+    pub layers: Vec<f64>,
+    /// weight of going up or down a layer
+    pub via: f64,
+}
+
+impl Weights {
+    /// Reads weights from a file.
+    pub fn read_file(filename: &str) -> Result<Self> {
+        let content: String = fs::read_to_string(filename)?;
+        Self::read_str(&content)
+    }
+
+    /// Reads weights from a string.
+    /// Every entry is either `<layerName> <weight>` or `Via <weight>`.
+    pub fn read_str(content: &str) -> Result<Self> {
+        use utilities::parse_numeric;
+
+        let content = &mut content.split_whitespace();
+        let mut weights = Self::default();
+
+        while let Some(name) = content.next() {
+            let weight: f64 = parse_numeric(content)?;
+
+            if name == "Via" {
+                weights.via = weight;
+                continue;
+            }
+
+            let id = Layer::from_str(name)?;
+            if weights.layers.len() <= id {
+                weights.layers.resize(id + 1, 1.);
+            }
+            weights.layers[id] = weight;
+        }
+
+        Ok(weights)
+    }
+
+    /// Weight of a grid on a layer.
+    pub fn layer(&self, id: usize) -> f64 {
+        self.layers.get(id).copied().unwrap_or(1.)
+    }
+
+    /// The weighted wirelength of a net.
+    pub fn length(&self, net: &Net) -> f64 {
+        self.length_of(&net.segments())
+    }
+
+    /// The weighted wirelength of routes.
+    /// Every grid the routes go through counts once, and so does every via.
+    pub fn length_of(&self, routes: &HashSet<Route<usize>>) -> f64 {
+        let points: PointSet = routes.iter().flat_map(Route::points).collect();
+
+        // a via is identified by the grid below it
+        let vias: PointSet = routes
+            .iter()
+            .filter(|route| route.source().flatten() == route.target().flatten())
+            .flat_map(|route| {
+                let Route(source, target) = *route;
+                let (low, high) = if source.lay() < target.lay() {
+                    (source, target)
+                } else {
+                    (target, source)
+                };
+                (low.lay()..high.lay()).map(move |lay| Point(low.row(), low.col(), lay))
+            })
+            .collect();
+
+        let grids: f64 = points.iter().map(|point| self.layer(point.lay())).sum();
+        grids + self.via * vias.len() as f64
+    }
+}
@@ -0,0 +1,129 @@
+//! Point maps and sets against the standard hash maps,
+//! as they grow past their capacity and probe past colliding points.
+
+use cell_move_router::{Point, PointMap, PointSet, Rng};
+use std::collections::HashMap;
+
+/// A random point of a grid of `rows` x `cols` x `lays`.
+fn random_point(rng: &mut Rng, rows: usize, cols: usize, lays: usize) -> Point<usize> {
+    Point(rng.below(rows), rng.below(cols), rng.below(lays))
+}
+
+#[test]
+fn agrees_with_hash_map() {
+    let mut rng = Rng::new(1008);
+    for _ in 0..100 {
+        let mut map = PointMap::new();
+        let mut expected = HashMap::new();
+
+        // few grids, so that points are often set again
+        for value in 0..rng.below(200) {
+            let point = random_point(&mut rng, 8, 8, 4);
+            assert_eq!(map.insert(point, value), expected.insert(point, value));
+            assert_eq!(map.len(), expected.len());
+        }
+
+        for row in 0..8 {
+            for col in 0..8 {
+                for lay in 0..4 {
+                    let point = Point(row, col, lay);
+                    assert_eq!(map.get(point), expected.get(&point));
+                }
+            }
+        }
+
+        let mut entries: Vec<_> = map.iter().map(|(point, &value)| (point, value)).collect();
+        let mut others: Vec<_> = expected.into_iter().collect();
+        entries.sort_unstable();
+        others.sort_unstable();
+        assert_eq!(entries, others);
+    }
+}
+
+#[test]
+fn grows_past_its_capacity() {
+    let mut map = PointMap::with_capacity(1);
+    let points: Vec<_> = (0..10_000)
+        .map(|idx| Point(idx / 100, idx % 100, idx % 3))
+        .collect();
+
+    for (value, &point) in points.iter().enumerate() {
+        assert_eq!(map.insert(point, value), None);
+        assert_eq!(map.len(), value + 1);
+    }
+    for (value, &point) in points.iter().enumerate() {
+        assert_eq!(map.get(point), Some(&value));
+    }
+    assert_eq!(map.get(Point(100, 0, 0)), None);
+    assert_eq!(map.iter().count(), points.len());
+}
+
+#[test]
+fn probes_past_colliding_points() {
+    // more points than slots of the smallest table are bound to collide before it grows,
+    // and points differing by their highest bits only must not be mixed up
+    let far = (1 << 24) - 1;
+    let points = [
+        Point(0, 0, 0),
+        Point(far, 0, 0),
+        Point(0, far, 0),
+        Point(0, 0, (1 << 16) - 1),
+        Point(far, far, 0),
+        Point(far, far, (1 << 16) - 1),
+        Point(1, 0, 0),
+        Point(0, 1, 0),
+        Point(0, 0, 1),
+    ];
+
+    let mut map = PointMap::new();
+    for (value, &point) in points.iter().enumerate() {
+        *map.get_or_insert_with(point, || 0) += value;
+    }
+    for (value, &point) in points.iter().enumerate() {
+        assert_eq!(map.get(point), Some(&value));
+        *map.get_mut(point).unwrap() += 1;
+        assert_eq!(map.get(point), Some(&(value + 1)));
+    }
+    assert_eq!(map.len(), points.len());
+
+    let mut found: Vec<_> = map.iter().map(|(point, _)| point).collect();
+    let mut expected = points.to_vec();
+    found.sort_unstable();
+    expected.sort_unstable();
+    assert_eq!(found, expected);
+}
+
+#[test]
+fn sets_keep_points_once() {
+    let mut rng = Rng::new(1008);
+    let points: Vec<_> = (0..1000)
+        .map(|_| random_point(&mut rng, 10, 10, 3))
+        .collect();
+
+    let set: PointSet = points.iter().copied().collect();
+    let mut unique = points.clone();
+    unique.sort_unstable();
+    unique.dedup();
+
+    assert_eq!(set.len(), unique.len());
+    assert!(unique.iter().all(|&point| set.contains(point)));
+    assert!(!set.contains(Point(10, 0, 0)));
+
+    let mut set = set;
+    assert!(!set.insert(unique[0]));
+    assert!(set.insert(Point(10, 10, 3)));
+}
+
+#[test]
+fn reserves_without_losing_points() {
+    let mut map = PointMap::new();
+    for idx in 0..50 {
+        map.insert(Point(idx, idx, 0), idx);
+    }
+
+    map.reserve(1000);
+    assert_eq!(map.len(), 50);
+    for idx in 0..50 {
+        assert_eq!(map.get(Point(idx, idx, 0)), Some(&idx));
+    }
+}
@@ -0,0 +1,129 @@
+//! Neighbors of grids at the edges and corners of the grid,
+//! and the extra demand of `adjHGGrid` rules there.
+
+use cell_move_router::{Chip, Pair, Point};
+
+/// A design of one row of `cols` grids, with a cell of MC1 and a cell of MC2
+/// at the 1-based columns `first` and `second`, and an `adjHGGrid` rule between them.
+fn row_of(cols: usize, first: usize, second: usize) -> Chip {
+    let content = format!(
+        "MaxCellMove 2
+GGridBoundaryIdx 1 1 1 {cols}
+NumLayer 1
+Lay M1 1 H 10
+NumNonDefaultSupplyGGrid 0
+NumMasterCell 2
+MasterCell MC1 1 0
+Pin P1 M1
+MasterCell MC2 1 0
+Pin P1 M1
+NumNeighborCellExtraDemand 1
+adjHGGrid MC1 MC2 M1 3
+NumCellInst 2
+CellInst C1 MC1 1 {first} Movable
+CellInst C2 MC2 1 {second} Movable
+NumNets 0
+NumRoutes 0
+",
+        cols = cols,
+        first = first,
+        second = second
+    );
+
+    let mut chip = Chip::default();
+    chip.read_str(&content).expect("Cannot read the design");
+    chip
+}
+
+/// Demand of every grid of the only layer.
+fn demand(chip: &Chip) -> Vec<usize> {
+    (0..chip.dim.y())
+        .map(|col| chip.demand[chip.grid_index(Point(0, col, 0))])
+        .collect()
+}
+
+#[test]
+fn corners_have_two_neighbors() {
+    let dim = Pair(3, 4);
+
+    assert_eq!(Pair(0, 0).horizontal_neighbors(dim), vec![Pair(0, 1)]);
+    assert_eq!(Pair(0, 0).vertical_neighbors(dim), vec![Pair(1, 0)]);
+    assert_eq!(Pair(2, 3).horizontal_neighbors(dim), vec![Pair(2, 2)]);
+    assert_eq!(Pair(2, 3).vertical_neighbors(dim), vec![Pair(1, 3)]);
+    assert_eq!(Pair(0, 3).horizontal_neighbors(dim), vec![Pair(0, 2)]);
+    assert_eq!(Pair(2, 0).vertical_neighbors(dim), vec![Pair(1, 0)]);
+}
+
+#[test]
+fn edges_have_three_neighbors() {
+    let dim = Pair(3, 4);
+
+    assert_eq!(
+        Pair(0, 1).horizontal_neighbors(dim),
+        vec![Pair(0, 0), Pair(0, 2)]
+    );
+    assert_eq!(Pair(0, 1).vertical_neighbors(dim), vec![Pair(1, 1)]);
+    assert_eq!(Pair(1, 0).horizontal_neighbors(dim), vec![Pair(1, 1)]);
+    assert_eq!(
+        Pair(1, 0).vertical_neighbors(dim),
+        vec![Pair(0, 0), Pair(2, 0)]
+    );
+}
+
+#[test]
+fn single_grid_has_no_neighbors() {
+    let dim = Pair(1, 1);
+
+    assert!(Pair(0, 0).horizontal_neighbors(dim).is_empty());
+    assert!(Pair(0, 0).vertical_neighbors(dim).is_empty());
+}
+
+#[test]
+fn offsets_off_the_grid() {
+    let dim = Pair(3, 4);
+
+    assert_eq!(Pair(0, 0).offset(-1, 0, dim), None);
+    assert_eq!(Pair(0, 0).offset(0, -1, dim), None);
+    assert_eq!(Pair(2, 3).offset(1, 0, dim), None);
+    assert_eq!(Pair(2, 3).offset(0, 1, dim), None);
+    assert_eq!(Pair(0, 0).offset(isize::MAX, 0, dim), None);
+    assert_eq!(Pair(2, 3).offset(-2, -3, dim), Some(Pair(0, 0)));
+}
+
+#[test]
+fn adjacent_cells_at_both_edges() {
+    // both cells of the pair get the extra demand
+    let chip = row_of(2, 1, 2);
+    assert_eq!(demand(&chip), vec![3, 3]);
+    chip.audit_demand().expect("Demand differs");
+
+    let chip = row_of(3, 2, 3);
+    assert_eq!(demand(&chip), vec![0, 3, 3]);
+}
+
+#[test]
+fn far_apart_cells_at_both_edges() {
+    let chip = row_of(3, 1, 3);
+    assert_eq!(demand(&chip), vec![0, 0, 0]);
+}
+
+#[test]
+fn single_column() {
+    // on the same grid, both cells of the pair still get the extra demand
+    let chip = row_of(1, 1, 1);
+    assert_eq!(demand(&chip), vec![6]);
+    chip.audit_demand().expect("Demand differs");
+}
+
+#[test]
+fn moves_along_the_edges() {
+    let mut chip = row_of(3, 1, 3);
+
+    chip.move_cell(1, Pair(0, 1));
+    assert_eq!(demand(&chip), vec![3, 3, 0]);
+    chip.audit_demand().expect("Demand differs");
+
+    chip.move_cell(0, Pair(0, 2));
+    assert_eq!(demand(&chip), vec![0, 3, 3]);
+    chip.audit_demand().expect("Demand differs");
+}
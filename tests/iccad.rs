@@ -0,0 +1,164 @@
+//! End to end test on the public ICCAD cases, skipped unless `ICCAD_CASES`
+//! names a directory holding them (as `*.txt` input files):
+//!
+//! ```sh
+//! ICCAD_CASES=path/to/cases cargo test --release --test iccad -- --nocapture
+//! ```
+//!
+//! Every case goes through the whole flow, moving cells and rerouting nets with a small
+//! time budget, and its output must be legal and no longer than the initial routing.
+//! The small case below always runs, with and without --single, and must get shorter.
+
+use cell_move_router::{score_file, Args, Chip, Score};
+use std::{env, fs, path::PathBuf};
+
+/// Time budget of every case, in seconds.
+const SECS: usize = 10;
+
+/// A small case, where moving C1 shortens N1 and N3.
+const SAMPLE: &str = "MaxCellMove 1
+GGridBoundaryIdx 1 1 5 5
+NumLayer 3
+Lay M1 1 H 10
+Lay M2 2 V 8
+Lay M3 3 H 8
+NumNonDefaultSupplyGGrid 2
+2 2 1 3
+3 3 2 -2
+NumMasterCell 2
+MasterCell MC1 3 1
+Pin P1 M1
+Pin P2 M1
+Pin P3 M1
+Blkg B1 M1 2
+MasterCell MC2 2 0
+Pin P1 M1
+Pin P2 M2
+NumNeighborCellExtraDemand 2
+sameGGrid MC1 MC1 M1 1
+adjHGGrid MC1 MC2 M1 2
+NumCellInst 4
+CellInst C1 MC1 2 1 Movable
+CellInst C2 MC2 2 4 Movable
+CellInst C3 MC1 4 4 Fixed
+CellInst C4 MC2 4 1 Movable
+NumNets 3
+Net N1 2 NoCstr
+Pin C1/P1
+Pin C2/P1
+Net N2 2 M2
+Pin C3/P2
+Pin C4/P2
+Net N3 2 NoCstr
+Pin C1/P3
+Pin C4/P1
+NumRoutes 8
+2 1 1 2 4 1 N1
+4 4 1 4 4 3 N2
+4 1 3 4 4 3 N2
+4 1 2 4 1 3 N2
+2 1 1 2 1 2 N3
+2 1 2 4 1 2 N3
+4 1 2 4 1 1 N3
+4 1 1 4 1 1 N3
+";
+
+/// Input files of the cases, sorted.
+fn cases(dir: &str) -> Vec<PathBuf> {
+    let mut cases: Vec<_> = fs::read_dir(dir)
+        .expect("Cannot read ICCAD_CASES")
+        .map(|entry| entry.expect("Cannot read ICCAD_CASES").path())
+        .filter(|path| path.extension().map_or(false, |ext| ext == "txt"))
+        .collect();
+    cases.sort();
+    cases
+}
+
+/// Runs the whole flow on the case in `infile`, on a single thread if `single`,
+/// moving cells and rerouting nets as neither is singled out,
+/// then scores its output against the input as read.
+/// Returns the score and the initial wirelength.
+fn run_case(infile: &str, name: &str, single: bool) -> (Score, f64) {
+    let outfile = env::temp_dir()
+        .join(format!("{}.out.txt", name))
+        .to_string_lossy()
+        .to_string();
+
+    let args = Args {
+        infile: infile.to_string(),
+        outfile: outfile.clone(),
+        sec: Some(SECS),
+        single,
+        ..Args::default()
+    };
+
+    let mut chip = Chip::default();
+    chip.read_file(infile).expect("Cannot read the case");
+    chip.run(&args).expect("Cannot run the case");
+    chip.write_file(&outfile).expect("Cannot write the output");
+
+    // the output is checked against the input as read, untouched by the flow
+    let mut input = Chip::default();
+    input.read_file(infile).expect("Cannot read the case");
+    let score = score_file(&input, &outfile).expect("Cannot read the output");
+    eprintln!("{}: {}", name, score);
+    (score, input.baseline)
+}
+
+/// Runs the flow on the small case, which must get shorter.
+fn check_sample(single: bool) {
+    let name = if single { "sample" } else { "sample-threaded" };
+    let infile = env::temp_dir().join(format!("{}.txt", name));
+    fs::write(&infile, SAMPLE).expect("Cannot write the sample case");
+
+    let (score, baseline) = run_case(&infile.to_string_lossy(), name, single);
+    assert!(score.is_legal(), "illegal output\n{}", score);
+    assert!(score.moved <= 1, "{} cells moved, 1 at most", score.moved);
+    assert!(
+        score.wirelength < baseline,
+        "wirelength {} is not shorter than the initial {}",
+        score.wirelength,
+        baseline
+    );
+}
+
+#[test]
+fn sample_case() {
+    check_sample(true);
+}
+
+#[test]
+fn sample_case_threaded() {
+    check_sample(false);
+}
+
+#[test]
+fn public_cases() {
+    let dir = match env::var("ICCAD_CASES") {
+        Ok(dir) => dir,
+        Err(_) => {
+            eprintln!("ICCAD_CASES is not set, skipping the public cases.");
+            return;
+        }
+    };
+
+    let cases = cases(&dir);
+    assert!(!cases.is_empty(), "No case in {}", dir);
+
+    for case in cases {
+        let name = case
+            .file_stem()
+            .expect("Case without name")
+            .to_string_lossy();
+        let (score, baseline) = run_case(&case.to_string_lossy(), &name, true);
+
+        assert!(score.is_legal(), "{}: illegal output\n{}", name, score);
+        assert!(
+            score.wirelength <= baseline + 1e-6,
+            "{}: wirelength {} is worse than the initial {}",
+            name,
+            score.wirelength,
+            baseline
+        );
+    }
+}
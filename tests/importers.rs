@@ -0,0 +1,198 @@
+//! Reading designs of other formats, translated into inputs, on small fixtures.
+
+use cell_move_router::{CellType, Chip, Pair};
+use std::{env, fs};
+
+/// Writes `content` to a temporary file named `name`, returning its path.
+fn temp_file(name: &str, content: &str) -> String {
+    let path = env::temp_dir().join(name);
+    fs::write(&path, content).expect("Cannot write the temporary file");
+    path.to_string_lossy().to_string()
+}
+
+/// Two routing layers, a cut layer between them, and a macro with a pin on each routing layer.
+const LEF: &str = "UNITS
+  DATABASE MICRONS 1000 ;
+END UNITS
+LAYER metal1
+  TYPE ROUTING ;
+  DIRECTION HORIZONTAL ;
+  PITCH 0.2 ;
+END metal1
+LAYER via1
+  TYPE CUT ;
+END via1
+LAYER metal2
+  TYPE ROUTING ;
+  DIRECTION VERTICAL ;
+  PITCH 0.25 ;
+END metal2
+MACRO INV
+  PIN A
+    DIRECTION INPUT ;
+    PORT
+      LAYER metal1 ;
+        RECT 0 0 0.1 0.1 ;
+    END
+  END A
+  PIN Y
+    PORT
+      LAYER metal2 ;
+        RECT 0 0 0.1 0.1 ;
+    END
+  END Y
+  OBS
+    LAYER metal1 ;
+      RECT 0 0 1 1 ;
+  END
+END INV
+END LIBRARY
+";
+
+/// 3 x 3 GCells of 1 micron, a placed and a fixed component joined by a net.
+const DEF: &str = "VERSION 5.8 ;
+DESIGN top ;
+UNITS DISTANCE MICRONS 1000 ;
+DIEAREA ( 0 0 ) ( 3000 3000 ) ;
+GCELLGRID X 0 DO 4 STEP 1000 ;
+GCELLGRID Y 0 DO 4 STEP 1000 ;
+COMPONENTS 2 ;
+- u1 INV + PLACED ( 500 500 ) N ;
+- u2 INV + FIXED ( 2500 1500 ) N ;
+END COMPONENTS
+NETS 1 ;
+- n1 ( u1 Y ) ( u2 A ) ;
+END NETS
+END DESIGN
+";
+
+#[test]
+fn lef_def_designs_are_read() {
+    let lef = temp_file("importers.lef", LEF);
+    let def = temp_file("importers.def", DEF);
+    let mut chip = Chip::default();
+    let (report, names) = chip.read_lef_def(&lef, &def).expect("Cannot read LEF/DEF");
+
+    assert!(report.warnings.is_empty(), "{:?}", report.warnings);
+    assert_eq!(chip.dim, Pair(3, 3));
+    assert_eq!(names.layers, vec!["metal1", "metal2"]);
+    assert_eq!(names.cells, vec!["u1", "u2"]);
+    assert_eq!(names.nets, vec!["n1"]);
+
+    // tracks across a GCell
+    assert_eq!(chip.layers[0].get_capacity(0, 0), Some(&5));
+    assert_eq!(chip.layers[1].get_capacity(0, 0), Some(&4));
+
+    assert_eq!(chip.cells[0].position, Pair(0, 0));
+    assert_eq!(chip.cells[0].movable, CellType::Movable);
+    assert_eq!(chip.cells[1].position, Pair(1, 2));
+    assert_eq!(chip.cells[1].movable, CellType::Fixed);
+    assert_eq!(chip.nets[0].pins, vec![(0, 1), (1, 0)]);
+    assert!(chip.nets[0].segments().is_empty());
+}
+
+/// 2 rows and 3 columns of 10 x 10 tiles on a horizontal and a vertical layer,
+/// a net across them and an edge of the first row reduced.
+const ISPD: &str = "grid 3 2 2
+vertical capacity 0 20
+horizontal capacity 20 0
+minimum width 1 1
+minimum spacing 1 1
+via spacing 1 1
+0 0 10 10
+num net 1
+n1 0 2 1
+5 5 1
+25 15 2
+1
+0 0 1 1 0 1 4
+";
+
+#[test]
+fn ispd_benchmarks_are_read() {
+    let infile = temp_file("importers.gr", ISPD);
+    let mut chip = Chip::default();
+    let (report, names) = chip.read_ispd(&infile).expect("Cannot read the benchmark");
+
+    assert!(report.warnings.is_empty(), "{:?}", report.warnings);
+    assert_eq!(chip.dim, Pair(2, 3));
+    assert_eq!(names, vec!["n1"]);
+
+    // 20 over a pitch of 2, and 4 over 2 on both grids of the reduced edge
+    assert_eq!(chip.layers[0].get_capacity(0, 0), Some(&2));
+    assert_eq!(chip.layers[0].get_capacity(0, 1), Some(&2));
+    assert_eq!(chip.layers[0].get_capacity(0, 2), Some(&10));
+    assert_eq!(chip.layers[1].get_capacity(0, 0), Some(&10));
+
+    // every pin is a fixed cell of its own
+    let positions: Vec<_> = chip.cells.iter().map(|cell| cell.position).collect();
+    assert_eq!(positions, vec![Pair(0, 0), Pair(1, 2)]);
+    assert!(chip
+        .cells
+        .iter()
+        .all(|cell| cell.movable == CellType::Fixed));
+    assert_eq!(chip.nets[0].pins.len(), 2);
+}
+
+/// Two cells of one placement row and a terminal, spread over 3 x 3 GCells of 4 rows.
+const NODES: &str = "UCLA nodes 1.0
+# nodes of the design
+NumNodes : 3
+NumTerminals : 1
+a 2 1
+b 2 1
+p 1 1 terminal
+";
+
+/// Nets joining `a` to `b`, and `b` to the terminal.
+const NETS: &str = "UCLA nets 1.0
+NumNets : 2
+NumPins : 4
+NetDegree : 2 n1
+a O
+b I
+NetDegree : 2 n2
+b O
+p I
+";
+
+/// Placement of the nodes, by their lower left corners.
+const PL: &str = "UCLA pl 1.0
+a 0 0 : N
+b 8 4 : N
+p 0 8 : N /FIXED
+";
+
+#[test]
+fn bookshelf_placements_are_read() {
+    temp_file("importers.nodes", NODES);
+    temp_file("importers.nets", NETS);
+    temp_file("importers.pl", PL);
+    let aux = temp_file(
+        "importers.aux",
+        "RowBasedPlacement : importers.nodes importers.nets importers.wts importers.pl importers.scl\n",
+    );
+    let mut chip = Chip::default();
+    let (report, names) = chip
+        .read_bookshelf(&aux)
+        .expect("Cannot read the placement");
+
+    assert!(report.warnings.is_empty(), "{:?}", report.warnings);
+    assert_eq!(chip.dim, Pair(3, 3));
+    assert_eq!(names.cells, vec!["a", "b", "p"]);
+    assert_eq!(names.nets, vec!["n1", "n2"]);
+
+    // on the GCells of their centers
+    let positions: Vec<_> = chip.cells.iter().map(|cell| cell.position).collect();
+    assert_eq!(positions, vec![Pair(0, 0), Pair(1, 2), Pair(2, 0)]);
+    let movable: Vec<_> = chip.cells.iter().map(|cell| cell.movable).collect();
+    assert_eq!(
+        movable,
+        vec![CellType::Movable, CellType::Movable, CellType::Fixed]
+    );
+    assert_eq!(chip.max_move, 2);
+
+    // a pin of every cell per net it is on
+    assert_eq!(chip.nets[0].pins, vec![(0, 0), (1, 0)]);
+    assert_eq!(chip.nets[1].pins, vec![(1, 1), (2, 0)]);
+}
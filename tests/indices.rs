@@ -0,0 +1,58 @@
+//! Conversions between the 1-based indices of files and the 0-based indices in memory,
+//! over random values and the boundaries.
+
+use cell_move_router::{to_external, to_internal, Point, Rng, Route};
+
+/// Random indices, with the boundaries first.
+fn indices(count: usize) -> Vec<usize> {
+    let mut rng = Rng::new(982);
+    let mut indices = vec![0, 1, 2, usize::MAX - 1, usize::MAX];
+    indices.extend((0..count).map(|_| rng.next_u64() as usize));
+    indices
+}
+
+#[test]
+fn internal_then_external() {
+    for idx in indices(1000) {
+        match to_internal(idx) {
+            Ok(internal) => assert_eq!(to_external(internal), idx),
+            Err(_) => assert_eq!(idx, 0),
+        }
+    }
+}
+
+#[test]
+fn external_then_internal() {
+    for idx in indices(1000) {
+        // the largest index in memory has no index in files
+        if idx == usize::MAX {
+            continue;
+        }
+        assert_eq!(to_internal(to_external(idx)).unwrap(), idx);
+    }
+}
+
+#[test]
+fn index_zero_is_rejected() {
+    assert!(to_internal(0).is_err());
+    assert!(Point(1, 0, 1).internal().is_err());
+    assert!(Route(Point(1, 1, 1), Point(1, 1, 0)).internal().is_err());
+}
+
+#[test]
+fn points_and_routes() {
+    let indices = indices(100);
+    for triple in indices.windows(3) {
+        let point = Point(triple[0], triple[1], triple[2]);
+        match point.internal() {
+            Ok(internal) => assert_eq!(internal.external(), point),
+            Err(_) => assert!(triple.contains(&0)),
+        }
+
+        let route = Route(point, Point(triple[2], triple[0], triple[1]));
+        match route.internal() {
+            Ok(internal) => assert_eq!(internal.external(), route),
+            Err(_) => assert!(triple.contains(&0)),
+        }
+    }
+}
@@ -0,0 +1,294 @@
+//! Reading small inputs, and what is reported about them.
+
+use cell_move_router::{
+    check_routes, score_file, Chip, Design, Pair, Point, Route, RouteViolation, Solution,
+};
+use std::{env, fs};
+
+/// An input where C1 and C2 are joined by N1, and C2 and the fixed C3 by N2.
+const INPUT: &str = "MaxCellMove 2
+GGridBoundaryIdx 1 1 3 3
+NumLayer 2
+Lay M1 1 H 10
+Lay M2 2 V 10
+NumNonDefaultSupplyGGrid 0
+NumMasterCell 1
+MasterCell MC1 1 0
+Pin P1 M1
+NumNeighborCellExtraDemand 0
+NumCellInst 3
+CellInst C1 MC1 1 1 Movable
+CellInst C2 MC1 1 3 Movable
+CellInst C3 MC1 3 3 Fixed
+NumNets 2
+Net N1 2 NoCstr
+Pin C1/P1
+Pin C2/P1
+Net N2 2 NoCstr
+Pin C2/P1
+Pin C3/P1
+NumRoutes 4
+1 1 1 1 3 1 N1
+1 3 1 1 3 2 N2
+1 3 2 3 3 2 N2
+3 3 2 3 3 1 N2
+";
+
+/// A voltage area to add to `INPUT`, where C1 must stay in the first row.
+const AREAS: &str = "NumVoltageAreas 1
+Name V1
+GGrids 3
+1 1
+1 2
+1 3
+Instances 1
+C1
+";
+
+/// Writes `content` to a temporary file named `name`, returning its path.
+fn temp_file(name: &str, content: &str) -> String {
+    let path = env::temp_dir().join(name);
+    fs::write(&path, content).expect("Cannot write the temporary file");
+    path.to_string_lossy().to_string()
+}
+
+#[test]
+fn unknown_cell_types_name_both() {
+    let mut chip = Chip::default();
+    let err = chip
+        .read_str(&INPUT.replace("3 3 Fixed", "3 3 Pinned"))
+        .unwrap_err()
+        .to_string();
+    assert!(err.contains("CellInst #3"), "{}", err);
+    assert!(err.contains("\"Movable\" or \"Fixed\""), "{}", err);
+}
+
+#[test]
+fn outputs_are_scored_without_the_input_routes() {
+    let infile = temp_file("inputs-score.txt", INPUT);
+    let mut routed = Chip::default();
+    routed.read_file(&infile).expect("Cannot read the input");
+
+    let mut chip = Chip::default();
+    chip.read_unrouted(&infile).expect("Cannot read the design");
+    assert!(chip.nets.iter().all(|net| net.segments().is_empty()));
+
+    // the initial routes, without moving any cell
+    let outfile = temp_file(
+        "inputs-score.out.txt",
+        "NumMovedCellInst 0
+NumRoutes 4
+1 1 1 1 3 1 N1
+1 3 1 1 3 2 N2
+1 3 2 3 3 2 N2
+3 3 2 3 3 1 N2
+",
+    );
+    let score = score_file(&chip, &outfile).expect("Cannot score the output");
+    assert!(score.is_legal(), "{}", score);
+    assert_eq!(score.moved, 0);
+    assert_eq!(score.overflow, 0);
+    assert_eq!(score.wirelength, routed.baseline);
+
+    // the fixed C3 cannot move, and N2 is no longer connected once it does
+    let outfile = temp_file(
+        "inputs-score-fixed.out.txt",
+        "NumMovedCellInst 1
+CellInst C3 2 3
+NumRoutes 1
+1 1 1 1 3 1 N1
+",
+    );
+    let score = score_file(&chip, &outfile).expect("Cannot score the output");
+    assert_eq!(score.moved, 1);
+    assert!(score.violations.contains(&"C3 is fixed".to_string()));
+    assert!(score
+        .violations
+        .contains(&"N2 is not connected".to_string()));
+}
+
+#[test]
+fn solutions_cannot_move_fixed_cells_or_leave_voltage_areas() {
+    let content = format!("{}{}", INPUT, AREAS);
+    let mut chip = Chip::default();
+    chip.read_str(&content).expect("Cannot read the input");
+
+    let fixed = Solution::read_str("NumMovedCellInst 1\nCellInst C3 2 3\nNumRoutes 0\n")
+        .expect("Cannot read the output");
+    let err = fixed.check(&chip).unwrap_err().to_string();
+    assert!(err.contains("C3 is fixed"), "{}", err);
+    assert!(chip.apply(&fixed).is_err());
+    assert_eq!(chip.cells[2].position, Pair(2, 2));
+
+    let outside = Solution::read_str("NumMovedCellInst 1\nCellInst C1 2 1\nNumRoutes 0\n")
+        .expect("Cannot read the output");
+    let err = outside.check(&chip).unwrap_err().to_string();
+    assert!(err.contains("voltage area"), "{}", err);
+    assert!(chip.apply(&outside).is_err());
+    assert_eq!(chip.cells[0].position, Pair(0, 0));
+
+    let inside = Solution::read_str("NumMovedCellInst 1\nCellInst C1 1 2\nNumRoutes 0\n")
+        .expect("Cannot read the output");
+    chip.apply(&inside).expect("Cannot apply the output");
+    assert_eq!(chip.cells[0].position, Pair(0, 1));
+}
+
+#[test]
+fn duplicate_pins_and_routes_are_reported_once_each() {
+    let content = INPUT
+        .replace(
+            "Net N1 2 NoCstr\nPin C1/P1\n",
+            "Net N1 3 NoCstr\nPin C1/P1\nPin C1/P1\n",
+        )
+        .replace(
+            "NumRoutes 4\n1 1 1 1 3 1 N1\n",
+            "NumRoutes 5\n1 1 1 1 3 1 N1\n1 3 1 1 1 1 N1\n",
+        );
+    let mut chip = Chip::default();
+    let report = chip.read_str(&content).expect("Cannot read the input");
+
+    assert_eq!(chip.nets[0].pins.len(), 2);
+    assert_eq!(chip.nets[0].segments().len(), 1);
+    assert!(report
+        .warnings
+        .contains(&"Ignored 1 duplicate pins of nets".to_string()));
+    assert!(report
+        .warnings
+        .contains(&"Ignored 1 duplicate routes".to_string()));
+}
+
+#[test]
+fn diagonal_routes_are_split() {
+    // N1 goes along M1 and up to M2 at once
+    let content = INPUT.replace("1 1 1 1 3 1 N1", "1 1 1 1 3 2 N1");
+    let mut chip = Chip::default();
+    let report = chip.read_str(&content).expect("Cannot read the input");
+
+    assert!(report
+        .warnings
+        .contains(&"Split 1 diagonal routes".to_string()));
+    let segments = chip.nets[0].segments();
+    assert!(segments.iter().all(|route| route.validate().is_ok()));
+    assert!(chip.connects(0, &segments), "{:?}", segments);
+}
+
+#[test]
+fn designs_are_read_back_from_json() {
+    let mut chip = Chip::default();
+    chip.read_str(&format!("{}{}", INPUT, AREAS))
+        .expect("Cannot read the input");
+    let design = Design::from_chip(&chip);
+
+    let json = env::temp_dir().join("inputs-design.json");
+    let json = json.to_string_lossy();
+    chip.write_json(&json).expect("Cannot write the design");
+    let mut reread = Chip::default();
+    let report = reread.read_json(&json).expect("Cannot read the design");
+    assert_eq!(report.num_cells, 3);
+    assert_eq!(report.num_routes, 4);
+    assert_eq!(Design::from_chip(&reread), design);
+
+    // a design edited in memory is read as well
+    let mut moved = design.clone();
+    moved.cells[0].position = (0, 1);
+    let mut rebuilt = Chip::default();
+    rebuilt.read_design(&moved).expect("Cannot read the design");
+    assert_eq!(rebuilt.cells[0].position, Pair(0, 1));
+    assert_eq!(rebuilt.voltage_areas.len(), 1);
+    assert_eq!(Design::from_chip(&rebuilt).nets, design.nets);
+}
+
+#[test]
+fn malformed_lines_are_reported_when_lenient() {
+    // a lowercase direction, and a route out of the grids
+    let content = INPUT
+        .replace("Lay M2 2 V 10", "Lay M2 2 v 10")
+        .replace("NumRoutes 4\n", "NumRoutes 5\n4 1 1 4 3 1 N1\n");
+
+    let mut strict = Chip::default();
+    let err = strict.read_str(&content).unwrap_err().to_string();
+    assert!(err.contains("lowercase"), "{}", err);
+
+    let mut chip = Chip::default();
+    chip.lenient = Some(10);
+    let report = chip.read_str(&content).expect("Cannot read the input");
+    assert_eq!(report.warnings.len(), 2, "{:?}", report.warnings);
+    assert!(
+        report.warnings[0].contains("Lay #2"),
+        "{:?}",
+        report.warnings
+    );
+    assert!(
+        report.warnings[1].contains("route #1"),
+        "{:?}",
+        report.warnings
+    );
+    assert_eq!(chip.nets[0].segments().len(), 1);
+
+    // but no more warnings than tolerated
+    let mut chip = Chip::default();
+    chip.lenient = Some(1);
+    let err = chip.read_str(&content).unwrap_err().to_string();
+    assert!(err.contains("More than 1 warnings"), "{}", err);
+}
+
+#[test]
+fn inputs_are_read_back_the_same() {
+    // with a grid of its own supply, a blockage and an extra demand rule
+    let content = format!("{}{}", INPUT, AREAS)
+        .replace(
+            "NumNonDefaultSupplyGGrid 0\n",
+            "NumNonDefaultSupplyGGrid 1\n2 2 1 -3\n",
+        )
+        .replace(
+            "MasterCell MC1 1 0\nPin P1 M1\n",
+            "MasterCell MC1 1 1\nPin P1 M1\nBlkg B1 M2 2\n",
+        )
+        .replace(
+            "NumNeighborCellExtraDemand 0\n",
+            "NumNeighborCellExtraDemand 1\nsameGGrid MC1 MC1 M1 1\n",
+        );
+    let mut chip = Chip::default();
+    chip.read_str(&content).expect("Cannot read the input");
+    chip.check_round_trip().expect("Not read back the same");
+
+    let design = Design::from_chip(&chip);
+    assert_eq!(design.non_default_supply, vec![(1, 1, 0, -3)]);
+    assert_eq!(design.extra_demand.len(), 1);
+    let mut reread = Chip::default();
+    reread
+        .read_str(&design.to_input().expect("Cannot write the input"))
+        .expect("Cannot read the input back");
+    assert_eq!(Design::from_chip(&reread), design);
+}
+
+#[test]
+fn illegal_routes_are_found_per_net() {
+    // N1 goes along M2 against its direction, and N2 along M1 below its min layer
+    let content = INPUT.replace("Net N2 2 NoCstr", "Net N2 2 M2").replace(
+        "NumRoutes 4\n1 1 1 1 3 1 N1\n",
+        "NumRoutes 5\n1 1 2 1 3 2 N1\n3 1 1 3 3 1 N2\n",
+    );
+    let mut chip = Chip::default();
+    chip.read_str(&content).expect("Cannot read the input");
+
+    assert_eq!(
+        check_routes(&chip),
+        vec![
+            (
+                0,
+                vec![RouteViolation::AgainstDirection {
+                    route: Route(Point(0, 0, 1), Point(0, 2, 1)),
+                    layer: 1,
+                }]
+            ),
+            (
+                1,
+                vec![RouteViolation::BelowMinLayer {
+                    route: Route(Point(2, 0, 0), Point(2, 2, 0)),
+                    min_layer: 1,
+                }]
+            ),
+        ]
+    );
+}
@@ -0,0 +1,327 @@
+//! Path search on small random grids, cross-validated against an exact but slow router.
+
+use cell_move_router::{
+    astar_route, maze_route, pattern_route, reroute, route_two_pins, route_violation, Chip,
+    Escalation, Manhattan, Moves, Outcome, Point, Progress, Provenance, Rng, Route, Search,
+    Weights, WrongWay,
+};
+use std::collections::{HashSet, VecDeque};
+
+/// An exact but slow router, only meant to cross-validate faster routers on small grids.
+/// Finds by breadth first search the least number of grids a path from `source` to `target`
+/// goes through, going along layer directions and staying at or above `min_layer` except for vias.
+/// Grids without free capacity are avoided except at both ends.
+/// Returns `None` if there is no such path.
+fn shortest_length(
+    chip: &Chip,
+    source: Point<usize>,
+    target: Point<usize>,
+    min_layer: usize,
+) -> Option<usize> {
+    let free = |point: Point<usize>| {
+        let supply = *chip.layers[point.lay()]
+            .get_capacity(point.row(), point.col())
+            .expect("Cell index out of bounds");
+        chip.demand[chip.grid_index(point)] < supply
+    };
+
+    // moves costing more, like wrong-way ones, cannot be told apart by breadth first search
+    let weights = Weights::default();
+    let moves = Moves::new(
+        chip.layer_table(),
+        chip.dim,
+        min_layer,
+        WrongWay::Refused,
+        &weights,
+        &[],
+    );
+
+    let mut visited = vec![false; chip.layers.len() * chip.dim.size()];
+    let mut queue = VecDeque::new();
+
+    visited[chip.grid_index(source)] = true;
+    queue.push_back((source, 1));
+
+    while let Some((point, length)) = queue.pop_front() {
+        if point == target {
+            return Some(length);
+        }
+
+        for (next, _) in moves.from(point) {
+            let idx = chip.grid_index(next);
+            if visited[idx] || (next != target && !free(next)) {
+                continue;
+            }
+
+            visited[idx] = true;
+            queue.push_back((next, length + 1));
+        }
+    }
+
+    None
+}
+
+/// A random design of a few rows, columns and layers of alternating directions,
+/// with a grid out of three full if `blocked`, and a net N1 of two pins without routes.
+/// Returns the chip and the grids of both pins.
+fn random_chip(rng: &mut Rng, blocked: bool) -> (Chip, Point<usize>, Point<usize>) {
+    let rows = 2 + rng.below(5);
+    let cols = 2 + rng.below(5);
+    let layers = 2 + rng.below(3);
+
+    let mut content = format!(
+        "MaxCellMove 0\nGGridBoundaryIdx 1 1 {} {}\nNumLayer {}\n",
+        rows, cols, layers
+    );
+    for lay in 1..=layers {
+        let direction = if lay % 2 == 1 { 'H' } else { 'V' };
+        content += &format!("Lay M{} {} {} 1\n", lay, lay, direction);
+    }
+
+    let mut full = Vec::new();
+    for row in 1..=rows {
+        for col in 1..=cols {
+            for lay in 1..=layers {
+                if blocked && rng.below(3) == 0 {
+                    full.push(format!("{} {} {} -1\n", row, col, lay));
+                }
+            }
+        }
+    }
+    content += &format!("NumNonDefaultSupplyGGrid {}\n", full.len());
+    content += &full.concat();
+
+    let pins = (1 + rng.below(layers), 1 + rng.below(layers));
+    let cells = [
+        (1 + rng.below(rows), 1 + rng.below(cols)),
+        (1 + rng.below(rows), 1 + rng.below(cols)),
+    ];
+    content += &format!(
+        "NumMasterCell 2
+MasterCell MC1 1 0
+Pin P1 M{}
+MasterCell MC2 1 0
+Pin P1 M{}
+NumNeighborCellExtraDemand 0
+NumCellInst 2
+CellInst C1 MC1 {} {} Fixed
+CellInst C2 MC2 {} {} Fixed
+NumNets 1
+Net N1 2 NoCstr
+Pin C1/P1
+Pin C2/P1
+NumRoutes 0
+",
+        pins.0, pins.1, cells[0].0, cells[0].1, cells[1].0, cells[1].1
+    );
+
+    let mut chip = Chip::default();
+    chip.read_str(&content).expect("Cannot read the design");
+    let source = Point(cells[0].0 - 1, cells[0].1 - 1, pins.0 - 1);
+    let target = Point(cells[1].0 - 1, cells[1].1 - 1, pins.1 - 1);
+    (chip, source, target)
+}
+
+/// Checks that routes found for N1 are legal: along the directions of their layers,
+/// connecting both ends, and through grids with free capacity but at both ends.
+/// Returns the number of grids they go through.
+fn check_path(
+    chip: &Chip,
+    routes: &[Route<usize>],
+    source: Point<usize>,
+    target: Point<usize>,
+) -> usize {
+    for route in routes {
+        assert_eq!(route_violation(chip, 0, route), None, "{:?}", route);
+    }
+
+    let routes: HashSet<_> = routes.iter().copied().collect();
+    assert!(chip.connects(0, &routes), "{:?} is not connected", routes);
+
+    let points: HashSet<_> = routes.iter().flat_map(Route::points).collect();
+    for &point in points
+        .iter()
+        .filter(|&&point| point != source && point != target)
+    {
+        let supply = *chip.layers[point.lay()]
+            .get_capacity(point.row(), point.col())
+            .unwrap();
+        assert!(
+            supply > 0,
+            "{:?} goes through the full grid {:?}",
+            routes,
+            point
+        );
+    }
+
+    points.len().max(1)
+}
+
+#[test]
+fn maze_route_is_shortest() {
+    let mut rng = Rng::new(989);
+    for _ in 0..300 {
+        let (chip, source, target) = random_chip(&mut rng, true);
+        let search = Search::new(&chip, 0);
+
+        match shortest_length(&chip, source, target, 0) {
+            Some(length) => {
+                let routes = maze_route(&search, source, target).expect("No path found");
+                assert_eq!(check_path(&chip, &routes, source, target), length);
+            }
+            None => assert_eq!(maze_route(&search, source, target), None),
+        }
+    }
+}
+
+#[test]
+fn astar_route_is_shortest() {
+    let mut rng = Rng::new(989);
+    for _ in 0..300 {
+        let (chip, source, target) = random_chip(&mut rng, true);
+        let search = Search::new(&chip, 0);
+
+        match shortest_length(&chip, source, target, 0) {
+            Some(length) => {
+                let routes =
+                    astar_route(&search, source, target, &Manhattan).expect("No path found");
+                assert_eq!(check_path(&chip, &routes, source, target), length);
+            }
+            None => assert_eq!(astar_route(&search, source, target, &Manhattan), None),
+        }
+    }
+}
+
+#[test]
+fn route_two_pins_is_shortest_on_free_grids() {
+    let mut rng = Rng::new(989);
+    for _ in 0..300 {
+        let (chip, source, target) = random_chip(&mut rng, false);
+        let search = Search::new(&chip, 0);
+
+        let length = shortest_length(&chip, source, target, 0).expect("No path exists");
+        let routes = route_two_pins(&search, source, target).expect("No path found");
+        assert_eq!(check_path(&chip, &routes, source, target), length);
+    }
+}
+
+#[test]
+fn route_two_pins_is_legal_around_full_grids() {
+    let mut rng = Rng::new(989);
+    for _ in 0..300 {
+        let (chip, source, target) = random_chip(&mut rng, true);
+        let search = Search::new(&chip, 0);
+
+        // patterns fitting between full grids may be longer than detours
+        match shortest_length(&chip, source, target, 0) {
+            Some(length) => {
+                let routes = route_two_pins(&search, source, target).expect("No path found");
+                assert!(check_path(&chip, &routes, source, target) >= length);
+            }
+            None => assert_eq!(route_two_pins(&search, source, target), None),
+        }
+    }
+}
+
+#[test]
+fn route_two_pins_falls_back_to_maze_route() {
+    // the grid between both pins is full on every layer, so that no pattern fits
+    let content = "MaxCellMove 0
+GGridBoundaryIdx 1 1 3 3
+NumLayer 2
+Lay M1 1 H 1
+Lay M2 2 V 1
+NumNonDefaultSupplyGGrid 2
+1 2 1 -1
+1 2 2 -1
+NumMasterCell 1
+MasterCell MC1 1 0
+Pin P1 M1
+NumNeighborCellExtraDemand 0
+NumCellInst 2
+CellInst C1 MC1 1 1 Fixed
+CellInst C2 MC1 1 3 Fixed
+NumNets 1
+Net N1 2 NoCstr
+Pin C1/P1
+Pin C2/P1
+NumRoutes 0
+";
+    let mut chip = Chip::default();
+    chip.read_str(content).expect("Cannot read the design");
+    let (source, target) = (Point(0, 0, 0), Point(0, 2, 0));
+    let search = Search::new(&chip, 0);
+
+    assert_eq!(pattern_route(&search, source, target), None);
+    let routes = route_two_pins(&search, source, target).expect("No path found");
+    let length = shortest_length(&chip, source, target, 0).expect("No path exists");
+    assert_eq!(check_path(&chip, &routes, source, target), length);
+}
+
+#[test]
+fn watched_search_reports_its_progress() {
+    let mut rng = Rng::new(976);
+    let (chip, source, target) = random_chip(&mut rng, false);
+    let progress = Progress::new();
+
+    {
+        let search = Search::new(&chip, 0).watched(&progress);
+        assert_eq!(progress.net(), Some(0));
+        assert_eq!(progress.best(), None);
+
+        maze_route(&search, source, target).expect("No path found");
+        assert!(progress.pops() > 0);
+        assert!(progress.best().is_some());
+        assert!(progress.elapsed().is_some());
+    }
+
+    // finished once dropped, keeping the figures of the last search
+    assert_eq!(progress.net(), None);
+    assert_eq!(progress.elapsed(), None);
+    assert!(progress.pops() > 0);
+}
+
+#[test]
+fn straight_nets_are_tagged_as_routed_by_patterns() {
+    // N1 detours through the second row, where a straight pattern joins its pins on M1
+    let content = "MaxCellMove 0
+GGridBoundaryIdx 1 1 3 3
+NumLayer 2
+Lay M1 1 H 10
+Lay M2 2 V 10
+NumNonDefaultSupplyGGrid 0
+NumMasterCell 1
+MasterCell MC1 1 0
+Pin P1 M1
+NumNeighborCellExtraDemand 0
+NumCellInst 2
+CellInst C1 MC1 1 1 Fixed
+CellInst C2 MC1 1 3 Fixed
+NumNets 1
+Net N1 2 NoCstr
+Pin C1/P1
+Pin C2/P1
+NumRoutes 5
+1 1 1 1 1 2 N1
+1 1 2 2 1 2 N1
+2 1 2 2 1 1 N1
+2 1 1 2 3 1 N1
+2 3 1 1 3 1 N1
+";
+    let mut chip = Chip::default();
+    chip.read_str(content).expect("Cannot read the design");
+    chip.track_provenance();
+    chip.pass = Provenance::Maze(1);
+
+    let outcome = reroute(&mut chip, 0, Escalation::after(0), None);
+    assert_eq!(outcome, Outcome::Rerouted);
+
+    let segments = chip.nets[0].segments();
+    assert_eq!(segments.len(), 1, "{:?}", segments);
+    for route in segments.iter() {
+        let pass = chip
+            .provenance_of(0, route)
+            .expect("Provenance not tracked");
+        assert_eq!(pass.to_string(), "pattern");
+    }
+}
@@ -0,0 +1,37 @@
+//! Where route segments go, and merging them, diagonal ones included.
+
+use cell_move_router::{Point, Route, Towards};
+use std::collections::HashSet;
+
+#[test]
+fn diagonal_routes_go_nowhere() {
+    assert_eq!(Route(Point(0, 0, 0), Point(0, 0, 0)).towards(), None);
+    assert_eq!(Route(Point(0, 0, 0), Point(2, 3, 0)).towards(), None);
+    assert_eq!(Route(Point(1, 0, 0), Point(0, 1, 1)).towards(), None);
+    assert_eq!(
+        Route(Point(0, 0, 0), Point(2, 0, 0)).towards(),
+        Some(Towards::Right)
+    );
+    assert_eq!(
+        Route(Point(0, 0, 1), Point(0, 0, 0)).towards(),
+        Some(Towards::Bottom)
+    );
+}
+
+#[test]
+fn merging_keeps_diagonal_routes() {
+    let diagonal = Route(Point(0, 0, 0), Point(2, 2, 0));
+    let routes: HashSet<_> = vec![
+        diagonal,
+        Route(Point(0, 0, 0), Point(1, 0, 0)),
+        Route(Point(1, 0, 0), Point(2, 0, 0)),
+    ]
+    .into_iter()
+    .collect();
+
+    let merged = Route::merge(&routes);
+    let expected: HashSet<_> = vec![diagonal, Route(Point(0, 0, 0), Point(2, 0, 0))]
+        .into_iter()
+        .collect();
+    assert_eq!(merged, expected);
+}
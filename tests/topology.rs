@@ -0,0 +1,153 @@
+//! Topologies of multi-pin nets on random pins, and their decomposition into 2-pin tasks.
+
+use cell_move_router::{
+    kruskal_tree, prim_tree, steiner_tree, Decomposition, Pair, Point, Rng, Topology,
+};
+use std::collections::HashSet;
+
+/// Up to `max` random pins on a grid of 20 x 20, duplicates possible.
+fn random_pins(rng: &mut Rng, max: usize) -> Vec<Pair<usize>> {
+    (0..1 + rng.below(max))
+        .map(|_| Pair(rng.below(20), rng.below(20)))
+        .collect()
+}
+
+/// Checks that a topology is a tree spanning every pin, its first points being the distinct pins.
+fn check_tree(topology: &Topology, pins: &[Pair<usize>]) {
+    let distinct: HashSet<_> = pins.iter().copied().collect();
+    assert_eq!(topology.pins, distinct.len());
+    let firsts: HashSet<_> = topology.points[..topology.pins].iter().copied().collect();
+    assert_eq!(firsts, distinct);
+    assert_eq!(topology.edges.len() + 1, topology.points.len());
+
+    // a tree is connected with one edge less than points
+    let mut reached = vec![false; topology.points.len()];
+    reached[0] = true;
+    let mut changed = true;
+    while changed {
+        changed = false;
+        for &(a, b) in topology.edges.iter() {
+            if reached[a] != reached[b] {
+                reached[a] = true;
+                reached[b] = true;
+                changed = true;
+            }
+        }
+    }
+    assert!(reached.iter().all(|&reached| reached), "{:?}", topology);
+}
+
+#[test]
+fn kruskal_and_prim_trees_are_as_long() {
+    let mut rng = Rng::new(1056);
+    for _ in 0..500 {
+        let pins = random_pins(&mut rng, 12);
+        let (kruskal, prim) = (kruskal_tree(&pins), prim_tree(&pins));
+        check_tree(&kruskal, &pins);
+        check_tree(&prim, &pins);
+        assert_eq!(kruskal.length(), prim.length(), "{:?}", pins);
+    }
+}
+
+#[test]
+fn steiner_tree_is_no_longer_than_spanning_tree() {
+    let mut rng = Rng::new(1056);
+    for _ in 0..500 {
+        let pins = random_pins(&mut rng, 30);
+        assert!(
+            steiner_tree(&pins).length() <= prim_tree(&pins).length(),
+            "{:?}",
+            pins
+        );
+    }
+}
+
+#[test]
+fn steiner_tree_spans_every_pin() {
+    let mut rng = Rng::new(1055);
+    for _ in 0..500 {
+        // past the pins under which the tree is exact too
+        let pins = random_pins(&mut rng, 30);
+        let steiner = steiner_tree(&pins);
+        check_tree(&steiner, &pins);
+
+        // no tree is shorter than half the perimeter of the bounding box
+        let rows = pins.iter().map(|pin| pin.0);
+        let cols = pins.iter().map(|pin| pin.1);
+        let half_perimeter = rows.clone().max().unwrap() - rows.min().unwrap()
+            + cols.clone().max().unwrap()
+            - cols.min().unwrap();
+        assert!(steiner.length() >= half_perimeter, "{:?}", pins);
+    }
+}
+
+#[test]
+fn steiner_tree_shares_edges() {
+    // the two pins of the first row and the one under their middle meet between them
+    let pins = [Pair(0, 0), Pair(0, 4), Pair(4, 2)];
+    assert_eq!(prim_tree(&pins).length(), 10);
+    let steiner = steiner_tree(&pins);
+    assert_eq!(steiner.length(), 8);
+    assert_eq!(steiner.steiner_points(), &[Pair(0, 2)]);
+}
+
+#[test]
+fn decomposition_shares_edges() {
+    let pins = [Point(0, 0, 0), Point(0, 4, 0), Point(4, 2, 0)];
+    let flat: Vec<_> = pins.iter().map(|pin| pin.flatten()).collect();
+    let topology = steiner_tree(&flat);
+    let decomposition = Decomposition::new(&topology, &pins);
+
+    // the first pin connects to both others, through the edge to the Steiner point
+    assert_eq!(decomposition.len(), 2);
+    for task in decomposition.tasks.iter() {
+        assert_eq!(task.source, pins[0]);
+        assert_eq!(task.edges.len(), 2);
+    }
+    let shared: Vec<_> = decomposition
+        .edge_tasks
+        .iter()
+        .filter(|tasks| tasks.len() > 1)
+        .collect();
+    assert_eq!(shared, [&vec![0, 1]]);
+
+    assert_eq!(decomposition.shared_with(0), [1]);
+    assert_eq!(decomposition.shared_with(1), [0]);
+    assert_eq!(decomposition.subnet(0), [0, 1]);
+}
+
+#[test]
+fn decomposition_covers_every_edge() {
+    let mut rng = Rng::new(1057);
+    for _ in 0..500 {
+        let pins: Vec<_> = random_pins(&mut rng, 12)
+            .into_iter()
+            .map(|pin| pin.with(rng.below(3)))
+            .collect();
+        let flat: Vec<_> = pins.iter().map(|pin| pin.flatten()).collect();
+        let topology = steiner_tree(&flat);
+        let decomposition = Decomposition::new(&topology, &pins);
+
+        // every pin is connected once, from a pin connected before
+        let distinct: HashSet<_> = pins.iter().copied().collect();
+        assert_eq!(decomposition.len() + 1, distinct.len());
+        let mut connected = HashSet::new();
+        connected.insert(pins[0]);
+        for task in decomposition.tasks.iter() {
+            assert!(connected.contains(&task.source), "{:?}", task);
+            assert!(connected.insert(task.target), "{:?}", task);
+        }
+
+        assert!(decomposition
+            .edge_tasks
+            .iter()
+            .all(|tasks| !tasks.is_empty()));
+        for task in 0..decomposition.len() {
+            let subnet = decomposition.subnet(task);
+            assert!(subnet.contains(&task));
+            for other in decomposition.shared_with(task) {
+                assert!(subnet.contains(&other));
+            }
+        }
+    }
+}
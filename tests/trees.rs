@@ -0,0 +1,160 @@
+//! Route trees of the nets of small inputs: their nodes, splitting and pruning.
+
+use cell_move_router::{Chip, Point, Route, RouteTree};
+
+/// An input where C1 and C2 are joined by N1 along M1,
+/// and C2 and C3 by N2 going up to M2 and back down.
+const INPUT: &str = "MaxCellMove 0
+GGridBoundaryIdx 1 1 3 3
+NumLayer 2
+Lay M1 1 H 10
+Lay M2 2 V 10
+NumNonDefaultSupplyGGrid 0
+NumMasterCell 1
+MasterCell MC1 1 0
+Pin P1 M1
+NumNeighborCellExtraDemand 0
+NumCellInst 3
+CellInst C1 MC1 1 1 Fixed
+CellInst C2 MC1 1 3 Fixed
+CellInst C3 MC1 3 3 Fixed
+NumNets 2
+Net N1 2 NoCstr
+Pin C1/P1
+Pin C2/P1
+Net N2 2 NoCstr
+Pin C2/P1
+Pin C3/P1
+NumRoutes 4
+1 1 1 1 3 1 N1
+1 3 1 1 3 2 N2
+1 3 2 3 3 2 N2
+3 3 2 3 3 1 N2
+";
+
+/// Reads an input.
+fn read(content: &str) -> Chip {
+    let mut chip = Chip::default();
+    chip.read_str(content).expect("Cannot read the input");
+    chip
+}
+
+#[test]
+fn trees_join_pins_through_pseudo_pins() {
+    let chip = read(INPUT);
+    let tree = chip.route_tree(1);
+
+    let points: Vec<_> = tree.nodes.iter().map(|node| node.point).collect();
+    assert_eq!(
+        points,
+        vec![
+            Point(0, 2, 0),
+            Point(0, 2, 1),
+            Point(2, 2, 0),
+            Point(2, 2, 1)
+        ]
+    );
+    let pins: Vec<_> = tree.nodes.iter().map(|node| node.pin).collect();
+    assert_eq!(pins, vec![true, false, true, false]);
+
+    // where N2 turns, up then down
+    assert_eq!(tree.pseudo_pins(), vec![1, 3]);
+    assert_eq!(tree.leaves(), vec![0, 2]);
+    assert!(tree.is_tree());
+
+    // from a pin to the other through both pseudo pins
+    let walk = tree.walk(0);
+    assert_eq!(
+        walk,
+        vec![(0, None), (1, Some(0)), (3, Some(1)), (2, Some(3))]
+    );
+}
+
+#[test]
+fn crossing_routes_meet_at_steiner_points() {
+    // N1 joins four cells around the middle grid by two routes crossing there
+    let chip = read(
+        "MaxCellMove 0
+GGridBoundaryIdx 1 1 3 3
+NumLayer 1
+Lay M1 1 H 10
+NumNonDefaultSupplyGGrid 0
+NumMasterCell 1
+MasterCell MC1 1 0
+Pin P1 M1
+NumNeighborCellExtraDemand 0
+NumCellInst 4
+CellInst C1 MC1 2 1 Fixed
+CellInst C2 MC1 2 3 Fixed
+CellInst C3 MC1 1 2 Fixed
+CellInst C4 MC1 3 2 Fixed
+NumNets 1
+Net N1 4 NoCstr
+Pin C1/P1
+Pin C2/P1
+Pin C3/P1
+Pin C4/P1
+NumRoutes 2
+2 1 1 2 3 1 N1
+1 2 1 3 2 1 N1
+",
+    );
+    let tree = chip.route_tree(0);
+
+    let middle = tree.node_at(Point(1, 1, 0)).expect("No Steiner point");
+    assert!(!tree.nodes[middle].pin);
+    assert_eq!(tree.nodes[middle].neighbors.len(), 4);
+    assert_eq!(tree.pseudo_pins(), vec![middle]);
+    assert!(tree.is_tree());
+
+    let split = RouteTree::split(&chip.nets[0].segments());
+    assert_eq!(split.len(), 4);
+    assert!(split
+        .iter()
+        .all(|&Route(source, target)| source == Point(1, 1, 0) || target == Point(1, 1, 0)));
+}
+
+#[test]
+fn dangling_routes_are_pruned() {
+    // N1 has a stub of two segments off its middle, ending at no pin
+    let chip = &mut read(&INPUT.replace(
+        "NumRoutes 4\n",
+        "NumRoutes 6\n1 2 1 2 2 1 N1\n2 2 1 2 2 2 N1\n",
+    ));
+    assert_eq!(chip.nets[0].length(), 5);
+
+    assert_eq!(chip.prune_dangling(), 1);
+    assert_eq!(chip.nets[0].length(), 3);
+    assert!(chip.connects(0, &chip.nets[0].segments()));
+    let tree = chip.route_tree(0);
+    assert!(tree.leaves().iter().all(|&leaf| tree.nodes[leaf].pin));
+
+    // nothing left to prune
+    assert_eq!(chip.prune_dangling(), 0);
+}
+
+#[test]
+fn collinear_routes_are_merged_when_read_and_written() {
+    // N1 in overlapping pieces, with a point on it
+    let chip = &mut read(&INPUT.replace(
+        "NumRoutes 4\n1 1 1 1 3 1 N1\n",
+        "NumRoutes 6\n1 1 1 1 2 1 N1\n1 3 1 1 2 1 N1\n1 2 1 1 2 1 N1\n",
+    ));
+    let whole = Route(Point(0, 0, 0), Point(0, 2, 0));
+    assert_eq!(
+        chip.nets[0].segments().iter().collect::<Vec<_>>(),
+        vec![&whole]
+    );
+
+    // routed in pieces again, but written whole
+    let pieces = vec![
+        Route(Point(0, 0, 0), Point(0, 1, 0)),
+        Route(Point(0, 1, 0), Point(0, 2, 0)),
+    ];
+    chip.set_routes(0, pieces.into_iter().collect());
+    assert_eq!(chip.nets[0].segments().len(), 2);
+    let output = chip.to_string();
+    assert!(output.contains("NumRoutes 4\n"), "{}", output);
+    assert_eq!(output.matches(" N1").count(), 1, "{}", output);
+    assert!(output.contains("1 1 1 1 3 1 N1"), "{}", output);
+}
@@ -0,0 +1,81 @@
+//! Warm starts from the solution of a previous version of an input.
+
+use cell_move_router::{Chip, Pair, Point, Route, Solution};
+
+/// An input where C1 and C2 are joined by N1, and C2 and the fixed C3 by N2.
+const INPUT: &str = "MaxCellMove 2
+GGridBoundaryIdx 1 1 3 3
+NumLayer 2
+Lay M1 1 H 10
+Lay M2 2 V 10
+NumNonDefaultSupplyGGrid 0
+NumMasterCell 1
+MasterCell MC1 1 0
+Pin P1 M1
+NumNeighborCellExtraDemand 0
+NumCellInst 3
+CellInst C1 MC1 1 1 Movable
+CellInst C2 MC1 1 3 Movable
+CellInst C3 MC1 3 3 Fixed
+NumNets 2
+Net N1 2 NoCstr
+Pin C1/P1
+Pin C2/P1
+Net N2 2 NoCstr
+Pin C2/P1
+Pin C3/P1
+NumRoutes 4
+1 1 1 1 3 1 N1
+1 3 1 1 3 2 N2
+1 3 2 3 3 2 N2
+3 3 2 3 3 1 N2
+";
+
+fn read(content: &str) -> Chip {
+    let mut chip = Chip::default();
+    chip.read_str(content).expect("Cannot read the input");
+    chip
+}
+
+/// A solution moving C1 next to C2, with N1 routed between them.
+fn solution() -> Solution {
+    let mut solution = Solution::default();
+    solution.cells.insert(0, Pair(0, 1));
+    let route = Route(Point(0, 1, 0), Point(0, 2, 0));
+    solution.routes.insert(0, vec![route].into_iter().collect());
+    solution
+}
+
+#[test]
+fn moved_cells_keep_their_nets() {
+    let old = read(INPUT);
+    let mut chip = read(INPUT);
+    let solution = solution();
+
+    assert_eq!(chip.warm_start(&old, &solution), 2);
+    assert_eq!(chip.cells[0].position, Pair(0, 1));
+    assert_eq!(*chip.nets[0].segments(), solution.routes[&0]);
+    assert!(!chip.nets[0].dirty && !chip.nets[1].dirty);
+}
+
+#[test]
+fn fixed_cells_are_not_moved() {
+    let old = read(INPUT);
+    let mut chip = read(INPUT);
+    let mut solution = Solution::default();
+    solution.cells.insert(2, Pair(1, 2));
+
+    // N2 is not where the solution left it
+    assert_eq!(chip.warm_start(&old, &solution), 1);
+    assert_eq!(chip.cells[2].position, Pair(2, 2));
+    assert!(!chip.nets[0].dirty && chip.nets[1].dirty);
+}
+
+#[test]
+fn changed_cells_drop_their_nets() {
+    let old = read(INPUT);
+    let mut chip = read(&INPUT.replace("C2 MC1 1 3", "C2 MC1 2 3"));
+
+    assert_eq!(chip.warm_start(&old, &solution()), 0);
+    assert_eq!(chip.cells[0].position, Pair(0, 1));
+}